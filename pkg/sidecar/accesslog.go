@@ -0,0 +1,36 @@
+package sidecar
+
+import (
+	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/accesslog"
+)
+
+func (srv *Server) initAccessLog() error {
+	ac := &srv.cfg.HTTP.AccessLog
+	if !ac.Enabled && ac.File == "" {
+		return nil
+	}
+
+	format, err := accesslog.ParseFormat(ac.Format)
+	if err != nil {
+		return core.Wrap(err, "HTTP.AccessLog")
+	}
+
+	cfg := &accesslog.Config{
+		Logger:      srv.cfg.Logger,
+		LogRequests: ac.Enabled,
+		File:        ac.File,
+		Format:      format,
+		MaxSize:     int64(ac.MaxSize) << 20,
+		MaxBackups:  ac.MaxBackups,
+	}
+
+	al, err := cfg.New()
+	if err != nil {
+		return core.Wrap(err, "HTTP.AccessLog")
+	}
+
+	srv.accessLog = al
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package accesslog implements access logging for the sidecar
+// HTTP servers, via slog and/or Common/Combined Log Format
+// files with rotation.
+package accesslog
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"darvaza.org/slog"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+// AccessLog records the requests handled by the HTTP servers.
+// A nil *AccessLog is valid and logs nothing.
+type AccessLog struct {
+	cfg Config
+	out *RotatingFile
+}
+
+// Middleware logs the requests handled by next on the given
+// protocol, "h2c", "h2" or "h3".
+func (al *AccessLog) Middleware(proto string, next http.Handler) http.Handler {
+	if al == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		e := newEntry(proto, req)
+		rw, req, o := observe.HTTP(rw, req)
+
+		next.ServeHTTP(rw, req)
+
+		e.Status = o.Status()
+		e.Bytes = o.Bytes()
+		e.Horizon = o.Horizon()
+		e.Duration = time.Since(e.Time)
+
+		al.Log(e)
+	})
+}
+
+func newEntry(proto string, req *http.Request) *Entry {
+	e := &Entry{
+		Time:       time.Now(),
+		Proto:      proto,
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.RequestURI(),
+		HTTPProto:  req.Proto,
+		RemoteAddr: req.RemoteAddr,
+		Referer:    req.Referer(),
+		UserAgent:  req.UserAgent(),
+	}
+
+	if req.TLS != nil {
+		e.TLSVersion = tls.VersionName(req.TLS.Version)
+	}
+
+	if id, ok := peer.FromHTTPRequest(req); ok {
+		e.User = id.CommonName
+		if id.SPIFFEID != nil {
+			e.User = id.SPIFFEID.String()
+		}
+	}
+
+	return e
+}
+
+// Log records an [Entry]
+func (al *AccessLog) Log(e *Entry) {
+	if al == nil {
+		return
+	}
+
+	if l := al.cfg.Logger; l != nil && al.cfg.LogRequests {
+		if l, ok := l.Info().WithEnabled(); ok {
+			l.WithFields(e.Fields()).Print("access")
+		}
+	}
+
+	if al.out != nil {
+		if _, err := al.out.Write(e.AppendFormat(nil, al.cfg.Format)); err != nil {
+			al.logError(err)
+		}
+	}
+}
+
+func (al *AccessLog) logError(err error) {
+	if l := al.cfg.Logger; l != nil {
+		if l, ok := l.Error().WithEnabled(); ok {
+			l.WithField(slog.ErrorFieldName, err).
+				WithField("File", al.cfg.File).
+				Print("access log")
+		}
+	}
+}
+
+// Close closes the log file, if any
+func (al *AccessLog) Close() error {
+	if al == nil || al.out == nil {
+		return nil
+	}
+	return al.out.Close()
+}
+
+// Fields returns the [Entry] as structured log fields
+func (e *Entry) Fields() slog.Fields {
+	fields := slog.Fields{
+		"Method":     e.Method,
+		"Host":       e.Host,
+		"Path":       e.Path,
+		"Status":     e.Status,
+		"Bytes":      e.Bytes,
+		"Duration":   e.Duration,
+		"Proto":      e.Proto,
+		"RemoteAddr": e.RemoteAddr,
+	}
+
+	for k, v := range map[string]string{
+		"TLSVersion": e.TLSVersion,
+		"Horizon":    e.Horizon,
+		"User":       e.User,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+
+	return fields
+}
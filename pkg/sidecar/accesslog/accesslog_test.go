@@ -0,0 +1,113 @@
+package accesslog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+)
+
+type testFormatCase struct {
+	f        Format
+	expected string
+}
+
+func TestFormat(t *testing.T) {
+	e := &Entry{
+		Time:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Method:     "GET",
+		Path:       "/apache_pb.gif",
+		HTTPProto:  "HTTP/1.0",
+		Status:     200,
+		Bytes:      2326,
+		RemoteAddr: "127.0.0.1:1234",
+		User:       "frank",
+		Referer:    "http://www.example.com/start.html",
+	}
+
+	var cases = []testFormatCase{
+		{FormatCommon, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326` + "\n"},
+		{FormatCombined, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 ` +
+			`"http://www.example.com/start.html" "-"` + "\n"},
+	}
+
+	for _, tc := range cases {
+		if s := string(e.AppendFormat(nil, tc.f)); s != tc.expected {
+			t.Errorf("ERROR: %s: %q (expected %q)", tc.f, s, tc.expected)
+		} else {
+			t.Logf("%s: success", tc.f)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+
+	al, err := (&Config{File: name, Format: FormatCommon, MaxSize: 200, MaxBackups: 1}).New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+	defer al.Close()
+
+	h := al.Middleware("h2", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		observe.SetHorizon(req.Context(), "lan")
+		rw.WriteHeader(http.StatusCreated)
+		_, _ = rw.Write([]byte("hello"))
+	}))
+
+	// each line is ~80 bytes, so three rotate once
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/foo?bar", nil))
+	}
+
+	current, _ := os.ReadFile(name)
+	backup, _ := os.ReadFile(name + ".1")
+
+	switch {
+	case strings.Count(string(current), "\n") != 1:
+		t.Errorf("ERROR: current: %q", current)
+	case strings.Count(string(backup), "\n") != 2:
+		t.Errorf("ERROR: backup: %q", backup)
+	case !strings.Contains(string(current), `"POST /foo?bar HTTP/1.1" 201 5`):
+		t.Errorf("ERROR: line: %q", current)
+	default:
+		t.Log("success")
+	}
+}
+
+func TestRotatingFileFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "access.log")
+
+	// the backup can't be replaced
+	if err := os.MkdirAll(filepath.Join(name+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := OpenRotatingFile(name, 10, 1)
+	if err != nil {
+		t.Fatalf("ERROR: OpenRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	for i, line := range []string{"first\n", "second\n", "third\n"} {
+		n, err := rf.Write([]byte(line))
+		switch {
+		case n != len(line):
+			t.Fatalf("ERROR: %v: line lost: %v", i, err)
+		case i > 0 && err == nil:
+			t.Errorf("ERROR: %v: rotation failure not reported", i)
+		}
+	}
+
+	data, _ := os.ReadFile(name)
+	if string(data) != "first\nsecond\nthird\n" {
+		t.Errorf("ERROR: current: %q", data)
+	} else {
+		t.Log("success")
+	}
+}
@@ -0,0 +1,80 @@
+package accesslog
+
+import (
+	"darvaza.org/core"
+	"darvaza.org/slog"
+)
+
+// DefaultMaxBackups is the number of rotated files kept when
+// none is specified
+const DefaultMaxBackups = 5
+
+// Config describes where the [AccessLog] records requests
+type Config struct {
+	// Logger, if not nil, receives the errors writing File, and
+	// every request as structured fields at Info level if
+	// LogRequests is enabled
+	Logger      slog.Logger
+	LogRequests bool
+
+	// File is the optional path of a Common or Combined Log
+	// Format file
+	File   string
+	Format Format
+	// MaxSize is the size in bytes that triggers the rotation
+	// of File. Zero disables rotation.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int
+}
+
+// SetDefaults fills gaps in the [Config]
+func (cfg *Config) SetDefaults() error {
+	if cfg.Format == "" {
+		cfg.Format = FormatCombined
+	}
+
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = DefaultMaxBackups
+	}
+
+	return nil
+}
+
+// Validate tells if the [Config] is usable
+func (cfg *Config) Validate() error {
+	switch {
+	case !cfg.Format.IsValid():
+		return core.Wrapf(core.ErrInvalid, "%q: unknown access log format", cfg.Format)
+	case cfg.MaxSize < 0:
+		return core.Wrap(core.ErrInvalid, "MaxSize: negative")
+	default:
+		return nil
+	}
+}
+
+// New creates an [AccessLog], opening the file if any
+func (cfg *Config) New() (*AccessLog, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	al := &AccessLog{cfg: *cfg}
+	if cfg.File != "" {
+		out, err := OpenRotatingFile(cfg.File, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		al.out = out
+	}
+
+	return al, nil
+}
@@ -0,0 +1,114 @@
+package accesslog
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"darvaza.org/core"
+)
+
+// Format is the layout of the access log file
+type Format string
+
+const (
+	// FormatCommon is the NCSA Common Log Format
+	FormatCommon Format = "common"
+	// FormatCombined is the Common Log Format plus the
+	// Referer and User-Agent
+	FormatCombined Format = "combined"
+)
+
+// IsValid tells if the [Format] is known
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatCommon, FormatCombined:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseFormat converts a string into a [Format]. Empty
+// means [FormatCombined].
+func ParseFormat(s string) (Format, error) {
+	if s == "" {
+		return FormatCombined, nil
+	}
+
+	f := Format(strings.ToLower(s))
+	if !f.IsValid() {
+		return "", core.Wrapf(core.ErrInvalid, "%q: unknown access log format", s)
+	}
+	return f, nil
+}
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Entry describes a request handled by the server
+type Entry struct {
+	Time     time.Time
+	Duration time.Duration
+
+	// Proto is the sidecar protocol, "h2c", "h2" or "h3"
+	Proto string
+	// HTTPProto is the protocol of the request, like "HTTP/2.0"
+	HTTPProto string
+
+	Method     string
+	Host       string
+	Path       string
+	Status     int
+	Bytes      int64
+	RemoteAddr string
+	TLSVersion string
+	Horizon    string
+	Referer    string
+	UserAgent  string
+
+	// User is the SPIFFE ID or Common Name of the client
+	// certificate, if any
+	User string
+}
+
+// AppendFormat appends the [Entry] to a buffer as a line
+// in the given [Format]
+func (e *Entry) AppendFormat(b []byte, f Format) []byte {
+	host := e.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	b = append(b, orDash(host)...)
+	b = append(b, " - "...)
+	b = append(b, orDash(strings.ReplaceAll(e.User, " ", "_"))...)
+	b = append(b, " ["...)
+	b = e.Time.AppendFormat(b, clfTimeLayout)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, e.Method+" "+e.Path+" "+e.HTTPProto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	if e.Bytes > 0 {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	} else {
+		b = append(b, '-')
+	}
+
+	if f == FormatCombined {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.Referer))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(e.UserAgent))
+	}
+
+	return append(b, '\n')
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
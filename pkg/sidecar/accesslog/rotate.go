@@ -0,0 +1,171 @@
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+var _ io.WriteCloser = (*RotatingFile)(nil)
+
+// RotatingFile is a file renamed with a numeric suffix, and
+// replaced, once it reaches a given size. Older files are shifted
+// and the oldest removed.
+type RotatingFile struct {
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	closed bool
+
+	name       string
+	maxSize    int64
+	maxBackups int
+}
+
+// OpenRotatingFile opens a file for appending, rotating it once
+// it reaches maxSize bytes and keeping maxBackups old files.
+// If maxSize isn't positive the file is never rotated.
+func OpenRotatingFile(name string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		name:       name,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	rf.f, rf.size = f, fi.Size()
+	return nil
+}
+
+// Write appends data to the file, rotating it first if it
+// wouldn't fit. If the rotation fails the data is still appended
+// to the current file when possible, and the error returned.
+func (rf *RotatingFile) Write(b []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.reopen(); err != nil {
+		return 0, err
+	}
+
+	var rotateErr error
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(b)) > rf.maxSize {
+		rotateErr = rf.rotate()
+		if rf.f == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := rf.f.Write(b)
+	rf.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Rotate forces a rotation of the file
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.reopen(); err != nil {
+		return err
+	}
+	return rf.rotate()
+}
+
+// reopen retries opening the file if a previous rotation
+// left it closed
+func (rf *RotatingFile) reopen() error {
+	switch {
+	case rf.closed:
+		return fs.ErrClosed
+	case rf.f == nil:
+		return rf.open()
+	default:
+		return nil
+	}
+}
+
+// rotate shifts the backups and opens a new file. If the files
+// can't be shifted the current one is reopened, so the log
+// continues on it.
+func (rf *RotatingFile) rotate() error {
+	err := rf.f.Close()
+	rf.f = nil
+
+	if err == nil {
+		err = rf.shift()
+	}
+
+	if err2 := rf.open(); err2 != nil {
+		// retried on the next write
+		return err2
+	}
+	return err
+}
+
+// shift renames the current file and the backups, dropping
+// the oldest
+func (rf *RotatingFile) shift() error {
+	for i := rf.maxBackups; i > 0; i-- {
+		src := rf.backupName(i - 1)
+		err := os.Rename(src, rf.backupName(i))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if rf.maxBackups < 1 {
+		if err := os.Remove(rf.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backupName returns the name of the n-th backup, the current
+// file for zero.
+func (rf *RotatingFile) backupName(n int) string {
+	if n == 0 {
+		return rf.name
+	}
+	return fmt.Sprintf("%s.%v", rf.name, n)
+}
+
+// Close closes the file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	rf.closed = true
+	if rf.f == nil {
+		return nil
+	}
+
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
@@ -0,0 +1,148 @@
+// Package acme implements an ACME (RFC 8555) certificate issuer
+// for sidecars, answering HTTP-01 and TLS-ALPN-01 challenges.
+package acme
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+const (
+	// DefaultRenewBefore indicates how long before expiration
+	// certificates are renewed by default
+	DefaultRenewBefore = 30 * 24 * time.Hour
+
+	// DefaultRetryInterval indicates how long we wait by default
+	// before retrying a failed order, and at least between orders
+	DefaultRetryInterval = 10 * time.Minute
+
+	// RenewAfterRatio is the fraction of the lifetime of a
+	// certificate that needs to pass before it's renewed,
+	// regardless of RenewBefore
+	RenewAfterRatio = 2.0 / 3
+)
+
+// Config describes how the [Issuer] obtains certificates
+type Config struct {
+	Logger slog.Logger
+
+	// DirectoryURL is the ACME directory endpoint. Defaults to
+	// Let's Encrypt production
+	DirectoryURL string
+	// HTTPClient is used to talk to the ACME server, allowing
+	// custom roots when testing against Pebble or similar.
+	HTTPClient *http.Client
+
+	// Email is the optional contact of the ACME account
+	Email string
+	// Domains are the names included in the certificate
+	Domains []string
+
+	// Dir is an optional directory where the account key and
+	// the issued certificate are kept between restarts
+	Dir string
+
+	// DisableHTTP01 prevents answering HTTP-01 challenges
+	DisableHTTP01 bool
+	// DisableTLSALPN01 prevents answering TLS-ALPN-01 challenges
+	DisableTLSALPN01 bool
+
+	RenewBefore   time.Duration
+	RetryInterval time.Duration
+
+	// Fallback is an optional [storage.Store] used while
+	// the certificate hasn't been issued yet
+	Fallback storage.Store
+	// CAPool is returned by GetCAPool. If not specified the
+	// Fallback's will be used, or the system's
+	CAPool *x509.CertPool
+}
+
+// SetDefaults fills gaps in the [Config]
+func (cfg *Config) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = acme.LetsEncryptURL
+	}
+
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = DefaultRenewBefore
+	}
+
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+
+	if cfg.CAPool == nil {
+		cfg.CAPool = cfg.getCAPool()
+	}
+
+	return nil
+}
+
+func (cfg *Config) getCAPool() *x509.CertPool {
+	if cfg.Fallback != nil {
+		if pool := cfg.Fallback.GetCAPool(); pool != nil {
+			return pool
+		}
+	}
+
+	if pool, _ := x509.SystemCertPool(); pool != nil {
+		return pool
+	}
+
+	return x509.NewCertPool()
+}
+
+// Validate tells if the [Config] can be used
+func (cfg *Config) Validate() error {
+	switch {
+	case len(cfg.Domains) == 0:
+		return core.Wrap(core.ErrInvalid, "no domains")
+	case cfg.DisableHTTP01 && cfg.DisableTLSALPN01:
+		return core.Wrap(core.ErrInvalid, "all challenges disabled")
+	default:
+		return nil
+	}
+}
+
+// New creates a new [Issuer] from the [Config]. The account key and
+// certificate are loaded from Dir if available, but nothing
+// is requested to the ACME server until [Issuer.Run] is called.
+func (cfg *Config) New() (*Issuer, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	iss := &Issuer{
+		cfg:    *cfg,
+		http01: make(map[string]string),
+		alpn01: make(map[string]*tls.Certificate),
+	}
+
+	if err := iss.init(); err != nil {
+		return nil, err
+	}
+
+	return iss, nil
+}
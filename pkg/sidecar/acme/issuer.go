@@ -0,0 +1,430 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage"
+	"darvaza.org/slog"
+
+	"darvaza.org/sidecar/pkg/sidecar/httpserver"
+)
+
+var (
+	_ storage.Store = (*Issuer)(nil)
+	_ http.Handler  = (*Issuer)(nil)
+)
+
+// Issuer is a [storage.Store] serving a certificate obtained
+// via ACME, and renewing it before it expires.
+type Issuer struct {
+	mu  sync.RWMutex
+	cfg Config
+
+	// obtaining serialises orders
+	obtaining sync.Mutex
+
+	client *acme.Client
+	cert   *tls.Certificate
+
+	// registered tells if the account is known to the server
+	registered bool
+
+	// http01 maps HTTP-01 tokens to their key authorizations
+	http01 map[string]string
+	// alpn01 maps names to their TLS-ALPN-01 challenge certificates
+	alpn01 map[string]*tls.Certificate
+}
+
+func (iss *Issuer) init() error {
+	key, err := iss.loadAccountKey()
+	if err != nil {
+		return err
+	}
+
+	iss.client = &acme.Client{
+		Key:          key,
+		DirectoryURL: iss.cfg.DirectoryURL,
+		HTTPClient:   iss.cfg.HTTPClient,
+	}
+
+	cert, err := iss.loadCertificate()
+	switch {
+	case err == nil:
+		iss.cert = cert
+		iss.info().WithField("NotAfter", cert.Leaf.NotAfter).
+			Print("ACME certificate loaded")
+	case errors.Is(err, fs.ErrNotExist):
+		// not issued yet
+	default:
+		iss.warn(err).Print("ignoring stored ACME certificate")
+	}
+
+	return nil
+}
+
+// GetCertificate returns the issued certificate, the TLS-ALPN-01
+// challenge certificate when the ACME server is validating us,
+// or the fallback's certificate if one hasn't been issued yet.
+func (iss *Issuer) GetCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if isALPN01Hello(chi) {
+		return iss.getALPN01Cert(chi.ServerName)
+	}
+
+	iss.mu.RLock()
+	cert := iss.cert
+	iss.mu.RUnlock()
+
+	switch {
+	case cert != nil:
+		return cert, nil
+	case iss.cfg.Fallback != nil:
+		return iss.cfg.Fallback.GetCertificate(chi)
+	default:
+		return nil, core.Wrap(fs.ErrNotExist, "certificate not issued yet")
+	}
+}
+
+// GetCAPool returns the configured CA pool.
+func (iss *Issuer) GetCAPool() *x509.CertPool {
+	return iss.cfg.CAPool
+}
+
+// Certificate returns the issued certificate, if any.
+func (iss *Issuer) Certificate() *tls.Certificate {
+	iss.mu.RLock()
+	defer iss.mu.RUnlock()
+
+	return iss.cert
+}
+
+// ConfigureTLS enables TLS-ALPN-01 on the given [tls.Config].
+// Only hellos of ACME validators are answered with a dedicated
+// config advertising acme-tls/1, so the protocols of ordinary
+// clients aren't affected.
+func (iss *Issuer) ConfigureTLS(tc *tls.Config) {
+	if iss.cfg.DisableTLSALPN01 {
+		return
+	}
+
+	alpn01 := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{acme.ALPNProto},
+		GetCertificate: iss.GetCertificate,
+	}
+
+	next := tc.GetConfigForClient
+	tc.GetConfigForClient = func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+		switch {
+		case isALPN01Hello(chi):
+			return alpn01, nil
+		case next != nil:
+			return next(chi)
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// AcmeHTTP01Handler returns the [http.Handler] answering HTTP-01
+// challenges, to be used as [httpserver.Config] AcmeHTTP01.
+func (iss *Issuer) AcmeHTTP01Handler() http.Handler {
+	if iss.cfg.DisableHTTP01 {
+		return nil
+	}
+	return iss
+}
+
+// ServeHTTP answers HTTP-01 challenges
+func (iss *Issuer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var keyAuth string
+
+	if m, ok := httpserver.AcmeHTTP01Pattern.Capture(req.URL.Path); ok && m[0] != "" {
+		iss.mu.RLock()
+		keyAuth = iss.http01[m[0]]
+		iss.mu.RUnlock()
+	}
+
+	if keyAuth == "" {
+		http.NotFound(rw, req)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain")
+	_, _ = rw.Write([]byte(keyAuth))
+}
+
+func isALPN01Hello(chi *tls.ClientHelloInfo) bool {
+	return len(chi.SupportedProtos) == 1 && chi.SupportedProtos[0] == acme.ALPNProto
+}
+
+func (iss *Issuer) getALPN01Cert(name string) (*tls.Certificate, error) {
+	iss.mu.RLock()
+	defer iss.mu.RUnlock()
+
+	if cert, ok := iss.alpn01[strings.ToLower(name)]; ok {
+		return cert, nil
+	}
+
+	return nil, core.Wrapf(fs.ErrNotExist, "%q: no TLS-ALPN-01 challenge", name)
+}
+
+// NextRenewal tells when the certificate needs to be renewed.
+// Zero means it needs to be obtained now.
+func (iss *Issuer) NextRenewal() time.Time {
+	iss.mu.RLock()
+	defer iss.mu.RUnlock()
+
+	if iss.cert == nil || iss.cert.Leaf == nil || !iss.coversDomains(iss.cert.Leaf) {
+		return time.Time{}
+	}
+
+	return renewalTime(iss.cert.Leaf, iss.cfg.RenewBefore)
+}
+
+// renewalTime returns the moment renewBefore the expiration of
+// the certificate, but not earlier than [RenewAfterRatio] of its
+// lifetime, so short-lived certificates aren't renewed right
+// after being issued.
+func renewalTime(leaf *x509.Certificate, renewBefore time.Duration) time.Time {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	if limit := time.Duration(float64(lifetime) * (1 - RenewAfterRatio)); renewBefore > limit {
+		renewBefore = limit
+	}
+
+	return leaf.NotAfter.Add(-renewBefore)
+}
+
+func (iss *Issuer) coversDomains(leaf *x509.Certificate) bool {
+	for _, name := range iss.cfg.Domains {
+		if leaf.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Run obtains the certificate if needed and renews it before
+// it expires, until the context is cancelled. It waits at least
+// RetryInterval after every order, successful or not.
+func (iss *Issuer) Run(ctx context.Context) error {
+	for {
+		wait := iss.cfg.RetryInterval
+
+		if next := iss.NextRenewal(); time.Now().Before(next) {
+			// not yet
+			wait = time.Until(next)
+		} else if err := iss.Obtain(ctx); err != nil {
+			// failed, retry later
+			iss.error(err).Print("failed to obtain ACME certificate")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Obtain requests a new certificate to the ACME server
+// regardless of the current one.
+func (iss *Issuer) Obtain(ctx context.Context) error {
+	iss.obtaining.Lock()
+	defer iss.obtaining.Unlock()
+
+	if err := iss.register(ctx); err != nil {
+		return err
+	}
+
+	order, err := iss.client.AuthorizeOrder(ctx, acme.DomainIDs(iss.cfg.Domains...))
+	if err != nil {
+		return err
+	}
+
+	for _, u := range order.AuthzURLs {
+		if err := iss.authorize(ctx, u); err != nil {
+			return err
+		}
+	}
+
+	order, err = iss.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	cert, err := iss.finalize(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	iss.setCertificate(cert)
+	return nil
+}
+
+func (iss *Issuer) register(ctx context.Context) error {
+	if iss.registered {
+		return nil
+	}
+
+	acct := &acme.Account{}
+	if iss.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + iss.cfg.Email}
+	}
+
+	_, err := iss.client.Register(ctx, acct, acme.AcceptTOS)
+	switch {
+	case err == nil:
+		iss.info().Print("ACME account registered")
+	case errors.Is(err, acme.ErrAccountAlreadyExists):
+		// reused
+	default:
+		return err
+	}
+
+	iss.registered = true
+	return nil
+}
+
+func (iss *Issuer) authorize(ctx context.Context, u string) error {
+	z, err := iss.client.GetAuthorization(ctx, u)
+	switch {
+	case err != nil:
+		return err
+	case z.Status == acme.StatusValid:
+		// already authorized
+		return nil
+	}
+
+	chal, cleanup, err := iss.prepareChallenge(z)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := iss.client.Accept(ctx, chal); err != nil {
+		return err
+	}
+
+	_, err = iss.client.WaitAuthorization(ctx, z.URI)
+	return err
+}
+
+// prepareChallenge picks a supported challenge and makes it ready
+// to be validated. It returns a function to remove it afterwards.
+func (iss *Issuer) prepareChallenge(z *acme.Authorization) (*acme.Challenge, func(), error) {
+	name := strings.ToLower(z.Identifier.Value)
+
+	for _, chal := range z.Challenges {
+		switch {
+		case chal.Type == "tls-alpn-01" && !iss.cfg.DisableTLSALPN01:
+			cert, err := iss.client.TLSALPN01ChallengeCert(chal.Token, name)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			iss.mu.Lock()
+			iss.alpn01[name] = &cert
+			iss.mu.Unlock()
+
+			return chal, func() { deleteChallenge(iss, iss.alpn01, name) }, nil
+		case chal.Type == "http-01" && !iss.cfg.DisableHTTP01:
+			keyAuth, err := iss.client.HTTP01ChallengeResponse(chal.Token)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			iss.mu.Lock()
+			iss.http01[chal.Token] = keyAuth
+			iss.mu.Unlock()
+
+			return chal, func() { deleteChallenge(iss, iss.http01, chal.Token) }, nil
+		}
+	}
+
+	return nil, nil, core.Wrapf(core.ErrNotImplemented, "%q: no supported challenge", name)
+}
+
+func deleteChallenge[T any](iss *Issuer, m map[string]T, key string) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	delete(m, key)
+}
+
+func (iss *Issuer) finalize(ctx context.Context, order *acme.Order) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := newCSR(key, iss.cfg.Domains)
+	if err != nil {
+		return nil, err
+	}
+
+	der, _, err := iss.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCertificate(der, key)
+}
+
+func newCSR(key crypto.Signer, domains []string) ([]byte, error) {
+	tmpl := &x509.CertificateRequest{
+		DNSNames: domains,
+	}
+	tmpl.Subject.CommonName = domains[0]
+
+	return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
+
+func newCertificate(der [][]byte, key crypto.Signer) (*tls.Certificate, error) {
+	if len(der) == 0 {
+		return nil, core.Wrap(core.ErrInvalid, "empty certificate chain")
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: der,
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	return cert, nil
+}
+
+func (iss *Issuer) setCertificate(cert *tls.Certificate) {
+	iss.mu.Lock()
+	iss.cert = cert
+	iss.mu.Unlock()
+
+	if err := iss.storeCertificate(cert); err != nil {
+		iss.warn(err).Print("failed to store ACME certificate")
+	}
+
+	if l, ok := iss.info().WithEnabled(); ok {
+		l.WithFields(slog.Fields{
+			"Domains":  iss.cfg.Domains,
+			"NotAfter": cert.Leaf.NotAfter,
+		}).Print("ACME certificate issued")
+	}
+}
@@ -0,0 +1,477 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// testServer is a minimal RFC 8555 stand-in supporting a single
+// account and one type of challenge. JWS signatures aren't verified.
+type testServer struct {
+	mu sync.Mutex
+	t  *testing.T
+
+	URL string
+
+	caKey *ecdsa.PrivateKey
+	ca    *x509.Certificate
+
+	// chal is the type of challenge offered, http-01 by default
+	chal string
+	// validate is called to verify the challenges
+	validate func(name, token string) error
+
+	names []string
+	valid map[string]bool
+	cert  []byte
+}
+
+func newTestServer(t *testing.T, validate func(string, string) error) *testServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, _ := x509.ParseCertificate(der)
+
+	ts := &testServer{
+		t:        t,
+		caKey:    key,
+		ca:       ca,
+		chal:     "http-01",
+		validate: validate,
+		valid:    make(map[string]bool),
+	}
+
+	s := httptest.NewServer(ts)
+	t.Cleanup(s.Close)
+
+	ts.URL = s.URL
+	return ts
+}
+
+func (ts *testServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	rw.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "directory":
+		ts.reply(rw, http.StatusOK, map[string]string{
+			"newNonce":   ts.URL + "/nonce",
+			"newAccount": ts.URL + "/account",
+			"newOrder":   ts.URL + "/order",
+		})
+	case "nonce":
+		rw.WriteHeader(http.StatusOK)
+	case "account":
+		rw.Header().Set("Location", ts.URL+"/account/1")
+		ts.reply(rw, http.StatusCreated, map[string]string{"status": "valid"})
+	case "order":
+		ts.serveOrder(rw, req, len(parts) == 1)
+	case "authz", "chal":
+		ts.serveAuthz(rw, parts[0] == "chal", parts[1])
+	case "finalize":
+		ts.serveFinalize(rw, req)
+	case "cert":
+		rw.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_ = pem.Encode(rw, &pem.Block{Type: "CERTIFICATE", Bytes: ts.cert})
+		_ = pem.Encode(rw, &pem.Block{Type: "CERTIFICATE", Bytes: ts.ca.Raw})
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func (ts *testServer) reply(rw http.ResponseWriter, code int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+func (*testServer) payload(req *http.Request, v any) {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	_ = json.Unmarshal(body, &jws)
+	data, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	_ = json.Unmarshal(data, v)
+}
+
+func (ts *testServer) serveOrder(rw http.ResponseWriter, req *http.Request, isNew bool) {
+	code := http.StatusOK
+	if isNew {
+		var order struct {
+			Identifiers []struct {
+				Value string `json:"value"`
+			} `json:"identifiers"`
+		}
+		ts.payload(req, &order)
+
+		ts.names = nil
+		ts.cert = nil
+		for _, id := range order.Identifiers {
+			ts.names = append(ts.names, id.Value)
+		}
+
+		code = http.StatusCreated
+		rw.Header().Set("Location", ts.URL+"/order/1")
+	}
+
+	status := "ready"
+	authz := make([]string, len(ts.names))
+	for i, name := range ts.names {
+		authz[i] = fmt.Sprintf("%s/authz/%v", ts.URL, i)
+		if !ts.valid[name] {
+			status = "pending"
+		}
+	}
+
+	order := map[string]any{
+		"status":         status,
+		"authorizations": authz,
+		"finalize":       ts.URL + "/finalize/1",
+	}
+	if ts.cert != nil {
+		order["status"] = "valid"
+		order["certificate"] = ts.URL + "/cert/1"
+	}
+
+	ts.reply(rw, code, order)
+}
+
+func (ts *testServer) serveAuthz(rw http.ResponseWriter, accept bool, id string) {
+	var i int
+	_, _ = fmt.Sscan(id, &i)
+	name := ts.names[i]
+	token := fmt.Sprintf("token-%v", i)
+
+	if accept {
+		if err := ts.validate(name, token); err != nil {
+			ts.t.Errorf("ERROR: %q: %v", name, err)
+		} else {
+			ts.valid[name] = true
+		}
+	}
+
+	status := "pending"
+	if ts.valid[name] {
+		status = "valid"
+	}
+
+	chal := map[string]string{
+		"type":   ts.chal,
+		"url":    fmt.Sprintf("%s/chal/%v", ts.URL, i),
+		"token":  token,
+		"status": status,
+	}
+
+	if accept {
+		ts.reply(rw, http.StatusOK, chal)
+		return
+	}
+
+	ts.reply(rw, http.StatusOK, map[string]any{
+		"status":     status,
+		"identifier": map[string]string{"type": "dns", "value": name},
+		"challenges": []any{chal},
+	})
+}
+
+func (ts *testServer) serveFinalize(rw http.ResponseWriter, req *http.Request) {
+	var finalize struct {
+		CSR string `json:"csr"`
+	}
+	ts.payload(req, &finalize)
+
+	der, _ := base64.RawURLEncoding.DecodeString(finalize.CSR)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		ts.reply(rw, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	ts.cert, _ = x509.CreateCertificate(rand.Reader, tmpl, ts.ca, csr.PublicKey, ts.caKey)
+	ts.reply(rw, http.StatusOK, map[string]any{
+		"status":      "valid",
+		"finalize":    ts.URL + "/finalize/1",
+		"certificate": ts.URL + "/cert/1",
+	})
+}
+
+func newTestIssuer(t *testing.T, dir string) (*Issuer, *testServer) {
+	var iss *Issuer
+
+	ts := newTestServer(t, func(_, token string) error {
+		expected, _ := iss.client.HTTP01ChallengeResponse(token)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/.well-known/acme-challenge/"+token, nil)
+		iss.AcmeHTTP01Handler().ServeHTTP(rec, req)
+
+		if got := rec.Body.String(); got != expected {
+			return fmt.Errorf("%q: %q (expected %q)", token, got, expected)
+		}
+		return nil
+	})
+
+	cfg := &Config{
+		DirectoryURL: ts.URL + "/directory",
+		Domains:      []string{"a.example.org", "b.example.org"},
+		Dir:          dir,
+	}
+
+	iss, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+	return iss, ts
+}
+
+func TestIssuer(t *testing.T) {
+	dir := t.TempDir()
+	iss, _ := newTestIssuer(t, dir)
+
+	if !iss.NextRenewal().IsZero() {
+		t.Error("ERROR: NextRenewal: certificate not requested")
+	}
+
+	if _, err := iss.GetCertificate(newTestHello("a.example.org")); err == nil {
+		t.Error("ERROR: GetCertificate: failed to fail")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := iss.Obtain(ctx); err != nil {
+		t.Fatalf("ERROR: Obtain: %v", err)
+	}
+
+	cert, err := iss.GetCertificate(newTestHello("b.example.org"))
+	switch {
+	case err != nil:
+		t.Fatalf("ERROR: GetCertificate: %v", err)
+	case cert.Leaf.VerifyHostname("b.example.org") != nil:
+		t.Errorf("ERROR: GetCertificate: %q", cert.Leaf.DNSNames)
+	case len(cert.Certificate) != 2:
+		t.Errorf("ERROR: GetCertificate: chain of %v", len(cert.Certificate))
+	}
+
+	next := iss.NextRenewal()
+	if !next.After(time.Now()) {
+		t.Errorf("ERROR: NextRenewal: %v", next)
+	}
+
+	// restart
+	iss2, _ := newTestIssuer(t, dir)
+	if next2 := iss2.NextRenewal(); !next2.Equal(next) {
+		t.Errorf("ERROR: NextRenewal: %v (expected %v)", next2, next)
+	}
+
+	if !iss2.client.Key.Public().(*ecdsa.PublicKey).Equal(iss.client.Key.Public()) {
+		t.Error("ERROR: account key not reused")
+	}
+}
+
+func newTestHello(name string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        name,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+	}
+}
+
+// idPeACMEIdentifier is the acmeIdentifier extension of RFC 8737
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// newTestTLSListener completes TLS handshakes using the Issuer
+func newTestTLSListener(t *testing.T, iss *Issuer) string {
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: iss.GetCertificate,
+	}
+	iss.ConfigureTLS(tc)
+
+	lsn, err := tls.Listen("tcp", "127.0.0.1:0", tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lsn.Close() })
+
+	go func() {
+		for {
+			conn, err := lsn.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+
+	return lsn.Addr().String()
+}
+
+func testHandshake(addr string, tc *tls.Config) (tls.ConnectionState, error) {
+	conn, err := tls.Dial("tcp", addr, tc)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	return conn.ConnectionState(), nil
+}
+
+func newTestALPN01Validator(iss **Issuer, addr *string) func(string, string) error {
+	return func(name, token string) error {
+		cs, err := testHandshake(*addr, &tls.Config{
+			ServerName:         name,
+			NextProtos:         []string{acme.ALPNProto},
+			InsecureSkipVerify: true,
+		})
+		switch {
+		case err != nil:
+			return err
+		case cs.NegotiatedProtocol != acme.ALPNProto:
+			return fmt.Errorf("%q: protocol %q", name, cs.NegotiatedProtocol)
+		}
+
+		keyAuth, _ := (*iss).client.HTTP01ChallengeResponse(token)
+		sum := sha256.Sum256([]byte(keyAuth))
+
+		for _, ext := range cs.PeerCertificates[0].Extensions {
+			if ext.Id.Equal(idPeACMEIdentifier) && bytes.HasSuffix(ext.Value, sum[:]) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q: invalid acmeIdentifier", name)
+	}
+}
+
+func TestIssuerTLSALPN01(t *testing.T) {
+	var iss *Issuer
+	var addr string
+
+	ts := newTestServer(t, newTestALPN01Validator(&iss, &addr))
+	ts.chal = "tls-alpn-01"
+
+	cfg := &Config{
+		DirectoryURL: ts.URL + "/directory",
+		Domains:      []string{"a.example.org"},
+		Dir:          t.TempDir(),
+	}
+
+	iss, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+	addr = newTestTLSListener(t, iss)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := iss.Obtain(ctx); err != nil {
+		t.Fatalf("ERROR: Obtain: %v", err)
+	}
+
+	// ordinary clients on the same listener
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.ca)
+
+	for _, protos := range [][]string{{"h2", "http/1.1"}, {"http/1.1"}, nil} {
+		_, err := testHandshake(addr, &tls.Config{
+			ServerName: "a.example.org",
+			RootCAs:    roots,
+			NextProtos: protos,
+		})
+
+		if err != nil {
+			t.Errorf("ERROR: %q: %v", protos, err)
+		} else {
+			t.Logf("%q: success", protos)
+		}
+	}
+}
+
+func TestRenewalTime(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	for _, tc := range []struct {
+		name     string
+		lifetime time.Duration
+		before   time.Duration
+		expected time.Duration
+	}{
+		{"90 days", 90 * day, 30 * day, 60 * day},
+		{"30 days", 30 * day, 30 * day, 20 * day},
+		{"6 days", 6 * day, 30 * day, 4 * day},
+		{"1 hour", time.Hour, 30 * day, 40 * time.Minute},
+	} {
+		leaf := &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(tc.lifetime),
+		}
+
+		got := renewalTime(leaf, tc.before).Sub(now)
+		if got != tc.expected {
+			t.Errorf("ERROR: %s: renewal after %v (expected %v)", tc.name, got, tc.expected)
+		} else {
+			t.Logf("%s: success", tc.name)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package acme
+
+import "darvaza.org/slog"
+
+func (iss *Issuer) info() slog.Logger {
+	return iss.cfg.Logger.Info()
+}
+
+func (iss *Issuer) warn(err error) slog.Logger {
+	l := iss.cfg.Logger.Warn()
+	if err != nil {
+		l = l.WithField(slog.ErrorFieldName, err)
+	}
+	return l
+}
+
+func (iss *Issuer) error(err error) slog.Logger {
+	l := iss.cfg.Logger.Error()
+	if err != nil {
+		l = l.WithField(slog.ErrorFieldName, err)
+	}
+	return l
+}
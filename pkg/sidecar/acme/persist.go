@@ -0,0 +1,143 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/x509utils"
+)
+
+const (
+	// AccountKeyFile is the name of the file holding the
+	// ACME account key
+	AccountKeyFile = "account-key.pem"
+	// CertificateFile is the name of the file holding the
+	// issued certificate chain and its key
+	CertificateFile = "cert.pem"
+)
+
+// loadAccountKey reads the account key from Dir, or
+// generates a new one, storing it if Dir is set
+func (iss *Issuer) loadAccountKey() (crypto.Signer, error) {
+	dir := iss.cfg.Dir
+	if dir != "" {
+		key, err := readKey(filepath.Join(dir, AccountKeyFile))
+		switch {
+		case err == nil:
+			return key, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		err := writeFile(dir, AccountKeyFile, x509utils.EncodePKCS8PrivateKey(key))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+func readKey(filename string) (crypto.Signer, error) {
+	var key crypto.Signer
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = x509utils.ReadPEM(data, func(_ string, block *pem.Block) bool {
+		if pk, _ := x509utils.BlockToPrivateKey(block); pk != nil {
+			key, _ = pk.(crypto.Signer)
+		}
+		return key != nil
+	})
+
+	if key == nil {
+		return nil, core.Wrap(core.ErrInvalid, filename)
+	}
+	return key, nil
+}
+
+// loadCertificate reads the issued certificate from Dir
+func (iss *Issuer) loadCertificate() (*tls.Certificate, error) {
+	if iss.cfg.Dir == "" {
+		return nil, fs.ErrNotExist
+	}
+
+	filename := filepath.Join(iss.cfg.Dir, CertificateFile)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, core.Wrap(err, filename)
+	}
+
+	return &cert, nil
+}
+
+// storeCertificate writes the issued certificate and its key
+// into Dir
+func (iss *Issuer) storeCertificate(cert *tls.Certificate) error {
+	var buf bytes.Buffer
+
+	if iss.cfg.Dir == "" {
+		return nil
+	}
+
+	key, ok := cert.PrivateKey.(x509utils.PrivateKey)
+	if !ok {
+		return core.Wrap(core.ErrInvalid, "unsupported private key")
+	}
+
+	buf.Write(x509utils.EncodePKCS8PrivateKey(key))
+	for _, der := range cert.Certificate {
+		buf.Write(x509utils.EncodeCertificate(der))
+	}
+
+	return writeFile(iss.cfg.Dir, CertificateFile, buf.Bytes())
+}
+
+// writeFile replaces a private file atomically
+func writeFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
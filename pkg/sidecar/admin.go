@@ -0,0 +1,125 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+
+	"darvaza.org/x/net/bind"
+)
+
+// adminServer is the optional plain HTTP listener for
+// orchestrators and operators
+type adminServer struct {
+	mux *http.ServeMux
+	hs  *http.Server
+	ln  *net.TCPListener
+
+	// stopped is set when the listener is no longer served
+	stopped atomic.Bool
+}
+
+// healthy is a [HealthCheck] failing once the admin listener
+// has stopped serving
+func (as *adminServer) healthy(context.Context) error {
+	if as.stopped.Load() {
+		return errors.New("admin listener stopped")
+	}
+	return nil
+}
+
+func (srv *Server) initAdmin() error {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", newHealthHandler("healthz", srv.healthzChecks))
+	mux.Handle("/readyz", newHealthHandler("readyz", srv.readyzChecks))
+	mux.Handle("/livez", newHealthHandler("livez", srv.livezChecks))
+	if srv.metrics != nil {
+		mux.Handle("/metrics", srv.metrics)
+	}
+	mux.Handle("/endpoints", srv.newEndpointsHandler())
+
+	srv.admin = &adminServer{
+		mux: mux,
+		hs: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: srv.cfg.HTTP.ReadHeaderTimeout,
+			ReadTimeout:       srv.cfg.HTTP.ReadTimeout,
+			IdleTimeout:       srv.cfg.HTTP.IdleTimeout,
+		},
+	}
+	return nil
+}
+
+// AdminHandle registers an additional handler on the admin listener.
+func (srv *Server) AdminHandle(pattern string, h http.Handler) {
+	srv.admin.mux.Handle(pattern, h)
+}
+
+// AdminHandler returns the [http.Handler] of the admin listener,
+// for applications serving it on their own.
+func (srv *Server) AdminHandler() http.Handler {
+	return srv.admin.mux
+}
+
+func (srv *Server) listenAdmin(lc bind.TCPUDPListener) error {
+	ac := &srv.cfg.Admin
+	if !ac.Enabled {
+		return nil
+	}
+
+	addr := ac.Address
+	if !addr.IsValid() {
+		addr = netip.IPv6Unspecified()
+	}
+
+	tcpAddr := net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, ac.Port))
+	ln, err := lc.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		return err
+	}
+
+	srv.admin.ln = ln
+	return nil
+}
+
+func (srv *Server) spawnAdmin() {
+	ln := srv.admin.ln
+	if ln == nil {
+		return
+	}
+
+	hs := srv.admin.hs
+	hs.BaseContext = func(net.Listener) context.Context {
+		return srv.eg.Context()
+	}
+
+	srv.AddHealthCheck("admin", srv.admin.healthy)
+	srv.GoWithShutdown(func(context.Context) error {
+		defer srv.admin.stopped.Store(true)
+
+		err := hs.Serve(ln)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return err
+	}, func() error {
+		if srv.cfg.Supervision.GracefulTimeout <= 0 {
+			return hs.Close()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), srv.cfg.Supervision.GracefulTimeout)
+		defer cancel()
+
+		return hs.Shutdown(ctx)
+	})
+}
+
+func (srv *Server) closeAdmin() {
+	if ln := srv.admin.ln; ln != nil {
+		_ = ln.Close()
+		srv.admin.ln = nil
+	}
+}
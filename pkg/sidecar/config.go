@@ -10,6 +10,8 @@ import (
 	"darvaza.org/slog"
 	"darvaza.org/slog/handlers/discard"
 	"darvaza.org/x/config"
+
+	"darvaza.org/sidecar/pkg/sidecar/horizon"
 )
 
 // Config represents the generic server configuration for Darvaza sidecars
@@ -18,12 +20,23 @@ type Config struct {
 	Context context.Context `json:"-" yaml:"-" toml:"-"`
 	Store   storage.Store   `json:"-" yaml:"-" toml:"-"`
 
+	// Policies is the optional registry of the policies referred
+	// by Horizons. If not specified horizon.DefaultRegistry is used.
+	Policies *horizon.Registry `json:"-" yaml:"-" toml:"-"`
+
 	Name string `toml:"name" valid:"host,require"`
 
 	Supervision SupervisionConfig
 	Addresses   BindConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	TLS         TLSConfig  `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
 	HTTP        HTTPConfig
 	DNS         DNSConfig
+	Admin       AdminConfig   `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+	Tracing     TracingConfig `json:",omitempty" yaml:",omitempty" toml:",omitempty"`
+
+	// Horizons describes the optional horizon.Horizons assembled
+	// by [Server.NewHorizons]
+	Horizons []HorizonConfig `yaml:"horizons,omitempty" toml:",omitempty" json:",omitempty"`
 }
 
 // SupervisionConfig represents how graceful upgrades will operate
@@ -41,6 +54,67 @@ type BindConfig struct {
 	KeepAlive time.Duration `yaml:"keep_alive,omitempty" toml:",omitempty" json:",omitempty" default:"10s"`
 }
 
+// TLSConfig contains information for setting up TLS
+type TLSConfig struct {
+	// FallbackCADir is an optional directory where the self-signed CA
+	// used when no Store is provided is kept between restarts.
+	FallbackCADir string `yaml:"fallback_ca_dir,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// ClientCAs is an optional PEM bundle, file or directory with
+	// the CAs used to verify client certificates. If not specified
+	// the Store's CA pool is used.
+	ClientCAs string `yaml:"client_cas,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// AllowedSPIFFEIDs restricts verified client certificates to
+	// those with one of these SPIFFE IDs
+	AllowedSPIFFEIDs []string `yaml:"allowed_spiffe_ids,omitempty" toml:",omitempty" json:",omitempty"`
+	// AllowedTrustDomains restricts verified client certificates to
+	// those with a SPIFFE ID on one of these trust domains
+	AllowedTrustDomains []string `yaml:"allowed_trust_domains,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// MinVersion and MaxVersion restrict the accepted TLS versions,
+	// from "1.0" to "1.3". QUIC always uses TLS 1.3.
+	MinVersion string `yaml:"min_version,omitempty" toml:",omitempty" json:",omitempty"`
+	MaxVersion string `yaml:"max_version,omitempty" toml:",omitempty" json:",omitempty"`
+	// CipherSuites restricts the TLS 1.0-1.2 cipher suites, by name.
+	// TLS 1.3 suites aren't configurable.
+	CipherSuites []string `yaml:"cipher_suites,omitempty" toml:",omitempty" json:",omitempty"`
+	// CurvePreferences are the key exchange curves, by name, in
+	// order of preference
+	CurvePreferences []string `yaml:"curve_preferences,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// SessionTicketsDisabled disables TLS session resumption via tickets
+	SessionTicketsDisabled bool `yaml:"session_tickets_disabled,omitempty" toml:",omitempty" json:",omitempty"`
+	// SessionTicketKeyRotation indicates how often the session ticket
+	// keys are rotated. Keys are handed over on graceful upgrades.
+	SessionTicketKeyRotation time.Duration `yaml:"session_ticket_key_rotation,omitempty" toml:",omitempty" json:",omitempty" default:"24h"`
+
+	Expiry ExpiryConfig `yaml:"expiry,omitempty" toml:",omitempty" json:",omitempty"`
+	OCSP   OCSPConfig   `yaml:"ocsp,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// ExpiryConfig describes how the expiration of the served
+// certificates is monitored
+type ExpiryConfig struct {
+	// Interval indicates how often the certificates are checked
+	Interval time.Duration `yaml:"interval" default:"1h"`
+	// Thresholds are the remaining validity periods that
+	// trigger warnings and renewal-needed callbacks
+	Thresholds []time.Duration `yaml:"thresholds,omitempty" toml:",omitempty" json:",omitempty"`
+	// Names are additional server names to check besides
+	// the sidecar's Name
+	Names []string `yaml:"names,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// OCSPConfig describes how OCSP responses are stapled to
+// the served certificates
+type OCSPConfig struct {
+	// Enabled tells if OCSP responses are fetched and stapled
+	Enabled bool `yaml:"enabled"`
+	// Timeout indicates how long we wait for the OCSP responders
+	Timeout time.Duration `yaml:"timeout" default:"10s"`
+}
+
 // HTTPConfig contains information for setting up the HTTP server
 type HTTPConfig struct {
 	Port              uint16        `yaml:"port"                default:"8443" valid:"port"`
@@ -51,6 +125,39 @@ type HTTPConfig struct {
 	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" default:"2s"`
 	WriteTimeout      time.Duration `yaml:"write_timeout"       default:"1s"`
 	IdleTimeout       time.Duration `yaml:"idle_timeout"        default:"30s"`
+
+	// ClientAuth is the client certificates policy of the HTTPS listeners.
+	// If not specified MutualTLSOnly decides.
+	ClientAuth ClientAuthMode `yaml:"client_auth,omitempty" toml:",omitempty" json:",omitempty"`
+	// QUICClientAuth is the client certificates policy of the QUIC listeners.
+	// If not specified ClientAuth is used.
+	QUICClientAuth ClientAuthMode `yaml:"quic_client_auth,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// EnableDoH mounts a DNS over HTTPS endpoint at /dns-query
+	// answered by the same handler as the DNS server.
+	EnableDoH bool `yaml:"enable_doh,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// ProxyProtocol lists the CIDRs of the load balancers trusted
+	// to send PROXY protocol headers on the TCP listeners
+	ProxyProtocol []netip.Prefix `yaml:"proxy_protocol,omitempty" toml:",omitempty" json:",omitempty"`
+
+	AccessLog AccessLogConfig `yaml:"access_log,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// AccessLogConfig describes how the HTTP requests are logged
+type AccessLogConfig struct {
+	// Enabled logs every request through the Logger
+	Enabled bool `yaml:"enabled"`
+	// File is the optional path of a Common or Combined Log
+	// Format file
+	File string `yaml:"file,omitempty" toml:",omitempty" json:",omitempty"`
+	// Format is "common" or "combined" (default)
+	Format string `yaml:"format,omitempty" toml:",omitempty" json:",omitempty"`
+	// MaxSize is the size, in MiB, that triggers the rotation
+	// of the File. Zero disables rotation.
+	MaxSize int `yaml:"max_size,omitempty" toml:",omitempty" json:",omitempty" default:"100"`
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int `yaml:"max_backups,omitempty" toml:",omitempty" json:",omitempty" default:"5"`
 }
 
 // DNSConfig contains information for setting up the DNS server
@@ -58,10 +165,67 @@ type DNSConfig struct {
 	Enabled       bool          `yaml:"enabled"`
 	Port          uint16        `yaml:"port"                default:"8053" valid:"port"`
 	TLSPort       uint16        `yaml:"tls_port"            default:"8853" valid:"port"`
+	QUICPort      uint16        `yaml:"quic_port"           default:"853"  valid:"port"`
 	MutualTLSOnly bool          `yaml:"mtls_only"`
 	MaxTCPQueries int           `yaml:"max_tcp_queries"`
 	ReadTimeout   time.Duration `yaml:"read_timeout"        default:"1s"`
 	IdleTimeout   time.Duration `yaml:"idle_timeout"        default:"10s"`
+
+	// ClientAuth is the client certificates policy of the DoT listeners.
+	// If not specified MutualTLSOnly decides.
+	ClientAuth ClientAuthMode `yaml:"client_auth,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// EnableDoQ makes us listen DNS over QUIC on the QUICPort (UDP)
+	EnableDoQ bool `yaml:"enable_doq,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// ProxyProtocol lists the CIDRs of the load balancers trusted
+	// to send PROXY protocol headers on the TCP listeners
+	ProxyProtocol []netip.Prefix `yaml:"proxy_protocol,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// LogQueries enables logging every query through the Logger,
+	// including those received via DoH
+	LogQueries bool `yaml:"log_queries,omitempty" toml:",omitempty" json:",omitempty"`
+	// Dnstap describes where dnstap messages are sent, if anywhere.
+	// DoH queries are included.
+	Dnstap DnstapConfig `yaml:"dnstap,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// DnstapConfig describes the optional dnstap output of the
+// DNS server. Socket and File are mutually exclusive.
+type DnstapConfig struct {
+	// Socket is the path of the unix socket of a dnstap collector
+	Socket string `yaml:"socket,omitempty" toml:",omitempty" json:",omitempty"`
+	// File is the path of a file where frames are appended
+	File string `yaml:"file,omitempty" toml:",omitempty" json:",omitempty"`
+	// Identity is the server identity included on every message.
+	// If not specified the Name of the sidecar is used.
+	Identity string `yaml:"identity,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// AdminConfig contains information for setting up the optional
+// plain HTTP listener serving the health, readiness and liveness
+// endpoints
+type AdminConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Address is the IP address of the admin listener. If not
+	// specified it listens on all addresses.
+	Address netip.Addr `yaml:"address,omitempty" toml:",omitempty" json:",omitempty"`
+	Port    uint16     `yaml:"port" default:"8081" valid:"port"`
+}
+
+// TracingConfig describes how the spans of the HTTP and DNS
+// requests are exported via OTLP/HTTP
+type TracingConfig struct {
+	// Endpoint is the URL of the OTLP/HTTP collector, like
+	// http://localhost:4318. Tracing is disabled if empty.
+	Endpoint string `yaml:"endpoint,omitempty" toml:",omitempty" json:",omitempty"`
+	// Headers are added to every export request
+	Headers map[string]string `yaml:"headers,omitempty" toml:",omitempty" json:",omitempty"`
+	// SampleRatio is the ratio, from 0 to 1, of new traces
+	// recorded. Zero means all.
+	SampleRatio float64 `yaml:"sample_ratio,omitempty" toml:",omitempty" json:",omitempty"`
+	// FlushInterval indicates how often spans are exported
+	FlushInterval time.Duration `yaml:"flush_interval" default:"5s"`
 }
 
 // SetDefaults fills the gaps in the Config
@@ -74,6 +238,10 @@ func (cfg *Config) SetDefaults() error {
 		cfg.Context = context.Background()
 	}
 
+	if len(cfg.TLS.Expiry.Thresholds) == 0 {
+		cfg.TLS.Expiry.Thresholds = DefaultExpiryThresholds()
+	}
+
 	return config.Set(cfg)
 }
 
@@ -89,5 +257,16 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("%s: %s", "Context", "can not be nil")
 	}
 
+	for _, fn := range []func() error{
+		cfg.validateClientAuth,
+		cfg.TLS.validateSPIFFE,
+		cfg.TLS.validatePolicy,
+		cfg.validateHorizons,
+	} {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
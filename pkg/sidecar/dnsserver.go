@@ -23,22 +23,24 @@ func (srv *Server) newDNSServerConfig() (*dns.Config, bool) {
 		return nil, false
 	}
 
-	mTLS := srv.cfg.DNS.MutualTLSOnly
-
 	dsc := &dns.Config{
 		Logger:  srv.cfg.Logger,
 		Context: srv.cfg.Context,
 
 		// TLS
-		TLSConfig: srv.newTLSServerConfig(mTLS),
+		TLSConfig: srv.newTLSServerConfig(dc.DoTClientAuth()),
 
 		// Address
 		Bind: dns.BindingConfig{
 			Addrs: srv.cfg.Addresses.Addresses,
 
 			// Ports
-			Port:    dc.Port,
-			TLSPort: dc.TLSPort,
+			Port:     dc.Port,
+			TLSPort:  dc.TLSPort,
+			QUICPort: dc.QUICPort,
+
+			EnableQUIC:    dc.EnableDoQ,
+			ProxyProtocol: dc.ProxyProtocol,
 		},
 
 		// DNS
@@ -46,6 +48,10 @@ func (srv *Server) newDNSServerConfig() (*dns.Config, bool) {
 		ReadTimeout:   dc.ReadTimeout,
 		IdleTimeout:   dc.IdleTimeout,
 
+		LogQueries: dc.LogQueries,
+		Dnstap:     srv.dnstap,
+
+		Metrics:         srv.metrics,
 		GracefulTimeout: srv.cfg.Supervision.GracefulTimeout,
 	}
 
@@ -10,6 +10,9 @@ import (
 	"darvaza.org/slog"
 	"darvaza.org/slog/handlers/discard"
 	"darvaza.org/x/config"
+
+	"darvaza.org/sidecar/pkg/sidecar/dnstap"
+	"darvaza.org/sidecar/pkg/sidecar/metrics"
 )
 
 // Config describes how the [Server] will be assembled
@@ -26,6 +29,16 @@ type Config struct {
 	ReadTimeout   time.Duration
 	IdleTimeout   time.Duration
 
+	// Metrics is an optional [metrics.Metrics] measuring
+	// queries and connections.
+	Metrics *metrics.Metrics
+
+	// LogQueries enables logging every query through the Logger
+	LogQueries bool
+	// Dnstap is an optional [dnstap.Output] receiving
+	// every query and response
+	Dnstap *dnstap.Output
+
 	GracefulTimeout time.Duration
 }
 
@@ -53,6 +66,10 @@ func (sc *Config) New(eg *core.ErrGroup) (*Server, error) {
 		return nil, err
 	}
 
+	if err := sc.Bind.Validate(); err != nil {
+		return nil, err
+	}
+
 	if eg == nil {
 		eg = &core.ErrGroup{
 			Parent: sc.Context,
@@ -69,10 +86,46 @@ func (sc *Config) New(eg *core.ErrGroup) (*Server, error) {
 
 // BindingConfig describes what the [Server] will listen.
 type BindingConfig struct {
-	Addrs   []netip.Addr
-	Port    uint16
-	TLSPort uint16
+	Addrs    []netip.Addr
+	Port     uint16
+	TLSPort  uint16
+	QUICPort uint16
+
+	// EnableQUIC makes us listen DNS over QUIC
+	// if TLS is available
+	EnableQUIC bool
+
+	// ProxyProtocol lists the trusted sources, like L4 load
+	// balancers, allowed to send PROXY protocol headers on
+	// the TCP listeners.
+	ProxyProtocol []netip.Prefix
 
 	PortStrict   bool
 	PortAttempts int
 }
+
+// Validate checks the ports don't collide once the defaults
+// are applied.
+func (bc *BindingConfig) Validate() error {
+	port := portOrDefault(bc.Port, DefaultInsecurePort)
+	tlsPort := portOrDefault(bc.TLSPort, DefaultSecurePort)
+	quicPort := portOrDefault(bc.QUICPort, DefaultQUICPort)
+
+	switch {
+	case port == tlsPort:
+		// TCP
+		return core.Wrapf(core.ErrInvalid, "Port and TLSPort are both %v", port)
+	case bc.EnableQUIC && port == quicPort:
+		// UDP
+		return core.Wrapf(core.ErrInvalid, "Port and QUICPort are both %v", port)
+	default:
+		return nil
+	}
+}
+
+func portOrDefault(port, def uint16) uint16 {
+	if port == 0 {
+		return def
+	}
+	return port
+}
@@ -0,0 +1,147 @@
+package dnsserver
+
+import (
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+
+	"darvaza.org/sidecar/pkg/sidecar/dnstap"
+)
+
+// QueryLog logs DNS queries and emits them via dnstap,
+// regardless of the transport they arrived through.
+type QueryLog struct {
+	// Logger receives the queries if LogQueries is enabled
+	Logger     slog.Logger
+	LogQueries bool
+	// Dnstap is an optional [dnstap.Output] receiving
+	// every query and response
+	Dnstap *dnstap.Output
+}
+
+// NewQueryLogHandler wraps a [dns.Handler] to log every query
+// through the [Config.Logger] if LogQueries is enabled, and
+// emit them via [Config.Dnstap] if set.
+func (ds *Server) NewQueryLogHandler(proto string, next dns.Handler) dns.Handler {
+	ql := &QueryLog{
+		Logger:     ds.cfg.Logger,
+		LogQueries: ds.cfg.LogQueries,
+		Dnstap:     ds.cfg.Dnstap,
+	}
+	return ql.Handler(proto, next)
+}
+
+// Handler wraps a [dns.Handler] to log and emit every query
+// of the given protocol. The [QueryLog] can be nil.
+func (ql *QueryLog) Handler(proto string, next dns.Handler) dns.Handler {
+	if ql == nil || (!ql.LogQueries && ql.Dnstap == nil) {
+		return next
+	}
+
+	return dns.HandlerFunc(func(rw dns.ResponseWriter, req *dns.Msg) {
+		rec := &queryRecorder{ResponseWriter: rw, start: time.Now()}
+		ql.emitDnstap(proto, rw, dnstap.ClientQuery, rec.start, req, nil)
+
+		next.ServeDNS(rec, req)
+
+		ql.logQuery(proto, rw, req, rec)
+		if rec.rsp != nil {
+			ql.emitDnstap(proto, rw, dnstap.ClientResponse, rec.start, req, rec.rsp)
+		}
+	})
+}
+
+func (ql *QueryLog) logQuery(proto string, rw dns.ResponseWriter, req *dns.Msg, rec *queryRecorder) {
+	if !ql.LogQueries || ql.Logger == nil {
+		return
+	}
+
+	l, ok := ql.Logger.Info().WithEnabled()
+	if !ok {
+		return
+	}
+
+	fields := slog.Fields{
+		"Proto":      proto,
+		"RemoteAddr": rw.RemoteAddr().String(),
+		"Duration":   time.Since(rec.start),
+	}
+
+	if len(req.Question) > 0 {
+		q := req.Question[0]
+		fields["QName"] = q.Name
+		fields["QType"] = dns.TypeToString[q.Qtype]
+	}
+
+	if rsp := rec.rsp; rsp != nil {
+		fields["Rcode"] = dns.RcodeToString[rsp.Rcode]
+		fields["Answers"] = len(rsp.Answer)
+	}
+
+	l.WithFields(fields).Print("query")
+}
+
+func (ql *QueryLog) emitDnstap(proto string, rw dns.ResponseWriter, typ dnstap.MessageType,
+	start time.Time, req, rsp *dns.Msg) {
+	//
+	out := ql.Dnstap
+	if out == nil {
+		return
+	}
+
+	sp, _ := dnstap.ParseProtocol(proto)
+	m := &dnstap.Message{
+		Type:         typ,
+		Protocol:     sp,
+		QueryAddr:    addrPort(rw.RemoteAddr()),
+		ResponseAddr: addrPort(rw.LocalAddr()),
+		QueryTime:    start,
+	}
+
+	m.QueryMessage, _ = req.Pack()
+	if rsp != nil {
+		m.ResponseTime = time.Now()
+		m.ResponseMessage, _ = rsp.Pack()
+	}
+
+	out.Emit(m)
+}
+
+func addrPort(addr net.Addr) netip.AddrPort {
+	ap, _ := core.AddrPort(addr)
+	return ap
+}
+
+// queryRecorder is a [dns.ResponseWriter] remembering the response
+type queryRecorder struct {
+	dns.ResponseWriter
+
+	start time.Time
+	rsp   *dns.Msg
+}
+
+func (rec *queryRecorder) WriteMsg(msg *dns.Msg) error {
+	if rec.rsp == nil {
+		rec.rsp = msg
+	}
+	return rec.ResponseWriter.WriteMsg(msg)
+}
+
+// Unwrap returns the original [dns.ResponseWriter]
+func (rec *queryRecorder) Unwrap() dns.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// ConnectionState implements the [dns.ConnectionStater] interface
+func (rec *queryRecorder) ConnectionState() *tls.ConnectionState {
+	if cs, ok := rec.ResponseWriter.(dns.ConnectionStater); ok {
+		return cs.ConnectionState()
+	}
+	return nil
+}
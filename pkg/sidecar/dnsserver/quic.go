@@ -0,0 +1,364 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+
+	"darvaza.org/core"
+)
+
+const (
+	// DefaultQUICPort is the UDP port used by default
+	// to serve DNS over QUIC (a.k.a. DoQ)
+	DefaultQUICPort = 853
+
+	// DoQNextProto is the ALPN protocol of DNS over QUIC
+	DoQNextProto = "doq"
+)
+
+// DoQ error codes, RFC 9250 section 4.3, used both
+// on streams and connections
+const (
+	doqNoError       = 0x0
+	doqInternalError = 0x1
+	doqProtocolError = 0x2
+)
+
+var (
+	_ dns.ResponseWriter   = (*quicResponseWriter)(nil)
+	_ dns.ConnectionStater = (*quicResponseWriter)(nil)
+)
+
+// HasQUIC tells if the [Server] will handle DoQ requests.
+func (srv *Server) HasQUIC() bool {
+	return srv.HasSecure() && srv.cfg.Bind.EnableQUIC
+}
+
+// NewQUICTLSConfig returns the [tls.Config] used on the DoQ
+// listeners, derived from [Config.TLSConfig] but negotiating
+// the "doq" protocol over TLS 1.3, regardless of the versions
+// allowed on DoT.
+func (srv *Server) NewQUICTLSConfig() *tls.Config {
+	tc := srv.cfg.TLSConfig.Clone()
+	setQUICTLSConfig(tc)
+
+	if fn := tc.GetConfigForClient; fn != nil {
+		tc.GetConfigForClient = func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := fn(chi)
+			if c == nil || err != nil {
+				return c, err
+			}
+
+			c = c.Clone()
+			setQUICTLSConfig(c)
+			return c, nil
+		}
+	}
+
+	return tc
+}
+
+// setQUICTLSConfig adjusts a [tls.Config] for DoQ. QUIC requires
+// TLS 1.3, so MaxVersion is dropped as it could prevent it.
+func setQUICTLSConfig(tc *tls.Config) {
+	tc.NextProtos = []string{DoQNextProto}
+	tc.MinVersion = tls.VersionTLS13
+	tc.MaxVersion = 0
+}
+
+// asQUICListeners converts a slice of UDP Listeners into QUIC Listeners.
+func (srv *Server) asQUICListeners(listeners []*net.UDPConn) ([]*quic.Listener, error) {
+	var out []*quic.Listener
+
+	if l := len(listeners); l > 0 {
+		tlsConf := srv.NewQUICTLSConfig()
+		cfg := &quic.Config{
+			MaxIdleTimeout: srv.cfg.IdleTimeout,
+		}
+
+		out = make([]*quic.Listener, 0, l)
+		for _, udp := range listeners {
+			lsn, err := quic.Listen(udp, tlsConf, cfg)
+			if err != nil {
+				closeAll(out)
+				return nil, err
+			}
+			out = append(out, lsn)
+		}
+	}
+
+	return out, nil
+}
+
+// quicServer serves DNS over QUIC on a [quic.Listener]
+type quicServer struct {
+	ds  *Server
+	lsn *quic.Listener
+	h   dns.Handler
+
+	mu      sync.Mutex
+	conns   map[quic.Connection]struct{}
+	wg      sync.WaitGroup
+	closing bool
+}
+
+func (ds *Server) newQUICServer(lsn *quic.Listener, h dns.Handler) *quicServer {
+	return &quicServer{
+		ds:    ds,
+		lsn:   lsn,
+		h:     ds.wrapHandler("doq", h),
+		conns: make(map[quic.Connection]struct{}),
+	}
+}
+
+func (ds *Server) spawnQUIC(s *quicServer, graceful time.Duration) {
+	addr, ok := core.AddrPort(s.lsn.Addr())
+	if !ok {
+		core.Panic("unreachable")
+	}
+
+	ds.drained.Add(1)
+	ds.eg.Go(func(_ context.Context) error {
+		defer ds.stopped.Add(1)
+
+		ds.logListening("doq", addr)
+		return s.Serve()
+	}, func() error {
+		defer ds.drained.Done()
+		ds.logShuttingDown("doq", addr)
+		return s.Shutdown(graceful)
+	})
+}
+
+// Serve accepts connections until the listener is closed
+func (s *quicServer) Serve() error {
+	for {
+		conn, err := s.lsn.Accept(context.Background())
+		switch {
+		case errors.Is(err, quic.ErrServerClosed):
+			return nil
+		case err != nil:
+			return err
+		case !s.add(conn):
+			// shutting down
+			_ = conn.CloseWithError(doqNoError, "")
+		default:
+			go s.serveConn(conn)
+		}
+	}
+}
+
+// Shutdown stops accepting connections, waits up to the given
+// duration for the active queries to finish, and closes
+// every connection.
+func (s *quicServer) Shutdown(graceful time.Duration) error {
+	err := s.lsn.Close()
+
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+
+	if graceful > 0 {
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(graceful):
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.CloseWithError(doqNoError, "")
+	}
+	s.conns = nil
+	return err
+}
+
+func (s *quicServer) add(conn quic.Connection) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns == nil {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.ds.cfg.Metrics.ConnOpened("doq")
+	return true
+}
+
+func (s *quicServer) remove(conn quic.Connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns != nil {
+		delete(s.conns, conn)
+	}
+	s.ds.cfg.Metrics.ConnClosed("doq")
+}
+
+// addStream accounts for a new query unless we are
+// shutting down
+func (s *quicServer) addStream() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+
+	s.wg.Add(1)
+	return true
+}
+
+func (s *quicServer) serveConn(conn quic.Connection) {
+	defer s.remove(conn)
+
+	for {
+		stream, err := conn.AcceptStream(conn.Context())
+		if err != nil {
+			// connection closed
+			return
+		}
+
+		if !s.addStream() {
+			// shutting down
+			stream.CancelRead(doqNoError)
+			stream.CancelWrite(doqNoError)
+			continue
+		}
+
+		go func() {
+			defer s.wg.Done()
+			s.serveStream(conn, stream)
+		}()
+	}
+}
+
+// serveStream handles a single query, RFC 9250 section 4.2
+func (s *quicServer) serveStream(conn quic.Connection, stream quic.Stream) {
+	if t := s.ds.cfg.ReadTimeout; t > 0 {
+		_ = stream.SetReadDeadline(time.Now().Add(t))
+	}
+
+	req, err := readQUICQuery(stream)
+	switch {
+	case err != nil:
+		stream.CancelRead(doqProtocolError)
+		stream.CancelWrite(doqProtocolError)
+		return
+	case req.Id != 0:
+		// Message ID MUST be zero
+		_ = conn.CloseWithError(doqProtocolError, "non-zero message id")
+		return
+	}
+
+	w := &quicResponseWriter{conn: conn, stream: stream}
+	s.h.ServeDNS(w, req)
+
+	if !w.written {
+		// no answer
+		stream.CancelWrite(doqInternalError)
+		return
+	}
+	_ = stream.Close()
+}
+
+func readQUICQuery(r io.Reader) (*dns.Msg, error) {
+	var hdr [2]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(b); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// quicResponseWriter is a [dns.ResponseWriter] writing the response
+// of a DoQ query on its stream
+type quicResponseWriter struct {
+	conn   quic.Connection
+	stream quic.Stream
+
+	written bool
+}
+
+// LocalAddr returns the address of the server
+func (w *quicResponseWriter) LocalAddr() net.Addr { return w.conn.LocalAddr() }
+
+// RemoteAddr returns the address of the client
+func (w *quicResponseWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+
+// ConnectionState implements the [dns.ConnectionStater] interface
+func (w *quicResponseWriter) ConnectionState() *tls.ConnectionState {
+	cs := w.conn.ConnectionState().TLS
+	return &cs
+}
+
+// WriteMsg packs and writes the response
+func (w *quicResponseWriter) WriteMsg(msg *dns.Msg) error {
+	b, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Write writes a packed response prefixed by its length
+func (w *quicResponseWriter) Write(b []byte) (int, error) {
+	if w.written {
+		return 0, core.Wrap(core.ErrInvalid, "response already written")
+	}
+
+	if len(b) > dns.MaxMsgSize {
+		return 0, core.Wrap(core.ErrInvalid, "response too large")
+	}
+
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, len(b)+2), uint16(len(b)))
+	buf = append(buf, b...)
+
+	w.written = true
+	if _, err := w.stream.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the stream
+func (w *quicResponseWriter) Close() error { return w.stream.Close() }
+
+// TsigStatus returns nil as TSIG isn't supported over DoQ
+func (*quicResponseWriter) TsigStatus() error { return nil }
+
+// TsigTimersOnly does nothing
+func (*quicResponseWriter) TsigTimersOnly(bool) {}
+
+// Hijack does nothing
+func (*quicResponseWriter) Hijack() {}
@@ -0,0 +1,179 @@
+package dnsserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ERROR: GenerateKey: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("ERROR: CreateCertificate: %v", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func newTestQUICServer(t *testing.T, tc *tls.Config) *quicServer {
+	ds, err := (&Config{TLSConfig: tc}).New(nil)
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ERROR: ListenUDP: %v", err)
+	}
+
+	listeners, err := ds.asQUICListeners([]*net.UDPConn{udp})
+	if err != nil {
+		t.Fatalf("ERROR: asQUICListeners: %v", err)
+	}
+
+	h := dns.HandlerFunc(func(rw dns.ResponseWriter, req *dns.Msg) {
+		rsp := new(dns.Msg)
+		rsp.SetReply(req)
+		rsp.Answer = append(rsp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+			Txt: []string{"hello"},
+		})
+		_ = rw.WriteMsg(rsp)
+	})
+
+	return ds.newQUICServer(listeners[0], h)
+}
+
+func testQUICExchange(ctx context.Context, conn quic.Connection, req *dns.Msg) (*dns.Msg, error) {
+	b, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := binary.BigEndian.AppendUint16(nil, uint16(len(b)))
+	if _, err = stream.Write(append(buf, b...)); err != nil {
+		return nil, err
+	}
+	_ = stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return readQUICQuery(bytes.NewReader(data))
+}
+
+func TestQUICServer(t *testing.T) {
+	s := newTestQUICServer(t, newTestTLSConfig(t))
+
+	done := make(chan error, 1)
+	go func() { done <- s.Serve() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, s.lsn.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{DoQNextProto},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ERROR: DialAddr: %v", err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeTXT)
+	req.Id = 0
+
+	rsp, err := testQUICExchange(ctx, conn, req)
+	switch {
+	case err != nil:
+		t.Errorf("ERROR: exchange: %v", err)
+	case len(rsp.Answer) != 1:
+		t.Errorf("ERROR: unexpected response: %v", rsp)
+	default:
+		t.Log("exchange: success")
+	}
+
+	// Message ID MUST be zero
+	req.Id = 1234
+	if _, err := testQUICExchange(ctx, conn, req); err == nil {
+		t.Errorf("ERROR: non-zero id: failed to fail")
+	} else {
+		t.Logf("non-zero id: failed successfully: %v", err)
+	}
+
+	if err := s.Shutdown(time.Second); err != nil {
+		t.Errorf("ERROR: Shutdown: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("ERROR: Serve: %v", err)
+	}
+}
+
+func TestQUICServerMaxVersion(t *testing.T) {
+	// DoT limited to TLS 1.2, directly and via GetConfigForClient
+	tc := newTestTLSConfig(t)
+	tc.MaxVersion = tls.VersionTLS12
+	tc.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return tc.Clone(), nil
+	}
+
+	s := newTestQUICServer(t, tc)
+	go func() { _ = s.Serve() }()
+	defer func() { _ = s.Shutdown(time.Second) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, s.lsn.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{DoQNextProto},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ERROR: DialAddr: %v", err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeTXT)
+	req.Id = 0
+
+	if _, err := testQUICExchange(ctx, conn, req); err != nil {
+		t.Errorf("ERROR: exchange: %v", err)
+	} else {
+		t.Log("exchange: success")
+	}
+}
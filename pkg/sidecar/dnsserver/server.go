@@ -3,8 +3,11 @@ package dnsserver
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/netip"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -21,6 +24,21 @@ type Server struct {
 	eg  *core.ErrGroup
 	sl  *Listeners
 	dns []*dns.Server
+	doq []*quicServer
+
+	// drained counts the servers yet to shut down
+	drained sync.WaitGroup
+	// stopped counts the servers no longer serving
+	stopped atomic.Int32
+}
+
+// Healthy is a health check failing once any of the
+// spawned DNS servers has stopped serving.
+func (ds *Server) Healthy(context.Context) error {
+	if n := ds.stopped.Load(); n > 0 {
+		return fmt.Errorf("%v DNS servers stopped", n)
+	}
+	return nil
 }
 
 func (ds *Server) setupServer(s *dns.Server) *dns.Server {
@@ -37,12 +55,27 @@ func (ds *Server) setupServer(s *dns.Server) *dns.Server {
 	s.ReadTimeout = ds.cfg.ReadTimeout
 	s.MaxTCPQueries = ds.cfg.MaxTCPQueries
 
+	s.Handler = ds.wrapHandler(s.Net, s.Handler)
+	if s.Listener != nil {
+		s.Listener = ds.cfg.Metrics.Listener(s.Net, s.Listener)
+	}
+
 	return s
 }
 
+// wrapHandler adds logging and measuring to the [dns.Handler]
+// of the given protocol.
+func (ds *Server) wrapHandler(proto string, h dns.Handler) dns.Handler {
+	// Log
+	h = ds.NewQueryLogHandler(proto, h)
+
+	// Measure
+	return ds.cfg.Metrics.DNSHandler(proto, h)
+}
+
 func (ds *Server) prepare(h dns.Handler) error {
 	switch {
-	case len(ds.dns) > 0:
+	case len(ds.dns) > 0, len(ds.doq) > 0:
 		// already running
 		return core.Wrap(syscall.EBUSY, "server already running")
 	case ds.sl == nil:
@@ -58,7 +91,7 @@ func (ds *Server) prepare(h dns.Handler) error {
 	// 53/TCP
 	for _, lsn := range ds.sl.TCP {
 		s := ds.setupServer(&dns.Server{
-			Listener: lsn,
+			Listener: ds.withProxyProtocol(lsn),
 			Handler:  h,
 		})
 		ds.dns = append(ds.dns, s)
@@ -83,6 +116,11 @@ func (ds *Server) prepare(h dns.Handler) error {
 		ds.dns = append(ds.dns, s)
 	}
 
+	// 853/UDP (QUIC)
+	for _, lsn := range ds.sl.QUIC {
+		ds.doq = append(ds.doq, ds.newQUICServer(lsn, h))
+	}
+
 	return nil
 }
 
@@ -97,6 +135,10 @@ func (ds *Server) Spawn(h dns.Handler, wait time.Duration) error {
 		ds.spawnServer(s, ds.cfg.GracefulTimeout)
 	}
 
+	for _, s := range ds.doq {
+		ds.spawnQUIC(s, ds.cfg.GracefulTimeout)
+	}
+
 	if wait > 0 {
 		select {
 		case <-time.After(wait):
@@ -113,10 +155,14 @@ func (ds *Server) Spawn(h dns.Handler, wait time.Duration) error {
 func (ds *Server) spawnServer(s *dns.Server, graceful time.Duration) {
 	proto, addr := getServerProtoAddr(s)
 
+	ds.drained.Add(1)
 	ds.eg.Go(func(_ context.Context) error {
+		defer ds.stopped.Add(1)
+
 		ds.logListening(proto, addr)
 		return s.ActivateAndServe()
 	}, func() error {
+		defer ds.drained.Done()
 		ds.logShuttingDown(proto, addr)
 
 		if graceful > 0 {
@@ -169,6 +215,12 @@ func (ds *Server) Cancel(cause error) {
 	ds.eg.Cancel(cause)
 }
 
+// WaitShutdown blocks until the spawned servers have shut
+// down, after the cancellation of the [core.ErrGroup].
+func (ds *Server) WaitShutdown() {
+	ds.drained.Wait()
+}
+
 // Wait waits until all workers have finished.
 func (ds *Server) Wait() error {
 	return ds.eg.Wait()
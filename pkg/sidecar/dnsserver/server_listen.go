@@ -3,9 +3,15 @@ package dnsserver
 import (
 	"io"
 	"net"
+	"net/netip"
 	"syscall"
 
+	"github.com/quic-go/quic-go"
+
+	"darvaza.org/core"
 	"darvaza.org/x/net/bind"
+
+	"darvaza.org/sidecar/pkg/sidecar/proxyproto"
 )
 
 const (
@@ -20,9 +26,10 @@ const (
 
 // Listeners contains the listeners to be used by this DNS server.
 type Listeners struct {
-	UDP []*net.UDPConn
-	TCP []*net.TCPListener
-	TLS []net.Listener
+	UDP  []*net.UDPConn
+	TCP  []*net.TCPListener
+	TLS  []net.Listener
+	QUIC []*quic.Listener
 }
 
 // Close closes all listeners.
@@ -30,9 +37,54 @@ func (sl *Listeners) Close() error {
 	closeAll(sl.UDP)
 	closeAll(sl.TCP)
 	closeAll(sl.TLS)
+	closeAll(sl.QUIC)
 	return nil
 }
 
+// Addresses returns the addresses bound by the [Listeners]
+// grouped by protocol, "udp", "tcp", "tcp+tls" and "doq".
+func (sl *Listeners) Addresses() map[string][]netip.AddrPort {
+	out := make(map[string][]netip.AddrPort)
+
+	for _, l := range sl.UDP {
+		appendAddr(out, "udp", l.LocalAddr())
+	}
+	for _, l := range sl.TCP {
+		appendAddr(out, "tcp", l.Addr())
+	}
+	for _, l := range sl.TLS {
+		appendAddr(out, "tcp+tls", l.Addr())
+	}
+	for _, l := range sl.QUIC {
+		appendAddr(out, "doq", l.Addr())
+	}
+
+	return out
+}
+
+func appendAddr(out map[string][]netip.AddrPort, proto string, addr net.Addr) {
+	if ap, ok := core.AddrPort(addr); ok {
+		out[proto] = append(out[proto], ap)
+	}
+}
+
+// Addresses returns the addresses the [Server] is listening
+// grouped by protocol, or nil if it isn't listening.
+// Ports may differ from the [BindingConfig] when PortStrict
+// isn't set.
+func (srv *Server) Addresses() map[string][]netip.AddrPort {
+	if srv.sl == nil {
+		return nil
+	}
+	return srv.sl.Addresses()
+}
+
+// withProxyProtocol wraps a TCP listener to read PROXY protocol
+// headers sent by trusted sources, if any.
+func (srv *Server) withProxyProtocol(lsn net.Listener) net.Listener {
+	return proxyproto.NewListener(lsn, srv.cfg.Bind.ProxyProtocol)
+}
+
 func closeAll[T io.Closer](s []T) {
 	for _, l := range s {
 		_ = l.Close()
@@ -74,7 +126,7 @@ func (srv *Server) newListeners(cfg *BindingConfig, bc *bind.Config) (*Listeners
 
 	// TCP/UDP
 	bc.Port = cfg.Port
-	bc.Port = DefaultInsecurePort
+	bc.DefaultPort = DefaultInsecurePort
 
 	tcp, udp, err := bc.Bind()
 	if err != nil {
@@ -99,5 +151,32 @@ func (srv *Server) newListeners(cfg *BindingConfig, bc *bind.Config) (*Listeners
 		sl.TLS = srv.asSecureListeners(tcp)
 	}
 
+	// DNS over QUIC
+	if srv.HasQUIC() {
+		if err := srv.bindQUIC(sl, cfg, bc); err != nil {
+			defer sl.Close()
+			return nil, err
+		}
+	}
+
 	return sl, nil
 }
+
+func (srv *Server) bindQUIC(sl *Listeners, cfg *BindingConfig, bc *bind.Config) error {
+	bc.Port = cfg.QUICPort
+	bc.DefaultPort = DefaultQUICPort
+	bc.OnlyTCP = false
+	bc.OnlyUDP = true
+
+	_, udp, err := bc.Bind()
+	if err != nil {
+		return err
+	}
+
+	sl.QUIC, err = srv.asQUICListeners(udp)
+	if err != nil {
+		closeAll(udp)
+		return err
+	}
+	return nil
+}
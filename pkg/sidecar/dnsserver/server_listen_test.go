@@ -0,0 +1,94 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"darvaza.org/x/net/bind"
+)
+
+type testBindingValidateCase struct {
+	name string
+	bc   BindingConfig
+	ok   bool
+}
+
+func TestBindingConfigValidate(t *testing.T) {
+	var cases = []testBindingValidateCase{
+		{"defaults", BindingConfig{}, true},
+		{"defaults with QUIC", BindingConfig{EnableQUIC: true}, true},
+		{"Port=TLSPort", BindingConfig{Port: 853}, false},
+		{"Port=QUICPort", BindingConfig{Port: 8053, QUICPort: 8053, EnableQUIC: true}, false},
+		{"Port=QUICPort without QUIC", BindingConfig{Port: 8053, QUICPort: 8053}, true},
+		{"TLSPort=QUICPort", BindingConfig{TLSPort: 8853, QUICPort: 8853, EnableQUIC: true}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.bc.Validate()
+		switch {
+		case err == nil && !tc.ok:
+			t.Errorf("ERROR: %s: failed to fail", tc.name)
+		case err != nil && tc.ok:
+			t.Errorf("ERROR: %s: %v", tc.name, err)
+		default:
+			t.Logf("%s: success", tc.name)
+		}
+	}
+}
+
+// freePort finds a port available on both TCP and UDP
+func freePort(t *testing.T) uint16 {
+	for i := 0; i < 10; i++ {
+		tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ERROR: ListenTCP: %v", err)
+		}
+
+		ap := tcp.Addr().(*net.TCPAddr).AddrPort()
+		udp, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(ap))
+
+		_ = tcp.Close()
+		if err == nil {
+			_ = udp.Close()
+			return ap.Port()
+		}
+	}
+
+	t.Fatal("ERROR: no port available")
+	return 0
+}
+
+func TestListenAddresses(t *testing.T) {
+	port := freePort(t)
+
+	ds, err := (&Config{
+		Bind: BindingConfig{
+			Addrs: []netip.Addr{netip.MustParseAddr("127.0.0.1")},
+			Port:  port,
+		},
+	}).New(nil)
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	if addrs := ds.Addresses(); addrs != nil {
+		t.Errorf("ERROR: not listening: %v", addrs)
+	}
+
+	if err := ds.ListenWithListener(bind.NewListenConfig(context.Background(), 0)); err != nil {
+		t.Fatalf("ERROR: Listen: %v", err)
+	}
+	defer ds.sl.Close()
+
+	addrs := ds.Addresses()
+	for _, proto := range []string{"udp", "tcp"} {
+		s := addrs[proto]
+		if len(s) != 1 || s[0].Port() != port {
+			t.Errorf("ERROR: %s: %v (expected port %v)", proto, s, port)
+		} else {
+			t.Logf("%s: %v: success", proto, s[0])
+		}
+	}
+}
@@ -19,7 +19,7 @@ func (srv *Server) asSecureListeners(listeners []*net.TCPListener) []net.Listene
 
 		out = make([]net.Listener, l)
 		for i, tcp := range listeners {
-			out[i] = tls.NewListener(tcp, tlsConf)
+			out[i] = tls.NewListener(srv.withProxyProtocol(tcp), tlsConf)
 		}
 	}
 	return out
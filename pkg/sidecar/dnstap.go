@@ -0,0 +1,51 @@
+package sidecar
+
+import (
+	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/dnsserver"
+	"darvaza.org/sidecar/pkg/sidecar/dnstap"
+)
+
+func (srv *Server) initDnstap() error {
+	dc := &srv.cfg.DNS
+	switch {
+	case !dc.Enabled && !srv.cfg.HTTP.EnableDoH:
+		// no DNS queries
+		return nil
+	case dc.Dnstap.Socket == "" && dc.Dnstap.File == "":
+		// disabled
+		return nil
+	}
+
+	identity := dc.Dnstap.Identity
+	if identity == "" {
+		identity = srv.cfg.Name
+	}
+
+	cfg := &dnstap.Config{
+		Logger:   srv.cfg.Logger,
+		Socket:   dc.Dnstap.Socket,
+		File:     dc.Dnstap.File,
+		Identity: identity,
+		Version:  "sidecar",
+	}
+
+	out, err := cfg.New()
+	if err != nil {
+		return core.Wrap(err, "DNS.Dnstap")
+	}
+
+	srv.dnstap = out
+	return nil
+}
+
+// newDNSQueryLog returns the [dnsserver.QueryLog] of the DoH
+// queries, configured as the one of the DNS server.
+func (srv *Server) newDNSQueryLog() *dnsserver.QueryLog {
+	return &dnsserver.QueryLog{
+		Logger:     srv.cfg.Logger,
+		LogQueries: srv.cfg.DNS.LogQueries,
+		Dnstap:     srv.dnstap,
+	}
+}
@@ -0,0 +1,174 @@
+// Package dnstap emits dnstap messages describing the DNS
+// traffic of sidecars using Frame Streams over a unix socket
+// or into a file.
+package dnstap
+
+import (
+	"net/netip"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentType is the Frame Streams content type of dnstap
+const ContentType = "protobuf:dnstap.Dnstap"
+
+// MessageType is the dnstap Message.Type
+type MessageType int
+
+const (
+	// ClientQuery is a query received by the server
+	ClientQuery MessageType = 5
+	// ClientResponse is a response sent by the server
+	ClientResponse MessageType = 6
+)
+
+// SocketProtocol is the dnstap transport of a message
+type SocketProtocol int
+
+// Transports known by dnstap
+const (
+	ProtocolUDP SocketProtocol = 1
+	ProtocolTCP SocketProtocol = 2
+	ProtocolDoT SocketProtocol = 3
+	ProtocolDoH SocketProtocol = 4
+	ProtocolDoQ SocketProtocol = 7
+)
+
+// ParseProtocol converts a sidecar DNS protocol name, like
+// "udp" or "tcp+tls", into its [SocketProtocol]
+func ParseProtocol(proto string) (SocketProtocol, bool) {
+	switch proto {
+	case "udp":
+		return ProtocolUDP, true
+	case "tcp":
+		return ProtocolTCP, true
+	case "tcp+tls", "tcp-tls", "dot":
+		return ProtocolDoT, true
+	case "doh", "https":
+		return ProtocolDoH, true
+	case "doq", "quic":
+		return ProtocolDoQ, true
+	default:
+		return 0, false
+	}
+}
+
+// Message describes a DNS message seen by the server
+type Message struct {
+	Type     MessageType
+	Protocol SocketProtocol
+
+	// QueryAddr is the client's address
+	QueryAddr netip.AddrPort
+	// ResponseAddr is the server's address
+	ResponseAddr netip.AddrPort
+
+	QueryTime       time.Time
+	QueryMessage    []byte
+	ResponseTime    time.Time
+	ResponseMessage []byte
+}
+
+// dnstap.proto field numbers
+const (
+	dnstapIdentity = 1
+	dnstapVersion  = 2
+	dnstapMessage  = 14
+	dnstapType     = 15
+
+	dnstapTypeMessage = 1
+
+	msgType            = 1
+	msgSocketFamily    = 2
+	msgSocketProtocol  = 3
+	msgQueryAddress    = 4
+	msgResponseAddress = 5
+	msgQueryPort       = 6
+	msgResponsePort    = 7
+	msgQueryTimeSec    = 8
+	msgQueryTimeNsec   = 9
+	msgQueryMessage    = 10
+	msgResponseTimeSec = 12
+	msgResponseTimeNs  = 13
+	msgResponseMessage = 14
+
+	familyINET  = 1
+	familyINET6 = 2
+)
+
+// Marshal encodes a [Message] as a dnstap protobuf frame
+func Marshal(identity, version string, m *Message) []byte {
+	var b []byte
+
+	if identity != "" {
+		b = protowire.AppendTag(b, dnstapIdentity, protowire.BytesType)
+		b = protowire.AppendString(b, identity)
+	}
+	if version != "" {
+		b = protowire.AppendTag(b, dnstapVersion, protowire.BytesType)
+		b = protowire.AppendString(b, version)
+	}
+
+	b = protowire.AppendTag(b, dnstapMessage, protowire.BytesType)
+	b = protowire.AppendBytes(b, m.appendProto(nil))
+
+	b = protowire.AppendTag(b, dnstapType, protowire.VarintType)
+	return protowire.AppendVarint(b, dnstapTypeMessage)
+}
+
+func (m *Message) appendProto(b []byte) []byte {
+	b = appendVarint(b, msgType, uint64(m.Type))
+
+	if addr := m.QueryAddr.Addr(); addr.IsValid() {
+		family := uint64(familyINET6)
+		if addr.Unmap().Is4() {
+			family = familyINET
+		}
+		b = appendVarint(b, msgSocketFamily, family)
+	}
+
+	if m.Protocol != 0 {
+		b = appendVarint(b, msgSocketProtocol, uint64(m.Protocol))
+	}
+
+	b = appendAddrPort(b, msgQueryAddress, msgQueryPort, m.QueryAddr)
+	b = appendAddrPort(b, msgResponseAddress, msgResponsePort, m.ResponseAddr)
+
+	b = appendTime(b, msgQueryTimeSec, msgQueryTimeNsec, m.QueryTime)
+	b = appendBytes(b, msgQueryMessage, m.QueryMessage)
+	b = appendTime(b, msgResponseTimeSec, msgResponseTimeNs, m.ResponseTime)
+	return appendBytes(b, msgResponseMessage, m.ResponseMessage)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendAddrPort(b []byte, addrNum, portNum protowire.Number, ap netip.AddrPort) []byte {
+	if !ap.IsValid() {
+		return b
+	}
+
+	b = appendBytes(b, addrNum, ap.Addr().Unmap().AsSlice())
+	return appendVarint(b, portNum, uint64(ap.Port()))
+}
+
+func appendTime(b []byte, secNum, nsecNum protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+
+	b = appendVarint(b, secNum, uint64(t.Unix()))
+	b = protowire.AppendTag(b, nsecNum, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, uint32(t.Nanosecond()))
+}
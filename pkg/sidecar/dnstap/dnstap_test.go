@@ -0,0 +1,178 @@
+package dnstap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// readFrame reads a data frame
+func readFrame(t *testing.T, r io.Reader) []byte {
+	var hdr [4]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatalf("ERROR: read: %v", err)
+	}
+
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size == 0 {
+		t.Fatalf("ERROR: unexpected control frame")
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatalf("ERROR: read: %v", err)
+	}
+	return data
+}
+
+func readControlFrame(t *testing.T, r io.Reader, expected uint32) {
+	var hdr [8]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatalf("ERROR: read: %v", err)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(hdr[4:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("ERROR: read: %v", err)
+	}
+
+	switch {
+	case binary.BigEndian.Uint32(hdr[:4]) != 0:
+		t.Fatalf("ERROR: not a control frame")
+	case binary.BigEndian.Uint32(payload) != expected:
+		t.Fatalf("ERROR: control frame %v (expected %v)", binary.BigEndian.Uint32(payload), expected)
+	}
+}
+
+// fields decodes the top level fields of a protobuf message
+func fields(t *testing.T, b []byte) map[protowire.Number][]byte {
+	out := make(map[protowire.Number][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("ERROR: bad tag")
+		}
+		b = b[n:]
+
+		m := protowire.ConsumeFieldValue(num, typ, b)
+		if m < 0 {
+			t.Fatalf("ERROR: bad field %v", num)
+		}
+
+		v := b[:m]
+		if typ == protowire.BytesType {
+			v, _ = protowire.ConsumeBytes(v)
+		}
+		out[num] = v
+		b = b[m:]
+	}
+	return out
+}
+
+func TestOutputFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dnstap.fstrm")
+
+	out, err := (&Config{File: name, Identity: "test"}).New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- out.Run(ctx) }()
+
+	out.Emit(&Message{
+		Type:         ClientQuery,
+		Protocol:     ProtocolUDP,
+		QueryAddr:    netip.MustParseAddrPort("192.0.2.1:5353"),
+		ResponseAddr: netip.MustParseAddrPort("[2001:db8::1]:53"),
+		QueryTime:    time.Unix(1000, 500),
+		QueryMessage: []byte("query"),
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ERROR: Run: %v", err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ERROR: ReadFile: %v", err)
+	}
+
+	r := bytes.NewReader(data)
+	readControlFrame(t, r, controlStart)
+	frame := readFrame(t, r)
+	readControlFrame(t, r, controlStop)
+
+	dt := fields(t, frame)
+	msg := fields(t, dt[dnstapMessage])
+	qaddr, _ := netip.AddrFromSlice(msg[msgQueryAddress])
+	qport, _ := protowire.ConsumeVarint(msg[msgQueryPort])
+	family, _ := protowire.ConsumeVarint(msg[msgSocketFamily])
+
+	switch {
+	case string(dt[dnstapIdentity]) != "test":
+		t.Errorf("ERROR: identity: %q", dt[dnstapIdentity])
+	case string(msg[msgQueryMessage]) != "query":
+		t.Errorf("ERROR: query message: %q", msg[msgQueryMessage])
+	case qaddr.String() != "192.0.2.1" || qport != 5353:
+		t.Errorf("ERROR: query address: %v:%v", qaddr, qport)
+	case family != familyINET:
+		t.Errorf("ERROR: family: %v", family)
+	default:
+		t.Log("success")
+	}
+}
+
+func TestBidiEncoder(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		enc, err := NewBidiEncoder(client, ContentType)
+		if err == nil {
+			_, err = enc.Write([]byte("hello"))
+		}
+		if err == nil {
+			err = enc.Close()
+		}
+		errs <- err
+	}()
+
+	readControlFrame(t, server, controlReady)
+	writeTestControl(t, server, controlAccept)
+	readControlFrame(t, server, controlStart)
+	if frame := readFrame(t, server); string(frame) != "hello" {
+		t.Fatalf("ERROR: frame: %q", frame)
+	}
+	readControlFrame(t, server, controlStop)
+	writeTestControl(t, server, controlFinish)
+
+	if err := <-errs; err != nil {
+		t.Errorf("ERROR: encoder: %v", err)
+	} else {
+		t.Log("success")
+	}
+}
+
+func writeTestControl(t *testing.T, w io.Writer, ctype uint32) {
+	enc := &Encoder{w: w}
+	if err := enc.writeControl(ctype, ContentType); err != nil {
+		t.Fatalf("ERROR: write: %v", err)
+	}
+}
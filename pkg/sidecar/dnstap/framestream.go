@@ -0,0 +1,136 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"darvaza.org/core"
+)
+
+// Frame Streams control frame types
+const (
+	controlAccept = 0x01
+	controlStart  = 0x02
+	controlStop   = 0x03
+	controlReady  = 0x04
+	controlFinish = 0x05
+
+	controlFieldContentType = 0x01
+
+	// maxControlFrameSize is the largest control frame accepted
+	maxControlFrameSize = 512
+)
+
+// Encoder writes data frames using the Frame Streams protocol
+type Encoder struct {
+	mu sync.Mutex
+	w  io.Writer
+	r  io.Reader
+
+	contentType string
+	buf         []byte
+}
+
+// NewEncoder starts a unidirectional stream of the given content
+// type, as used for files.
+func NewEncoder(w io.Writer, contentType string) (*Encoder, error) {
+	enc := &Encoder{w: w, contentType: contentType}
+	if err := enc.writeControl(controlStart, contentType); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// NewBidiEncoder negotiates and starts a bidirectional stream of
+// the given content type, as used for sockets.
+func NewBidiEncoder(rw io.ReadWriter, contentType string) (*Encoder, error) {
+	enc := &Encoder{w: rw, r: rw, contentType: contentType}
+
+	if err := enc.writeControl(controlReady, contentType); err != nil {
+		return nil, err
+	}
+
+	if err := enc.readControl(controlAccept); err != nil {
+		return nil, err
+	}
+
+	if err := enc.writeControl(controlStart, contentType); err != nil {
+		return nil, err
+	}
+
+	return enc, nil
+}
+
+// Write writes a data frame
+func (enc *Encoder) Write(frame []byte) (int, error) {
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	enc.buf = binary.BigEndian.AppendUint32(enc.buf[:0], uint32(len(frame)))
+	enc.buf = append(enc.buf, frame...)
+
+	if _, err := enc.w.Write(enc.buf); err != nil {
+		return 0, err
+	}
+	return len(frame), nil
+}
+
+// Close stops the stream, waiting for the receiver to
+// acknowledge it on bidirectional streams. The underlying
+// writer isn't closed.
+func (enc *Encoder) Close() error {
+	if err := enc.writeControl(controlStop, ""); err != nil {
+		return err
+	}
+
+	if enc.r != nil {
+		return enc.readControl(controlFinish)
+	}
+	return nil
+}
+
+func (enc *Encoder) writeControl(ctype uint32, contentType string) error {
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	var payload []byte
+	payload = binary.BigEndian.AppendUint32(payload, ctype)
+	if contentType != "" {
+		payload = binary.BigEndian.AppendUint32(payload, controlFieldContentType)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(contentType)))
+		payload = append(payload, contentType...)
+	}
+
+	// escape, length, payload
+	b := binary.BigEndian.AppendUint32(nil, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(payload)))
+	b = append(b, payload...)
+
+	_, err := enc.w.Write(b)
+	return err
+}
+
+func (enc *Encoder) readControl(expected uint32) error {
+	var hdr [8]byte
+
+	if _, err := io.ReadFull(enc.r, hdr[:]); err != nil {
+		return err
+	}
+
+	escape := binary.BigEndian.Uint32(hdr[:4])
+	size := binary.BigEndian.Uint32(hdr[4:])
+	if escape != 0 || size < 4 || size > maxControlFrameSize {
+		return core.Wrap(core.ErrInvalid, "frame stream: bad control frame")
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(enc.r, payload); err != nil {
+		return err
+	}
+
+	if ctype := binary.BigEndian.Uint32(payload); ctype != expected {
+		return core.Wrapf(core.ErrInvalid, "frame stream: unexpected control frame %v", ctype)
+	}
+	return nil
+}
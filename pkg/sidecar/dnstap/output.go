@@ -0,0 +1,232 @@
+package dnstap
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+const (
+	// DefaultBufferSize is the number of messages waiting to be
+	// written by default. Newer messages are dropped.
+	DefaultBufferSize = 1024
+	// DefaultReconnectInterval indicates how long we wait by
+	// default before reconnecting to the socket
+	DefaultReconnectInterval = 5 * time.Second
+	// DefaultTimeout indicates how long we wait for the socket
+	// during the handshake by default
+	DefaultTimeout = 5 * time.Second
+)
+
+// Config describes where an [Output] writes dnstap messages.
+// Socket and File are mutually exclusive.
+type Config struct {
+	Logger slog.Logger
+
+	// Socket is the path of the unix socket of a dnstap
+	// collector
+	Socket string
+	// File is the path of a file where the frames are appended
+	File string
+
+	// Identity and Version describe the server on every message
+	Identity string
+	Version  string
+
+	BufferSize        int
+	ReconnectInterval time.Duration
+	Timeout           time.Duration
+}
+
+// SetDefaults fills gaps in the [Config]
+func (cfg *Config) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultBufferSize
+	}
+
+	if cfg.ReconnectInterval <= 0 {
+		cfg.ReconnectInterval = DefaultReconnectInterval
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return nil
+}
+
+// Validate tells if the [Config] is usable
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.Socket == "" && cfg.File == "":
+		return core.Wrap(core.ErrInvalid, "dnstap: no Socket or File")
+	case cfg.Socket != "" && cfg.File != "":
+		return core.Wrap(core.ErrInvalid, "dnstap: both Socket and File")
+	default:
+		return nil
+	}
+}
+
+// New creates a new [Output]. Messages are written
+// once [Output.Run] is running.
+func (cfg *Config) New() (*Output, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	out := &Output{
+		cfg: *cfg,
+		ch:  make(chan []byte, cfg.BufferSize),
+	}
+	return out, nil
+}
+
+// Output writes dnstap messages in the background.
+// A nil *Output is valid and discards everything.
+type Output struct {
+	cfg     Config
+	ch      chan []byte
+	dropped atomic.Uint64
+}
+
+// Emit queues a [Message], dropping it if the buffer is full
+func (o *Output) Emit(m *Message) {
+	if o == nil {
+		return
+	}
+
+	select {
+	case o.ch <- Marshal(o.cfg.Identity, o.cfg.Version, m):
+	default:
+		o.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of messages dropped so far
+func (o *Output) Dropped() uint64 {
+	if o == nil {
+		return 0
+	}
+	return o.dropped.Load()
+}
+
+// Run writes the queued messages until the context is cancelled,
+// reconnecting to the socket when needed.
+func (o *Output) Run(ctx context.Context) error {
+	for {
+		enc, c, err := o.open(ctx)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// cancelled
+			return nil
+		case err != nil:
+			o.warn(err).Print("dnstap: failed to open output")
+		default:
+			err = o.drain(ctx, enc, c)
+			if ctx.Err() != nil {
+				return nil
+			}
+			o.warn(err).Print("dnstap: failed to write")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(o.cfg.ReconnectInterval):
+		}
+	}
+}
+
+func (o *Output) open(ctx context.Context) (*Encoder, io.Closer, error) {
+	if o.cfg.File != "" {
+		f, err := os.OpenFile(o.cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		enc, err := NewEncoder(f, ContentType)
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return enc, f, nil
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", o.cfg.Socket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(o.cfg.Timeout))
+	enc, err := NewBidiEncoder(conn, ContentType)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return enc, conn, nil
+}
+
+// drain writes messages until failure or cancellation, closing
+// the stream gracefully in the later case.
+func (o *Output) drain(ctx context.Context, enc *Encoder, c io.Closer) error {
+	defer c.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			o.flush(enc)
+			if conn, ok := c.(net.Conn); ok {
+				_ = conn.SetDeadline(time.Now().Add(o.cfg.Timeout))
+			}
+			return enc.Close()
+		case frame := <-o.ch:
+			if _, err := enc.Write(frame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// flush writes what's left on the queue
+func (o *Output) flush(enc *Encoder) {
+	for {
+		select {
+		case frame := <-o.ch:
+			if _, err := enc.Write(frame); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (o *Output) warn(err error) slog.Logger {
+	l := o.cfg.Logger.Warn()
+	if err != nil {
+		l = l.WithField(slog.ErrorFieldName, err)
+	}
+	return l
+}
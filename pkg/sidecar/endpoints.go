@@ -0,0 +1,100 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+
+	"darvaza.org/core"
+)
+
+// Endpoint describes an active listener of the [Server]
+type Endpoint struct {
+	// Server is "http", "dns" or "admin"
+	Server string `json:"server"`
+	// Proto is the protocol served, like "h2", "h3", "udp" or "doq"
+	Proto string         `json:"proto"`
+	Addr  netip.AddrPort `json:"addr"`
+	TLS   bool           `json:"tls"`
+	// ClientAuth is the client certificates policy of
+	// TLS endpoints
+	ClientAuth ClientAuthMode `json:"client_auth,omitempty"`
+	// Horizons lists the horizons reachable through the
+	// endpoint when the application is a [HorizonExposer]
+	Horizons []string `json:"horizons,omitempty"`
+}
+
+// Endpoints returns every active listener of the [Server],
+// including ephemeral ports, once [Server.Listen] has been
+// called. Horizons are known after [Server.Spawn].
+func (srv *Server) Endpoints() []Endpoint {
+	var out []Endpoint
+
+	if srv.hs != nil {
+		out = srv.appendEndpoints(out, "http", srv.hs.Addresses())
+	}
+
+	if srv.ds != nil {
+		out = srv.appendEndpoints(out, "dns", srv.ds.Addresses())
+	}
+
+	if ln := srv.admin.ln; ln != nil {
+		if ap, ok := core.AddrPort(ln.Addr()); ok {
+			out = append(out, Endpoint{Server: "admin", Proto: "http", Addr: ap})
+		}
+	}
+
+	return out
+}
+
+func (srv *Server) appendEndpoints(out []Endpoint, server string,
+	addrs map[string][]netip.AddrPort) []Endpoint {
+	//
+	protos := core.SortedKeys(addrs)
+	for _, proto := range protos {
+		for _, ap := range addrs[proto] {
+			ep := Endpoint{
+				Server:   server,
+				Proto:    proto,
+				Addr:     ap,
+				Horizons: srv.exposedHorizons(ap),
+			}
+
+			ep.ClientAuth, ep.TLS = srv.endpointClientAuth(proto)
+			out = append(out, ep)
+		}
+	}
+	return out
+}
+
+func (srv *Server) endpointClientAuth(proto string) (ClientAuthMode, bool) {
+	switch proto {
+	case "h2":
+		return srv.cfg.HTTP.HTTPSClientAuth(), true
+	case "h3":
+		return srv.cfg.HTTP.QUICClientAuthMode(), true
+	case "tcp+tls", "doq":
+		return srv.cfg.DNS.DoTClientAuth(), true
+	default:
+		return "", false
+	}
+}
+
+func (srv *Server) exposedHorizons(ap netip.AddrPort) []string {
+	if e, ok := srv.exposer.Load().(HorizonExposer); ok {
+		return e.Exposed(ap)
+	}
+	return nil
+}
+
+// newEndpointsHandler serves [Server.Endpoints] as JSON
+func (srv *Server) newEndpointsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "no-cache")
+
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(srv.Endpoints())
+	})
+}
@@ -0,0 +1,73 @@
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"darvaza.org/x/net/bind"
+
+	"darvaza.org/sidecar/pkg/sidecar/horizon"
+	"darvaza.org/sidecar/pkg/sidecar/httpserver"
+)
+
+func TestEndpoints(t *testing.T) {
+	srv := &Server{}
+	if err := srv.initAdmin(); err != nil {
+		t.Fatal(err)
+	}
+
+	// ephemeral port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	_ = l.Close()
+
+	hs, err := (&httpserver.Config{
+		Bind: httpserver.BindingConfig{
+			Addrs:         []netip.Addr{netip.MustParseAddr("127.0.0.1")},
+			PortInsecure:  port,
+			AllowInsecure: true,
+		},
+	}).New(nil)
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	if err := hs.ListenWithListener(bind.NewListenConfig(context.Background(), 0)); err != nil {
+		t.Fatalf("ERROR: Listen: %v", err)
+	}
+	defer hs.Close()
+
+	srv.hs = hs
+	srv.exposer.Store(horizon.Configs{
+		{Name: "lan", Ranges: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		{Name: "local", Ranges: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}},
+	}.Must(nil, nil))
+
+	rw := httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/endpoints", nil))
+
+	var eps []Endpoint
+	if err := json.Unmarshal(rw.Body.Bytes(), &eps); err != nil {
+		t.Fatalf("ERROR: %v\n%s", err, rw.Body)
+	}
+
+	expected := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), port)
+	switch {
+	case len(eps) != 1:
+		t.Errorf("ERROR: %v endpoints (expected 1)\n%s", len(eps), rw.Body)
+	case eps[0].Proto != "h2c" || eps[0].Addr != expected || eps[0].TLS:
+		t.Errorf("ERROR: unexpected endpoint: %+v", eps[0])
+	case len(eps[0].Horizons) != 1 || eps[0].Horizons[0] != "local":
+		t.Errorf("ERROR: unexpected horizons: %v", eps[0].Horizons)
+	default:
+		t.Logf("%+v: success", eps[0])
+	}
+}
@@ -0,0 +1,297 @@
+package sidecar
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"sort"
+	"sync"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+)
+
+const (
+	// DefaultExpiryInterval indicates how often the served
+	// certificates are checked when no interval is configured
+	DefaultExpiryInterval = time.Hour
+
+	day = 24 * time.Hour
+)
+
+// DefaultExpiryThresholds returns the remaining validity periods
+// used when none are configured.
+func DefaultExpiryThresholds() []time.Duration {
+	return []time.Duration{30 * day, 14 * day, 7 * day, 1 * day}
+}
+
+// ExpiryEvent describes a served certificate crossing one of
+// the configured thresholds.
+type ExpiryEvent struct {
+	// Name is the server name used to get the certificate
+	Name string
+	// Leaf is the served certificate
+	Leaf *x509.Certificate
+	// Remaining is the time left before the certificate expires
+	Remaining time.Duration
+	// Threshold is the threshold crossed, zero if already expired
+	Threshold time.Duration
+}
+
+// expiryMonitor keeps track of the state of the served certificates
+type expiryMonitor struct {
+	mu sync.Mutex
+
+	callbacks []func(ExpiryEvent)
+	remaining map[string]time.Duration
+	// notified holds the last threshold notified for each
+	// name and certificate
+	notified map[expiryKey]time.Duration
+}
+
+type expiryKey struct {
+	name   string
+	serial string
+}
+
+// OnRenewalNeeded registers a callback to be called when a served
+// certificate crosses one of the expiry thresholds.
+func (srv *Server) OnRenewalNeeded(fn func(ExpiryEvent)) {
+	if fn != nil {
+		srv.em.mu.Lock()
+		defer srv.em.mu.Unlock()
+
+		srv.em.callbacks = append(srv.em.callbacks, fn)
+	}
+}
+
+// DaysToExpiry returns the remaining validity, in days, of
+// the certificate served for each monitored name.
+func (srv *Server) DaysToExpiry() map[string]float64 {
+	srv.em.mu.Lock()
+	defer srv.em.mu.Unlock()
+
+	out := make(map[string]float64, len(srv.em.remaining))
+	for name, d := range srv.em.remaining {
+		out[name] = d.Hours() / 24
+	}
+	return out
+}
+
+// runExpiryMonitor checks the served certificates periodically
+// until the context is cancelled.
+func (srv *Server) runExpiryMonitor(ctx context.Context) error {
+	interval := srv.cfg.TLS.Expiry.Interval
+	if interval <= 0 {
+		interval = DefaultExpiryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		srv.CheckExpiry()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckExpiry checks the certificates served for the monitored
+// names, logging and notifying those crossing a threshold.
+func (srv *Server) CheckExpiry() {
+	now := time.Now()
+	names := srv.expiryNames()
+	served := make(map[string]string, len(names))
+
+	for _, name := range names {
+		leaf, ok := srv.getExpiryLeaf(name)
+		if !ok {
+			continue
+		}
+
+		served[name] = leaf.SerialNumber.String()
+		if ev, ok := srv.em.check(name, leaf, now, srv.expiryThresholds()); ok {
+			srv.onExpiryEvent(ev)
+		}
+	}
+
+	srv.em.prune(names, served)
+}
+
+func (srv *Server) getExpiryLeaf(name string) (*x509.Certificate, bool) {
+	cert, err := srv.tls.GetCertificate(newExpiryClientHello(name))
+	if err != nil || cert == nil {
+		srv.warn().WithField("name", name).
+			WithField(slog.ErrorFieldName, err).
+			Print("failed to get certificate to check expiry")
+		return nil, false
+	}
+
+	leaf, err := getLeaf(cert)
+	if err != nil {
+		srv.error(err).WithField("name", name).
+			Print("failed to parse certificate to check expiry")
+		return nil, false
+	}
+
+	return leaf, true
+}
+
+func (srv *Server) onExpiryEvent(ev ExpiryEvent) {
+	var l slog.Logger
+
+	if ev.Remaining <= 0 {
+		l = srv.error(nil)
+	} else {
+		l = srv.warn()
+	}
+
+	l.WithFields(slog.Fields{
+		"name":      ev.Name,
+		"subject":   ev.Leaf.Subject.String(),
+		"not_after": ev.Leaf.NotAfter,
+		"days_left": int(ev.Remaining / day),
+	}).Print("TLS certificate about to expire")
+
+	srv.em.mu.Lock()
+	callbacks := core.SliceCopy(srv.em.callbacks)
+	srv.em.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(ev)
+	}
+}
+
+// check records the remaining validity of a certificate and tells if
+// a new threshold has been crossed.
+func (em *expiryMonitor) check(name string, leaf *x509.Certificate, now time.Time,
+	thresholds []time.Duration) (ExpiryEvent, bool) {
+	//
+	remaining := leaf.NotAfter.Sub(now)
+	key := expiryKey{name: name, serial: leaf.SerialNumber.String()}
+
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	if em.remaining == nil {
+		em.remaining = make(map[string]time.Duration)
+		em.notified = make(map[expiryKey]time.Duration)
+	}
+
+	em.remaining[name] = remaining
+
+	threshold, crossed := crossedThreshold(remaining, thresholds)
+	if !crossed {
+		return ExpiryEvent{}, false
+	}
+
+	if last, ok := em.notified[key]; ok && last <= threshold {
+		// already notified
+		return ExpiryEvent{}, false
+	}
+
+	em.notified[key] = threshold
+	return ExpiryEvent{
+		Name:      name,
+		Leaf:      leaf,
+		Remaining: remaining,
+		Threshold: threshold,
+	}, true
+}
+
+// prune forgets the notifications of certificates no longer served,
+// given the monitored names and the serial served for each. Names
+// that couldn't be checked keep their notifications.
+func (em *expiryMonitor) prune(names []string, served map[string]string) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	for key := range em.notified {
+		serial, ok := served[key.name]
+		switch {
+		case !core.SliceContains(names, key.name):
+			// no longer monitored
+			delete(em.notified, key)
+		case ok && serial != key.serial:
+			// replaced
+			delete(em.notified, key)
+		}
+	}
+}
+
+// crossedThreshold returns the smallest threshold the remaining
+// validity is under, or zero if expired.
+func crossedThreshold(remaining time.Duration, thresholds []time.Duration) (time.Duration, bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+
+	var out time.Duration
+	var found bool
+
+	for _, t := range thresholds {
+		if remaining <= t && (!found || t < out) {
+			out, found = t, true
+		}
+	}
+
+	return out, found
+}
+
+func (srv *Server) expiryThresholds() []time.Duration {
+	s := srv.cfg.TLS.Expiry.Thresholds
+	if len(s) == 0 {
+		s = DefaultExpiryThresholds()
+	}
+	return s
+}
+
+func (srv *Server) expiryNames() []string {
+	names := append([]string{srv.cfg.Name}, srv.cfg.TLS.Expiry.Names...)
+	names = core.SliceUnique(names)
+	sort.Strings(names)
+	return names
+}
+
+func getLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	switch {
+	case cert.Leaf != nil:
+		return cert.Leaf, nil
+	case len(cert.Certificate) == 0:
+		return nil, core.Wrap(core.ErrInvalid, "empty certificate")
+	default:
+		return x509.ParseCertificate(cert.Certificate[0])
+	}
+}
+
+// newExpiryClientHello creates a [tls.ClientHelloInfo] accepting
+// any certificate type for the given name.
+func newExpiryClientHello(name string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        name,
+		SupportedVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+		SignatureSchemes: []tls.SignatureScheme{
+			tls.ECDSAWithP256AndSHA256,
+			tls.ECDSAWithP384AndSHA384,
+			tls.ECDSAWithP521AndSHA512,
+			tls.Ed25519,
+			tls.PSSWithSHA256,
+			tls.PSSWithSHA384,
+			tls.PSSWithSHA512,
+			tls.PKCS1WithSHA256,
+			tls.PKCS1WithSHA384,
+			tls.PKCS1WithSHA512,
+		},
+		SupportedCurves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521},
+		SupportedPoints: []uint8{0}, // uncompressed
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package sidecar
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testExpiryCase struct {
+	remaining time.Duration
+	threshold time.Duration
+	notify    bool
+}
+
+func TestExpiryMonitor(t *testing.T) {
+	var em expiryMonitor
+
+	thresholds := DefaultExpiryThresholds()
+	now := time.Now()
+
+	var cases = []testExpiryCase{
+		{60 * day, 0, false},
+		{29 * day, 30 * day, true},
+		{28 * day, 30 * day, false},
+		{10 * day, 14 * day, true},
+		{5 * day, 7 * day, true},
+		{3 * day, 7 * day, false},
+		{time.Hour, day, true},
+		{-time.Hour, 0, true},
+		{-2 * time.Hour, 0, false},
+	}
+
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	for _, tc := range cases {
+		leaf.NotAfter = now.Add(tc.remaining)
+
+		ev, ok := em.check("example.org", leaf, now, thresholds)
+		switch {
+		case ok != tc.notify:
+			t.Errorf("ERROR: %v: notify:%v (expected %v)", tc.remaining, ok, tc.notify)
+		case ok && ev.Threshold != tc.threshold:
+			t.Errorf("ERROR: %v: threshold:%v (expected %v)", tc.remaining, ev.Threshold, tc.threshold)
+		default:
+			t.Logf("%v: success", tc.remaining)
+		}
+	}
+
+	// renewed
+	leaf = &x509.Certificate{SerialNumber: big.NewInt(2), NotAfter: now.Add(20 * day)}
+	if _, ok := em.check("example.org", leaf, now, thresholds); !ok {
+		t.Error("ERROR: renewed certificate not notified")
+	}
+
+	if d := em.remaining["example.org"]; d != 20*day {
+		t.Errorf("ERROR: remaining:%v (expected %v)", d, 20*day)
+	}
+}
+
+func TestExpiryMonitorPrune(t *testing.T) {
+	var em expiryMonitor
+
+	thresholds := DefaultExpiryThresholds()
+	now := time.Now()
+	names := []string{"a.example.org", "b.example.org"}
+
+	// notify serials 1-10 of a.example.org, and 1 of the others
+	for i := int64(1); i <= 10; i++ {
+		leaf := &x509.Certificate{SerialNumber: big.NewInt(i), NotAfter: now.Add(day)}
+		em.check("a.example.org", leaf, now, thresholds)
+	}
+	for _, name := range []string{"b.example.org", "c.example.org"} {
+		leaf := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: now.Add(day)}
+		em.check(name, leaf, now, thresholds)
+	}
+
+	// b.example.org failed to be checked, c.example.org
+	// is no longer monitored
+	em.prune(names, map[string]string{"a.example.org": "10"})
+
+	expected := map[expiryKey]bool{
+		{name: "a.example.org", serial: "10"}: true,
+		{name: "b.example.org", serial: "1"}:  true,
+	}
+
+	switch {
+	case len(em.notified) != len(expected):
+		t.Errorf("ERROR: %v notifications remembered (expected %v)", len(em.notified), len(expected))
+	default:
+		for key := range em.notified {
+			if !expected[key] {
+				t.Errorf("ERROR: %v not pruned", key)
+			}
+		}
+	}
+
+	// already notified serials aren't notified again
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(10), NotAfter: now.Add(day)}
+	if _, ok := em.check("a.example.org", leaf, now, thresholds); ok {
+		t.Error("ERROR: current certificate notified again")
+	} else {
+		t.Log("success")
+	}
+}
@@ -0,0 +1,153 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// A HealthCheck tells if a component is healthy, returning
+// the reason if it isn't.
+type HealthCheck func(ctx context.Context) error
+
+// healthChecks holds the registered health checks in order
+type healthChecks struct {
+	mu     sync.Mutex
+	names  []string
+	checks map[string]HealthCheck
+}
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// AddHealthCheck registers a named [HealthCheck] considered by the
+// /healthz and /readyz endpoints of the admin listener. Registering
+// a name again replaces the previous check.
+func (srv *Server) AddHealthCheck(name string, check HealthCheck) {
+	if name == "" || check == nil {
+		return
+	}
+
+	srv.hc.mu.Lock()
+	defer srv.hc.mu.Unlock()
+
+	if srv.hc.checks == nil {
+		srv.hc.checks = make(map[string]HealthCheck)
+	}
+
+	if _, ok := srv.hc.checks[name]; !ok {
+		srv.hc.names = append(srv.hc.names, name)
+	}
+	srv.hc.checks[name] = check
+}
+
+func (hc *healthChecks) list() []namedCheck {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	out := make([]namedCheck, len(hc.names))
+	for i, name := range hc.names {
+		out[i] = namedCheck{name, hc.checks[name]}
+	}
+	return out
+}
+
+// IsReady tells if all the workers have been spawned and the
+// server hasn't been cancelled. /readyz also fails if any
+// listener stops serving, or any [HealthCheck] fails.
+func (srv *Server) IsReady() bool {
+	return srv.ready.Load() && !srv.IsCancelled()
+}
+
+// checkWorkers is the built-in readiness check
+func (srv *Server) checkWorkers(context.Context) error {
+	switch {
+	case srv.IsCancelled():
+		return os.ErrClosed
+	case !srv.ready.Load():
+		return errors.New("not spawned")
+	default:
+		return nil
+	}
+}
+
+// checkLive is the built-in liveness check, failing only
+// if a worker failed.
+func (srv *Server) checkLive(context.Context) error {
+	if !srv.IsCancelled() {
+		return nil
+	}
+
+	switch err := context.Cause(srv.eg.Context()); {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, os.ErrClosed):
+		return nil
+	default:
+		return err
+	}
+}
+
+// livezChecks returns the checks used by /livez
+func (srv *Server) livezChecks() []namedCheck {
+	return []namedCheck{{"workers", srv.checkLive}}
+}
+
+// healthzChecks returns the checks used by /healthz
+func (srv *Server) healthzChecks() []namedCheck {
+	return append(srv.livezChecks(), srv.hc.list()...)
+}
+
+// readyzChecks returns the checks used by /readyz
+func (srv *Server) readyzChecks() []namedCheck {
+	out := []namedCheck{{"workers", srv.checkWorkers}}
+	return append(out, srv.hc.list()...)
+}
+
+// newHealthHandler returns a handler running the given checks,
+// replying 200 if all pass or 503 if any fails.
+// The failures, or every result if the verbose query
+// parameter is given, are listed on the body.
+func newHealthHandler(endpoint string, checks func() []namedCheck) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+
+		_, verbose := req.URL.Query()["verbose"]
+		failed := runHealthChecks(req.Context(), &buf, checks(), verbose)
+
+		code := http.StatusOK
+		switch {
+		case failed:
+			code = http.StatusServiceUnavailable
+			_, _ = fmt.Fprintf(&buf, "%s check failed\n", endpoint)
+		case verbose:
+			_, _ = fmt.Fprintf(&buf, "%s check passed\n", endpoint)
+		default:
+			_, _ = buf.WriteString("ok\n")
+		}
+
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.WriteHeader(code)
+		_, _ = buf.WriteTo(rw)
+	})
+}
+
+func runHealthChecks(ctx context.Context, buf *bytes.Buffer, checks []namedCheck, verbose bool) bool {
+	var failed bool
+
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			failed = true
+			_, _ = fmt.Fprintf(buf, "[-]%s failed: %v\n", c.name, err)
+		} else if verbose {
+			_, _ = fmt.Fprintf(buf, "[+]%s ok\n", c.name)
+		}
+	}
+
+	return failed
+}
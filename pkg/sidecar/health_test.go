@@ -0,0 +1,62 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testHealthCase struct {
+	name    string
+	prepare func(*Server)
+	healthz int
+	readyz  int
+	livez   int
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	var failing error
+
+	srv := &Server{}
+	if err := srv.initAdmin(); err != nil {
+		t.Fatal(err)
+	}
+
+	var cases = []testHealthCase{
+		{"spawning", func(*Server) {}, 200, 503, 200},
+		{"ready", func(srv *Server) { srv.ready.Store(true) }, 200, 200, 200},
+		{"check passing", func(srv *Server) {
+			srv.AddHealthCheck("app", func(context.Context) error { return failing })
+		}, 200, 200, 200},
+		{"check failing", func(*Server) { failing = errors.New("broken") }, 503, 503, 200},
+		{"check recovered", func(*Server) { failing = nil }, 200, 200, 200},
+		{"admin serving", func(srv *Server) {
+			srv.AddHealthCheck("admin", srv.admin.healthy)
+		}, 200, 200, 200},
+		{"admin stopped", func(srv *Server) { srv.admin.stopped.Store(true) }, 503, 503, 200},
+		{"admin restored", func(srv *Server) { srv.admin.stopped.Store(false) }, 200, 200, 200},
+		{"worker failed", func(srv *Server) { srv.Fail(errors.New("failed")) }, 503, 503, 503},
+	}
+
+	h := srv.AdminHandler()
+	for _, tc := range cases {
+		tc.prepare(srv)
+
+		for path, expected := range map[string]int{
+			"/healthz": tc.healthz,
+			"/readyz":  tc.readyz,
+			"/livez":   tc.livez,
+		} {
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path+"?verbose", nil))
+
+			if rw.Code != expected {
+				t.Errorf("ERROR: %s: %s: %v (expected %v)\n%s", tc.name, path, rw.Code, expected, rw.Body)
+			} else {
+				t.Logf("%s: %s: success", tc.name, path)
+			}
+		}
+	}
+}
@@ -13,15 +13,68 @@ type Config struct {
 	Name   string
 	Ranges []netip.Prefix
 
+	// ServerNames restricts the Horizon to TLS clients requesting
+	// one of these server names. Glob patterns are accepted.
+	ServerNames []string
+	// Hosts restricts the Horizon to HTTP requests for one of these
+	// Host headers. Glob patterns are accepted. Ignored on DNS
+	// requests.
+	Hosts []string
+	// Listeners restricts the Horizon to requests arriving at one of
+	// these local addresses. Unspecified addresses and port 0 act as
+	// wildcards.
+	Listeners []netip.AddrPort
+	// Peers restricts the Horizon to clients presenting a verified
+	// certificate whose SPIFFE ID, CommonName or DNS SANs match one
+	// of these glob patterns.
+	Peers []string
+
 	Middleware         func(http.Handler) http.Handler
 	ExchangeMiddleware func(resolver.Exchanger) resolver.Exchanger
+
+	// Exchanger, if set, replaces the [resolver.Exchanger] given
+	// to [Config.New], like upstream resolvers specific to
+	// this Horizon.
+	Exchanger resolver.Exchanger
+}
+
+// Validate checks the matchers of the Config
+func (hc *Config) Validate() error {
+	_, err := newSelector(hc)
+	if err != nil {
+		return core.Wrap(err, hc.Name)
+	}
+	return nil
+}
+
+// NewHorizon assembles a new [Horizon] using the [Config] and the given
+// entrypoints, failing if the matchers are invalid.
+func NewHorizon(hc Config, h http.Handler, e resolver.Exchanger) (*Horizon, error) {
+	sel, err := newSelector(&hc)
+	if err != nil {
+		return nil, core.Wrap(err, hc.Name)
+	}
+
+	return hc.newHorizon(sel, h, e), nil
 }
 
-// New assembles a new [Horizon] using the Config and the given entrypoints
+// New assembles a new [Horizon] using the Config and the given entrypoints.
+// If the matchers are invalid the Horizon never accepts a request, use
+// [NewHorizon] or [Config.Validate] to catch them.
 func (hc *Config) New(h http.Handler, e resolver.Exchanger) *Horizon {
+	sel, err := newSelector(hc)
+	if err != nil {
+		sel = &selector{reject: true}
+	}
+
+	return hc.newHorizon(sel, h, e)
+}
+
+func (hc *Config) newHorizon(sel *selector, h http.Handler, e resolver.Exchanger) *Horizon {
 	z := &Horizon{
-		n: hc.Name,
-		r: hc.Ranges,
+		n:   hc.Name,
+		r:   hc.Ranges,
+		sel: sel,
 	}
 
 	if h == nil {
@@ -34,7 +87,9 @@ func (hc *Config) New(h http.Handler, e resolver.Exchanger) *Horizon {
 		z.h = h
 	}
 
-	if e == nil {
+	if hc.Exchanger != nil {
+		e = hc.Exchanger
+	} else if e == nil {
 		e = resolver.ExchangerFunc(ForbiddenExchange)
 	}
 
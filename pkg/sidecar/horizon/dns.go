@@ -2,6 +2,7 @@ package horizon
 
 import (
 	"context"
+	"net/http"
 	"net/netip"
 	"time"
 
@@ -10,6 +11,10 @@ import (
 	"darvaza.org/core"
 	"darvaza.org/resolver"
 	"darvaza.org/resolver/pkg/errors"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+	"darvaza.org/sidecar/pkg/sidecar/tracing"
 )
 
 var (
@@ -26,18 +31,28 @@ func (s Horizons) ServeDNS(rw dns.ResponseWriter, req *dns.Msg) {
 		return
 	}
 
-	ctx, cancel := s.newDNSLookupContext(m, req)
+	observe.SetDNSHorizon(rw, m.Horizon)
+
+	ctx, cancel := s.newDNSLookupContext(rw, m, req)
 	defer cancel()
 
+	ctx, span := s.Tracer.StartDNS(ctx, rw, req)
+	defer span.End()
+
+	span.SetAttribute(tracing.AttrHorizon, m.Horizon)
+
 	rsp, err := z.Exchange(ctx, req)
 	if err != nil {
 		rsp = errors.ErrorAsMsg(req, err)
 	}
+	span.SetDNSResponse(rsp, err)
 
 	_ = rw.WriteMsg(rsp)
 }
 
-func (s Horizons) newDNSLookupContext(m Match, req *dns.Msg) (context.Context, context.CancelFunc) {
+func (s Horizons) newDNSLookupContext(rw dns.ResponseWriter, m Match,
+	req *dns.Msg) (context.Context, context.CancelFunc) {
+	//
 	var ctx context.Context
 	var timeout time.Duration
 
@@ -55,6 +70,11 @@ func (s Horizons) newDNSLookupContext(m Match, req *dns.Msg) (context.Context, c
 	// attach match
 	ctx = s.ContextKey.WithValue(ctx, m)
 
+	// attach client certificate identity
+	if id, ok := peer.FromDNSResponseWriter(rw); ok {
+		ctx = peer.WithIdentity(ctx, id)
+	}
+
 	// timeout
 	if s.ExchangeTimeoutFunc != nil {
 		timeout = s.ExchangeTimeoutFunc(m.RemoteAddr, req)
@@ -85,14 +105,15 @@ func (s Horizons) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
 // MatchDNSRequest find the Horizon corresponding to an [http.Request] and
 // prepares a [Match] to include in the context.
 func (s Horizons) MatchDNSRequest(rw dns.ResponseWriter) (*Horizon, Match, bool) {
-	addr, _ := DNSRemoteAddr(rw)
+	addr, proxy, _ := s.dnsRemoteAddr(rw)
 	if addr.IsValid() {
-		z, cidr, ok := s.Match(addr)
+		z, cidr, ok := s.MatchRequest(NewDNSRequest(rw, addr))
 		if ok {
 			m := Match{
 				Horizon:    z.n,
 				CIDR:       cidr,
 				RemoteAddr: addr,
+				Proxy:      proxy,
 			}
 			return z, m, true
 		}
@@ -112,6 +133,36 @@ func (z *Horizon) Lookup(ctx context.Context, qName string, qType uint16) (*dns.
 	return l.Lookup(ctx, qName, qType)
 }
 
+// dnsRemoteAddr extracts the client address of a DNS request,
+// honouring the TrustedProxies on DNS over HTTPS.
+func (s Horizons) dnsRemoteAddr(rw dns.ResponseWriter) (client, proxy netip.Addr, err error) {
+	if req, ok := DNSHTTPRequest(rw); ok {
+		return ForwardedRemoteAddr(req, s.ForwardedHeader, s.TrustedProxies)
+	}
+
+	client, err = DNSRemoteAddr(rw)
+	return client, netip.Addr{}, err
+}
+
+// DNSHTTPRequest returns the [http.Request] carrying a DNS over HTTPS
+// query if the [dns.ResponseWriter], or any it wraps, provides it
+// via an HTTPRequest method.
+func DNSHTTPRequest(rw dns.ResponseWriter) (*http.Request, bool) {
+	for rw != nil {
+		switch w := rw.(type) {
+		case interface{ HTTPRequest() *http.Request }:
+			req := w.HTTPRequest()
+			return req, req != nil
+		case interface{ Unwrap() dns.ResponseWriter }:
+			// wrapped by another middleware
+			rw = w.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
 // DNSRemoteAddr extracts the remote address associated with an [dns.ResponseWriter]
 func DNSRemoteAddr(rw dns.ResponseWriter) (netip.Addr, error) {
 	ap, ok := core.AddrPort(rw.RemoteAddr())
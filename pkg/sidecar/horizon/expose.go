@@ -0,0 +1,44 @@
+package horizon
+
+import "net/netip"
+
+var (
+	loopback4 = netip.MustParsePrefix("127.0.0.0/8")
+	loopback6 = netip.MustParsePrefix("::1/128")
+)
+
+// Exposed returns the names of the horizons reachable through
+// a listener bound to the given local address. Listeners bound
+// to a loopback address only reach horizons covering loopback
+// clients, and horizons restricted to other listeners are
+// excluded.
+func (s Horizons) Exposed(local netip.AddrPort) []string {
+	var out []string
+
+	for _, z := range s.s {
+		if z.reachableFrom(local.Addr()) && z.sel.reachableFrom(local) {
+			out = append(out, z.n)
+		}
+	}
+	return out
+}
+
+func (z *Horizon) reachableFrom(local netip.Addr) bool {
+	local = local.Unmap()
+	if len(z.r) == 0 || !local.IsLoopback() {
+		// any
+		return true
+	}
+
+	clients := loopback6
+	if local.Is4() {
+		clients = loopback4
+	}
+
+	for _, r := range z.r {
+		if r.Overlaps(clients) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package horizon
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"darvaza.org/core"
+)
+
+// DefaultForwardedHeader is the header trusted by
+// [ForwardedRemoteAddr] when none is specified
+const DefaultForwardedHeader = "X-Forwarded-For"
+
+// ForwardedRemoteAddr extracts the client address of an [http.Request]
+// using the given header when the request comes from one of the trusted
+// proxies. Forwarded is parsed as RFC 7239, and any other header, like
+// X-Forwarded-For or X-Real-IP, as a comma separated list of addresses.
+// Other headers are ignored, as the proxies may pass them through
+// unchanged from the client.
+//
+// The chain of hops is walked from the right skipping trusted proxies,
+// and the first untrusted hop is the client. If the walk reaches an
+// unknown or obfuscated hop the client can't be identified and an
+// error is returned instead. The returned proxy is the address that
+// connected to us if the header was used, and invalid otherwise.
+func ForwardedRemoteAddr(req *http.Request, header string,
+	trusted []netip.Prefix) (client, proxy netip.Addr, err error) {
+	//
+	peer, err := HTTPRemoteAddr(req)
+	if err != nil || !isTrustedProxy(peer, trusted) {
+		return peer, netip.Addr{}, err
+	}
+
+	hops := forwardedHops(req.Header, header)
+	if len(hops) == 0 {
+		// not forwarded
+		return peer, netip.Addr{}, nil
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedHop(hops[i])
+		if !ok {
+			// unknown or obfuscated, never fall back to a trusted hop
+			return netip.Addr{}, peer, core.Wrapf(core.ErrInvalid, "forwarded client %q", hops[i])
+		}
+
+		client = addr
+		if !isTrustedProxy(addr, trusted) {
+			break
+		}
+	}
+
+	return client, peer, nil
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHops returns the chain of client addresses of the
+// given header, DefaultForwardedHeader if empty.
+func forwardedHops(hdr http.Header, name string) []string {
+	if name == "" {
+		name = DefaultForwardedHeader
+	}
+
+	values := hdr.Values(name)
+	if http.CanonicalHeaderKey(name) == "Forwarded" {
+		return parseForwarded(values)
+	}
+
+	var hops []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				hops = append(hops, s)
+			}
+		}
+	}
+	return hops
+}
+
+// parseForwarded extracts the for= parameter of every element
+// of RFC 7239 Forwarded headers
+func parseForwarded(values []string) []string {
+	var hops []string
+
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			hops = append(hops, forwardedFor(element))
+		}
+	}
+	return hops
+}
+
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(key, "for") {
+			return strings.Trim(value, `"`)
+		}
+	}
+
+	// missing for= counts as unknown
+	return "unknown"
+}
+
+// parseForwardedHop parses an address, optionally with port and
+// IPv6 brackets, ignoring "unknown" and obfuscated identifiers.
+func parseForwardedHop(s string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+
+	if inner, ok := strings.CutPrefix(s, "["); ok {
+		// [IPv6] without port, or with an obfuscated one
+		if inner, _, ok = strings.Cut(inner, "]"); ok {
+			if addr, err := netip.ParseAddr(inner); err == nil {
+				return addr.Unmap(), true
+			}
+		}
+	}
+
+	return netip.Addr{}, false
+}
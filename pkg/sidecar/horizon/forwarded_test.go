@@ -0,0 +1,154 @@
+package horizon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/resolver"
+
+	"darvaza.org/sidecar/pkg/sidecar/httpserver"
+)
+
+type testForwardedCase struct {
+	name   string
+	remote string
+	// trusted is the ForwardedHeader
+	trusted string
+	header  map[string]string
+	// client is "invalid IP" when the request must be refused
+	client string
+	proxy  string
+}
+
+func TestForwardedRemoteAddr(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	const (
+		xff       = "X-Forwarded-For"
+		forwarded = "Forwarded"
+	)
+
+	var cases = []testForwardedCase{
+		{"direct", "192.0.2.1:1234", xff, nil, "192.0.2.1", "invalid IP"},
+		{"untrusted peer", "192.0.2.1:1234", xff,
+			map[string]string{xff: "198.51.100.1"}, "192.0.2.1", "invalid IP"},
+		{"trusted peer without headers", "10.0.0.1:1234", xff, nil, "10.0.0.1", "invalid IP"},
+		{"X-Forwarded-For", "10.0.0.1:1234", xff,
+			map[string]string{xff: "198.51.100.1"}, "198.51.100.1", "10.0.0.1"},
+		{"X-Forwarded-For by default", "10.0.0.1:1234", "",
+			map[string]string{xff: "198.51.100.1"}, "198.51.100.1", "10.0.0.1"},
+		{"X-Forwarded-For chain", "10.0.0.1:1234", xff,
+			map[string]string{xff: "203.0.113.9, 198.51.100.1, 10.0.0.2"}, "198.51.100.1", "10.0.0.1"},
+		{"X-Forwarded-For all trusted", "10.0.0.1:1234", xff,
+			map[string]string{xff: "10.0.0.3, 10.0.0.2"}, "10.0.0.3", "10.0.0.1"},
+		{"X-Forwarded-For unknown", "10.0.0.1:1234", xff,
+			map[string]string{xff: "unknown, 10.0.0.2"}, "invalid IP", "10.0.0.1"},
+		{"X-Real-IP", "10.0.0.1:1234", "x-real-ip",
+			map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1", "10.0.0.1"},
+		{"Forwarded", "[fd00::1]:1234", forwarded,
+			map[string]string{forwarded: `for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https`},
+			"2001:db8:cafe::17", "fd00::1"},
+		{"Forwarded obfuscated", "10.0.0.1:1234", forwarded,
+			map[string]string{forwarded: "for=_hidden, for=10.0.0.2"}, "invalid IP", "10.0.0.1"},
+		// headers the proxy doesn't set come from the client
+		{"forged Forwarded", "10.0.0.1:1234", xff,
+			map[string]string{forwarded: "for=10.0.0.9", xff: "198.51.100.1"}, "198.51.100.1", "10.0.0.1"},
+		{"forged X-Forwarded-For", "10.0.0.1:1234", forwarded,
+			map[string]string{forwarded: "for=198.51.100.1", xff: "10.0.0.9"}, "198.51.100.1", "10.0.0.1"},
+		{"forged X-Real-IP", "10.0.0.1:1234", xff,
+			map[string]string{"X-Real-IP": "10.0.0.9"}, "10.0.0.1", "invalid IP"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+
+		client, proxy, err := ForwardedRemoteAddr(req, tc.trusted, trusted)
+		switch {
+		case (err != nil) != (tc.client == "invalid IP"):
+			t.Errorf("ERROR: %s: %v", tc.name, err)
+		case client.String() != tc.client:
+			t.Errorf("ERROR: %s: client %q (expected %q)", tc.name, client, tc.client)
+		case proxy.String() != tc.proxy:
+			t.Errorf("ERROR: %s: proxy %q (expected %q)", tc.name, proxy, tc.proxy)
+		default:
+			t.Logf("%s: success", tc.name)
+		}
+	}
+}
+
+func TestForwardedDoH(t *testing.T) {
+	s, err := Configs{
+		{
+			Name:   "blocked",
+			Ranges: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+			Middleware: func(http.Handler) http.Handler {
+				return http.HandlerFunc(ForbiddenHTTP)
+			},
+			ExchangeMiddleware: func(resolver.Exchanger) resolver.Exchanger {
+				return resolver.ExchangerFunc(ForbiddenExchange)
+			},
+		},
+		{Name: "public"},
+	}.New(nil, resolver.ExchangerFunc(func(_ context.Context, req *dns.Msg) (*dns.Msg, error) {
+		return new(dns.Msg).SetReply(req), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	q, err := new(dns.Msg).SetQuestion("example.org.", dns.TypeA).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := httpserver.DoHMiddleware(nil, s)
+	for _, tc := range []struct {
+		name   string
+		remote string
+		xff    string
+		rcode  int
+	}{
+		{"direct", "198.51.100.1:1234", "", dns.RcodeSuccess},
+		{"direct blocked", "192.0.2.1:1234", "", dns.RcodeRefused},
+		{"forwarded", "10.0.0.1:1234", "198.51.100.1", dns.RcodeSuccess},
+		{"forwarded blocked", "10.0.0.1:1234", "192.0.2.1", dns.RcodeRefused},
+		{"forwarded unknown", "10.0.0.1:1234", "unknown", dns.RcodeRefused},
+	} {
+		req := httptest.NewRequest(http.MethodPost, httpserver.DoHPath, bytes.NewReader(q))
+		req.Header.Set("Content-Type", httpserver.DoHContentType)
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		b, _ := io.ReadAll(rec.Body)
+		rsp := new(dns.Msg)
+		switch {
+		case rsp.Unpack(b) != nil:
+			t.Errorf("ERROR: %s: bad response: %v", tc.name, rec.Code)
+		case rsp.Rcode != tc.rcode:
+			t.Errorf("ERROR: %s: %s (expected %s)", tc.name,
+				dns.RcodeToString[rsp.Rcode], dns.RcodeToString[tc.rcode])
+		default:
+			t.Logf("%s: success", tc.name)
+		}
+	}
+}
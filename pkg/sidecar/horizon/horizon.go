@@ -12,6 +12,8 @@ import (
 	"darvaza.org/core"
 	"darvaza.org/resolver"
 	"github.com/miekg/dns"
+
+	"darvaza.org/sidecar/pkg/sidecar/tracing"
 )
 
 // Match specifies how the Remote made it through,
@@ -20,6 +22,10 @@ type Match struct {
 	Horizon    string
 	RemoteAddr netip.Addr
 	CIDR       netip.Prefix
+
+	// Proxy is the address of the trusted proxy that forwarded
+	// the request on behalf of RemoteAddr, if any.
+	Proxy netip.Addr
 }
 
 // IsValid checks if the [Match] contains consistent information
@@ -33,8 +39,13 @@ func (m Match) IsValid() bool {
 // Horizons is a list of all known horizons sorted by
 // priority.
 type Horizons struct {
-	s []*Horizon
-	n map[string]*Horizon
+	s   []*Horizon
+	n   map[string]*Horizon
+	idx *index
+
+	// selectors counts the horizons with matchers besides
+	// the ranges
+	selectors int
 
 	ExchangeContextFunc func(netip.Addr, *dns.Msg) context.Context
 	ExchangeContext     context.Context
@@ -42,12 +53,28 @@ type Horizons struct {
 	ExchangeTimeout     time.Duration
 
 	ContextKey *core.ContextKey[Match]
+
+	// TrustedProxies lists the reverse proxies allowed to tell
+	// the client address of HTTP and DoH requests via the ForwardedHeader.
+	TrustedProxies []netip.Prefix
+	// ForwardedHeader is the header set by the TrustedProxies,
+	// like Forwarded, X-Forwarded-For or X-Real-IP. If not
+	// specified [DefaultForwardedHeader] is used.
+	ForwardedHeader string
+
+	// Tracer is an optional [tracing.Tracer] starting a span
+	// for every DNS request.
+	Tracer *tracing.Tracer
 }
 
 // AppendNew creates a [Horizon] based on a [Config] and endpoints.
 // [Config.Name] must be unique.
 func (s *Horizons) AppendNew(hc Config, h http.Handler, e resolver.Exchanger) error {
-	z := hc.New(h, e)
+	z, err := NewHorizon(hc, h, e)
+	if err != nil {
+		return err
+	}
+
 	return s.Append(z)
 }
 
@@ -65,6 +92,15 @@ func (s *Horizons) Append(z *Horizon) error {
 		return core.Wrap(core.ErrExists, z.String())
 	}
 
+	if s.idx == nil {
+		s.idx = newIndex()
+	}
+
+	if z.sel != nil {
+		s.selectors++
+	}
+
+	s.idx.add(len(s.s), z)
 	s.s = append(s.s, z)
 	s.n[z.n] = z
 	return nil
@@ -75,8 +111,19 @@ func (s *Horizons) Len() int {
 	return len(s.s)
 }
 
-// Match finds the CIDR and Horizon corresponding to the given address
+// Match finds the CIDR and Horizon corresponding to the given address.
+// The first Horizon containing the address wins, and within it the
+// first matching CIDR. Other matchers of the horizons are not
+// considered, see [Horizons.MatchRequest].
 func (s Horizons) Match(addr netip.Addr) (*Horizon, netip.Prefix, bool) {
+	if s.idx != nil {
+		return s.idx.match(s.s, addr)
+	}
+	return s.matchLinear(addr)
+}
+
+// matchLinear is [Horizons.Match] walking every range
+func (s Horizons) matchLinear(addr netip.Addr) (*Horizon, netip.Prefix, bool) {
 	for i := range s.s {
 		z := s.s[i]
 
@@ -88,6 +135,31 @@ func (s Horizons) Match(addr netip.Addr) (*Horizon, netip.Prefix, bool) {
 	return nil, netip.Prefix{}, false
 }
 
+// MatchRequest finds the CIDR and Horizon corresponding to a [Request],
+// considering the ranges and the other matchers of each Horizon.
+func (s Horizons) MatchRequest(r Request) (*Horizon, netip.Prefix, bool) {
+	switch {
+	case s.selectors == 0:
+		// only ranges
+		return s.Match(r.RemoteAddr)
+	case s.idx != nil:
+		return s.idx.matchRequest(s.s, r)
+	default:
+		return s.matchRequestLinear(r)
+	}
+}
+
+// matchRequestLinear is [Horizons.MatchRequest] walking every horizon
+func (s Horizons) matchRequestLinear(r Request) (*Horizon, netip.Prefix, bool) {
+	for _, z := range s.s {
+		if cidr, ok := z.Match(r.RemoteAddr); ok && z.sel.Accept(r) {
+			return z, cidr, true
+		}
+	}
+
+	return nil, netip.Prefix{}, false
+}
+
 // Get finds a Horizon by name.
 func (s Horizons) Get(name string) *Horizon {
 	if s.n != nil {
@@ -101,8 +173,9 @@ func (s Horizons) Get(name string) *Horizon {
 
 // Horizon is one horizon
 type Horizon struct {
-	n string
-	r []netip.Prefix
+	n   string
+	r   []netip.Prefix
+	sel *selector
 
 	h http.Handler
 	e resolver.Exchanger
@@ -159,6 +232,11 @@ func (z *Horizon) Match(addr netip.Addr) (netip.Prefix, bool) {
 	return netip.Prefix{}, false
 }
 
+// Accept checks if the [Request] belongs on this [Horizon]
+func (z *Horizon) Accept(r Request) bool {
+	return z.InRange(r.RemoteAddr) && z.sel.Accept(r)
+}
+
 // InRange checks if the remote address belongs on this [Horizon]
 func (z *Horizon) InRange(addr netip.Addr) bool {
 	_, ok := z.Match(addr)
@@ -6,6 +6,8 @@ import (
 	"net/netip"
 
 	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
 )
 
 var (
@@ -21,6 +23,8 @@ func (s Horizons) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	observe.SetHorizon(req.Context(), m.Horizon)
+
 	if s.ContextKey != nil {
 		// add Match to context
 		ctx := req.Context()
@@ -34,14 +38,15 @@ func (s Horizons) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 // MatchHTTPRequest find the Horizon corresponding to an [http.Request] and
 // prepares a [Match] to include in the context.
 func (s Horizons) MatchHTTPRequest(req *http.Request) (*Horizon, Match, bool) {
-	addr, err := HTTPRemoteAddr(req)
+	addr, proxy, err := ForwardedRemoteAddr(req, s.ForwardedHeader, s.TrustedProxies)
 	if err == nil {
-		z, cidr, ok := s.Match(addr)
+		z, cidr, ok := s.MatchRequest(NewHTTPRequest(req, addr))
 		if ok {
 			m := Match{
 				Horizon:    z.n,
 				RemoteAddr: addr,
 				CIDR:       cidr,
+				Proxy:      proxy,
 			}
 			return z, m, true
 		}
@@ -0,0 +1,239 @@
+package horizon
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// noRank marks the absence of a matching entry, and the
+// entries of horizons without ranges
+const noRank = -1
+
+// index is a compiled view of the ranges of all horizons,
+// answering [Horizons.Match] without walking them all.
+//
+// Every range is an entry ranked by the order of the horizons
+// and the order of their ranges. Prefixes are stored on a
+// binary trie per address family, and a lookup walks the
+// bits of the address keeping the best ranked entry found,
+// preserving the first-match semantics of the linear search.
+// When other matchers are involved, every entry found on
+// the walk is a candidate, tried in rank order.
+type index struct {
+	entries []indexEntry
+	anyRank int32
+	any     []int32
+
+	v4 trie
+	v6 trie
+}
+
+// indexEntry identifies a range of a Horizon.
+// r is noRank for horizons without ranges.
+type indexEntry struct {
+	z int32
+	r int32
+}
+
+func newIndex() *index {
+	return &index{
+		anyRank: noRank,
+		v4:      newTrie(),
+		v6:      newTrie(),
+	}
+}
+
+// add appends the ranges of the i-th [Horizon]. Horizons
+// must be added in order.
+func (idx *index) add(i int, z *Horizon) {
+	if len(z.r) == 0 {
+		// any
+		rank := idx.push(i, noRank)
+		if idx.anyRank == noRank {
+			idx.anyRank = rank
+		}
+		idx.any = append(idx.any, rank)
+		return
+	}
+
+	for j, p := range z.r {
+		if !p.IsValid() {
+			// never matches
+			continue
+		}
+
+		rank := idx.push(i, j)
+		if p.Addr().Is4() {
+			idx.v4.insert(p, rank)
+		} else {
+			idx.v6.insert(p, rank)
+		}
+	}
+}
+
+func (idx *index) push(i, j int) int32 {
+	rank := int32(len(idx.entries))
+	idx.entries = append(idx.entries, indexEntry{z: int32(i), r: int32(j)})
+	return rank
+}
+
+// match finds the best ranked entry containing the address
+func (idx *index) match(s []*Horizon, addr netip.Addr) (*Horizon, netip.Prefix, bool) {
+	rank := idx.anyRank
+
+	switch {
+	case !addr.IsValid() || addr.Zone() != "":
+		// only horizons without ranges
+	case addr.Is4():
+		rank = idx.v4.lookup(addr, rank)
+	default:
+		rank = idx.v6.lookup(addr, rank)
+	}
+
+	if rank == noRank {
+		return nil, netip.Prefix{}, false
+	}
+
+	return idx.get(s, rank, addr)
+}
+
+// matchRequest finds the best ranked entry containing the
+// remote address whose [Horizon] accepts the [Request]
+func (idx *index) matchRequest(s []*Horizon, r Request) (*Horizon, netip.Prefix, bool) {
+	var buf [16]int32
+
+	rejected := int32(noRank)
+	for _, rank := range idx.candidates(r.RemoteAddr, buf[:0]) {
+		e := idx.entries[rank]
+		if e.z == rejected {
+			// other range of the same horizon
+			continue
+		}
+
+		z := s[e.z]
+		if z.sel.Accept(r) {
+			return idx.get(s, rank, r.RemoteAddr)
+		}
+		rejected = e.z
+	}
+
+	return nil, netip.Prefix{}, false
+}
+
+// candidates appends the ranks of all entries containing
+// the address, sorted
+func (idx *index) candidates(addr netip.Addr, out []int32) []int32 {
+	out = append(out, idx.any...)
+
+	switch {
+	case !addr.IsValid() || addr.Zone() != "":
+		// only horizons without ranges
+		return out
+	case addr.Is4():
+		out = idx.v4.collect(addr, out)
+	default:
+		out = idx.v6.collect(addr, out)
+	}
+
+	slices.Sort(out)
+	return out
+}
+
+// get returns the [Horizon] and range of an entry
+func (idx *index) get(s []*Horizon, rank int32, addr netip.Addr) (*Horizon, netip.Prefix, bool) {
+	e := idx.entries[rank]
+	z := s[e.z]
+	if e.r == noRank {
+		// any
+		p, _ := z.Match(addr)
+		return z, p, true
+	}
+	return z, z.r[e.r], true
+}
+
+// trie is a binary trie of prefixes stored on a slice.
+// The root is the first node, so a zero child means none.
+type trie struct {
+	nodes []trieNode
+}
+
+// trieNode holds the ranks of the entries of a prefix,
+// sorted as they are inserted in order
+type trieNode struct {
+	child [2]int32
+	ranks []int32
+}
+
+func newTrie() trie {
+	return trie{
+		nodes: []trieNode{{}},
+	}
+}
+
+// insert stores an entry of a prefix
+func (t *trie) insert(p netip.Prefix, rank int32) {
+	b := p.Addr().AsSlice()
+
+	n := int32(0)
+	for i := 0; i < p.Bits(); i++ {
+		bit := addrBit(b, i)
+
+		next := t.nodes[n].child[bit]
+		if next == 0 {
+			next = int32(len(t.nodes))
+			t.nodes = append(t.nodes, trieNode{})
+			t.nodes[n].child[bit] = next
+		}
+		n = next
+	}
+
+	t.nodes[n].ranks = append(t.nodes[n].ranks, rank)
+}
+
+// lookup returns the best rank among the prefixes containing
+// the address, or best if none is better
+func (t *trie) lookup(addr netip.Addr, best int32) int32 {
+	b := addr.AsSlice()
+	bits := len(b) * 8
+
+	n := int32(0)
+	for i := 0; ; i++ {
+		if ranks := t.nodes[n].ranks; len(ranks) > 0 && (best == noRank || ranks[0] < best) {
+			best = ranks[0]
+		}
+
+		if i == bits {
+			return best
+		}
+
+		n = t.nodes[n].child[addrBit(b, i)]
+		if n == 0 {
+			return best
+		}
+	}
+}
+
+// collect appends the ranks of all the prefixes containing
+// the address
+func (t *trie) collect(addr netip.Addr, out []int32) []int32 {
+	b := addr.AsSlice()
+	bits := len(b) * 8
+
+	n := int32(0)
+	for i := 0; ; i++ {
+		out = append(out, t.nodes[n].ranks...)
+
+		if i == bits {
+			return out
+		}
+
+		n = t.nodes[n].child[addrBit(b, i)]
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func addrBit(b []byte, i int) int {
+	return int(b[i/8]>>(7-i%8)) & 1
+}
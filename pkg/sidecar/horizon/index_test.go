@@ -0,0 +1,222 @@
+package horizon
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func randomAddr(rng *rand.Rand, v4 bool) netip.Addr {
+	if v4 {
+		var b [4]byte
+		_, _ = rng.Read(b[:])
+		return netip.AddrFrom4(b)
+	}
+
+	var b [16]byte
+	_, _ = rng.Read(b[:])
+	b[0] = 0x20 // keep addresses close to each other
+	return netip.AddrFrom16(b)
+}
+
+func randomPrefix(rng *rand.Rand) netip.Prefix {
+	v4 := rng.Intn(2) == 0
+	addr := randomAddr(rng, v4)
+
+	bits := 8 + rng.Intn(17)
+	if !v4 {
+		bits = 8 + rng.Intn(57)
+	}
+
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// newTestHorizons creates n horizons of m ranges each, with a
+// horizon without ranges at the end and some ranges repeated.
+// If hosts is set, half of them also require one of those Host headers.
+func newTestHorizons(tb testing.TB, rng *rand.Rand, n, m int, hosts []string) (*Horizons, []netip.Prefix) {
+	var all []netip.Prefix
+	var hcc Configs
+
+	for i := 0; i < n; i++ {
+		hc := Config{Name: fmt.Sprintf("h%v", i)}
+		for j := 0; j < m; j++ {
+			var p netip.Prefix
+			if len(all) > 0 && rng.Intn(10) == 0 {
+				// shadowed
+				p = all[rng.Intn(len(all))]
+			} else {
+				p = randomPrefix(rng)
+			}
+			hc.Ranges = append(hc.Ranges, p)
+			all = append(all, p)
+		}
+		if len(hosts) > 0 && rng.Intn(2) == 0 {
+			hc.Hosts = []string{hosts[rng.Intn(len(hosts))]}
+		}
+		hcc = append(hcc, hc)
+	}
+	if len(hosts) > 0 {
+		hcc = append(hcc, Config{Name: "any-host", Hosts: hosts[:1]})
+	}
+	hcc = append(hcc, Config{Name: "any"})
+
+	s, err := hcc.New(nil, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return s, all
+}
+
+// newTestAddrs returns addresses inside the given prefixes and
+// random ones
+func newTestAddrs(rng *rand.Rand, prefixes []netip.Prefix, n int) []netip.Addr {
+	out := make([]netip.Addr, 0, n)
+	for i := 0; i < n; i++ {
+		var addr netip.Addr
+
+		switch {
+		case i%2 == 0:
+			// inside a prefix
+			p := prefixes[rng.Intn(len(prefixes))]
+			addr = randomAddr(rng, p.Addr().Is4())
+			b, base := addr.AsSlice(), p.Masked().Addr().AsSlice()
+			for k := 0; k < p.Bits(); k++ {
+				mask := byte(0x80) >> (k % 8)
+				b[k/8] = b[k/8]&^mask | base[k/8]&mask
+			}
+			addr, _ = netip.AddrFromSlice(b)
+		default:
+			addr = randomAddr(rng, i%3 == 0)
+		}
+
+		out = append(out, addr)
+	}
+	return out
+}
+
+var testIndexHosts = []string{"a.example.org", "b.example.org", "*.example.net"}
+
+func TestIndexMatch(t *testing.T) {
+	testIndexMatchAddr(t)
+	testIndexMatchRequest(t)
+}
+
+func testIndexMatchAddr(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s, prefixes := newTestHorizons(t, rng, 200, 20, nil)
+
+	addrs := newTestAddrs(rng, prefixes, 50000)
+	addrs = append(addrs,
+		netip.Addr{},
+		netip.MustParseAddr("::ffff:10.0.0.1"),
+		netip.MustParseAddr("fe80::1%eth0"),
+	)
+
+	var hits, failed int
+	for _, addr := range addrs {
+		z1, p1, ok1 := s.Match(addr)
+		z2, p2, ok2 := s.matchLinear(addr)
+
+		switch {
+		case z1 != z2 || p1 != p2 || ok1 != ok2:
+			failed++
+			if failed < 10 {
+				t.Errorf("ERROR: %v: %v %v %v (expected %v %v %v)", addr, z1, p1, ok1, z2, p2, ok2)
+			}
+		case z1 != nil && z1.Name() != "any":
+			hits++
+		}
+	}
+
+	if failed == 0 {
+		t.Logf("%v addresses, %v matching ranges: success", len(addrs), hits)
+	}
+}
+
+func testIndexMatchRequest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s, prefixes := newTestHorizons(t, rng, 200, 20, testIndexHosts)
+	addrs := newTestAddrs(rng, prefixes, 50000)
+
+	var hits, failed int
+	for i, addr := range addrs {
+		r := newTestIndexRequest(addr, i)
+
+		z1, p1, ok1 := s.MatchRequest(r)
+		z2, p2, ok2 := s.matchRequestLinear(r)
+
+		switch {
+		case z1 != z2 || p1 != p2 || ok1 != ok2:
+			failed++
+			if failed < 10 {
+				t.Errorf("ERROR: %v %q: %v %v %v (expected %v %v %v)", addr, r.Host,
+					z1, p1, ok1, z2, p2, ok2)
+			}
+		case z1 != nil && z1.sel != nil:
+			hits++
+		}
+	}
+
+	if failed == 0 {
+		t.Logf("%v requests, %v matching hosts: success", len(addrs), hits)
+	}
+}
+
+func newTestIndexRequest(addr netip.Addr, i int) Request {
+	hosts := []string{"a.example.org", "b.example.org", "www.example.net", "example.com"}
+	return Request{
+		RemoteAddr: addr,
+		Host:       hosts[i%len(hosts)],
+		IsHTTP:     true,
+	}
+}
+
+func benchmarkMatchRequest(b *testing.B, n, m int, linear bool) {
+	rng := rand.New(rand.NewSource(1))
+	s, prefixes := newTestHorizons(b, rng, n, m, testIndexHosts)
+	addrs := newTestAddrs(rng, prefixes, 4096)
+
+	match := s.MatchRequest
+	if linear {
+		match = s.matchRequestLinear
+	}
+
+	reqs := make([]Request, len(addrs))
+	for i, addr := range addrs {
+		reqs[i] = newTestIndexRequest(addr, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _ = match(reqs[i%len(reqs)])
+	}
+}
+
+func benchmarkMatch(b *testing.B, n, m int, linear bool) {
+	rng := rand.New(rand.NewSource(1))
+	s, prefixes := newTestHorizons(b, rng, n, m, nil)
+	addrs := newTestAddrs(rng, prefixes, 4096)
+
+	match := s.Match
+	if linear {
+		match = s.matchLinear
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _ = match(addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	for _, size := range [][2]int{{10, 10}, {100, 20}, {500, 20}} {
+		n, m := size[0], size[1]
+		b.Run(fmt.Sprintf("linear/%vx%v", n, m), func(b *testing.B) { benchmarkMatch(b, n, m, true) })
+		b.Run(fmt.Sprintf("index/%vx%v", n, m), func(b *testing.B) { benchmarkMatch(b, n, m, false) })
+		b.Run(fmt.Sprintf("linear+hosts/%vx%v", n, m), func(b *testing.B) { benchmarkMatchRequest(b, n, m, true) })
+		b.Run(fmt.Sprintf("index+hosts/%vx%v", n, m), func(b *testing.B) { benchmarkMatchRequest(b, n, m, false) })
+	}
+}
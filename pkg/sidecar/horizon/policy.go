@@ -0,0 +1,213 @@
+package horizon
+
+import (
+	"net/http"
+	"sync"
+
+	"darvaza.org/core"
+	"darvaza.org/resolver"
+)
+
+// Names of the built-in policies
+const (
+	PolicyAllow     = "allow"
+	PolicyForbid    = "forbid"
+	PolicyRateLimit = "rate-limit"
+)
+
+// Policy is a set of middleware applied to the entrypoints
+// of a [Horizon]. Either can be nil.
+type Policy struct {
+	Middleware         func(http.Handler) http.Handler
+	ExchangeMiddleware func(resolver.Exchanger) resolver.Exchanger
+}
+
+// PolicyFactory creates a [Policy] using the given options
+type PolicyFactory func(options map[string]string) (*Policy, error)
+
+// PolicyValidator checks the options of a policy without
+// creating it
+type PolicyValidator func(options map[string]string) error
+
+// Registry maps policy names to their [PolicyFactory]
+type Registry struct {
+	mu sync.RWMutex
+	m  map[string]PolicyFactory
+	v  map[string]PolicyValidator
+}
+
+// DefaultRegistry is the [Registry] used when none is specified
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates a [Registry] containing the built-in
+// policies, allow, forbid and rate-limit.
+func NewRegistry() *Registry {
+	r := &Registry{
+		m: make(map[string]PolicyFactory),
+		v: make(map[string]PolicyValidator),
+	}
+
+	r.m[PolicyAllow] = newAllowPolicy
+	r.m[PolicyForbid] = newForbidPolicy
+	r.m[PolicyRateLimit] = newRateLimitPolicy
+
+	r.v[PolicyAllow] = checkNoPolicyOptions
+	r.v[PolicyForbid] = checkNoPolicyOptions
+	r.v[PolicyRateLimit] = checkRateLimitOptions
+	return r
+}
+
+// Register adds a [PolicyFactory]. Names must be unique.
+func (r *Registry) Register(name string, fn PolicyFactory) error {
+	return r.RegisterWithValidator(name, fn, nil)
+}
+
+// RegisterWithValidator adds a [PolicyFactory] and an optional
+// [PolicyValidator] used by [Registry.Validate]. Names must
+// be unique.
+func (r *Registry) RegisterWithValidator(name string, fn PolicyFactory, check PolicyValidator) error {
+	if name == "" || fn == nil {
+		return core.ErrInvalid
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.m[name]; ok {
+		return core.Wrapf(core.ErrExists, "policy %q", name)
+	}
+
+	r.m[name] = fn
+	if check != nil {
+		r.v[name] = check
+	}
+	return nil
+}
+
+// Has tells if a policy is registered
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.m[name]
+	return ok
+}
+
+// Validate checks a policy exists and, if it has a [PolicyValidator],
+// that its options are acceptable. The [Policy] isn't created.
+func (r *Registry) Validate(name string, options map[string]string) error {
+	r.mu.RLock()
+	_, ok := r.m[name]
+	check := r.v[name]
+	r.mu.RUnlock()
+
+	switch {
+	case !ok:
+		return core.Wrapf(core.ErrNotExists, "policy %q", name)
+	case check == nil:
+		return nil
+	}
+
+	if err := check(options); err != nil {
+		return core.Wrapf(err, "policy %q", name)
+	}
+	return nil
+}
+
+// Names returns the sorted names of the registered policies
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return core.SortedKeys(r.m)
+}
+
+// New creates a [Policy] by name
+func (r *Registry) New(name string, options map[string]string) (*Policy, error) {
+	r.mu.RLock()
+	fn, ok := r.m[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, core.Wrapf(core.ErrNotExists, "policy %q", name)
+	}
+
+	p, err := fn(options)
+	if err != nil {
+		return nil, core.Wrapf(err, "policy %q", name)
+	}
+	return p, nil
+}
+
+// RegisterPolicy adds a [PolicyFactory] to the [DefaultRegistry]
+func RegisterPolicy(name string, fn PolicyFactory) error {
+	return DefaultRegistry.Register(name, fn)
+}
+
+// AddPolicy chains the middleware of a [Policy] after the
+// existing ones of the Config.
+func (hc *Config) AddPolicy(p *Policy) {
+	if p == nil {
+		return
+	}
+
+	if fn := p.Middleware; fn != nil {
+		if prev := hc.Middleware; prev != nil {
+			hc.Middleware = func(next http.Handler) http.Handler {
+				return prev(fn(next))
+			}
+		} else {
+			hc.Middleware = fn
+		}
+	}
+
+	if fn := p.ExchangeMiddleware; fn != nil {
+		if prev := hc.ExchangeMiddleware; prev != nil {
+			hc.ExchangeMiddleware = func(next resolver.Exchanger) resolver.Exchanger {
+				return prev(fn(next))
+			}
+		} else {
+			hc.ExchangeMiddleware = fn
+		}
+	}
+}
+
+// checkPolicyOptions rejects options not in the list
+func checkPolicyOptions(options map[string]string, known ...string) error {
+	for _, k := range core.SortedKeys(options) {
+		if !core.SliceContains(known, k) {
+			return core.Wrapf(core.ErrInvalid, "unknown option %q", k)
+		}
+	}
+	return nil
+}
+
+// checkNoPolicyOptions rejects any option
+func checkNoPolicyOptions(options map[string]string) error {
+	return checkPolicyOptions(options)
+}
+
+// newAllowPolicy accepts every request, as horizons do by default
+func newAllowPolicy(options map[string]string) (*Policy, error) {
+	if err := checkNoPolicyOptions(options); err != nil {
+		return nil, err
+	}
+	return &Policy{}, nil
+}
+
+// newForbidPolicy refuses every request
+func newForbidPolicy(options map[string]string) (*Policy, error) {
+	if err := checkNoPolicyOptions(options); err != nil {
+		return nil, err
+	}
+
+	p := &Policy{
+		Middleware: func(http.Handler) http.Handler {
+			return http.HandlerFunc(ForbiddenHTTP)
+		},
+		ExchangeMiddleware: func(resolver.Exchanger) resolver.Exchanger {
+			return resolver.ExchangerFunc(ForbiddenExchange)
+		},
+	}
+	return p, nil
+}
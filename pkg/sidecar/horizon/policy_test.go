@@ -0,0 +1,116 @@
+package horizon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/resolver"
+)
+
+func newTestHeaderPolicy(value string) PolicyFactory {
+	return func(map[string]string) (*Policy, error) {
+		p := &Policy{
+			Middleware: func(next http.Handler) http.Handler {
+				fn := func(rw http.ResponseWriter, req *http.Request) {
+					rw.Header().Add("X-Policy", value)
+					next.ServeHTTP(rw, req)
+				}
+				return http.HandlerFunc(fn)
+			},
+		}
+		return p, nil
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+
+	if err := reg.Register("first", newTestHeaderPolicy("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("second", newTestHeaderPolicy("second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(PolicyForbid, newTestHeaderPolicy("bogus")); err == nil {
+		t.Errorf("ERROR: duplicated policy registered")
+	}
+	if _, err := reg.New("bogus", nil); err == nil {
+		t.Errorf("ERROR: unknown policy created")
+	}
+	if _, err := reg.New(PolicyAllow, map[string]string{"foo": "bar"}); err == nil {
+		t.Errorf("ERROR: unknown option accepted")
+	}
+
+	// validation without creation
+	for _, tc := range []struct {
+		name    string
+		options map[string]string
+		ok      bool
+	}{
+		{"first", nil, true},
+		{"bogus", nil, false},
+		{PolicyForbid, map[string]string{"foo": "bar"}, false},
+		{PolicyRateLimit, map[string]string{"rate": "10", "burst": "20"}, true},
+		{PolicyRateLimit, map[string]string{"rate": "fast"}, false},
+	} {
+		if err := reg.Validate(tc.name, tc.options); (err == nil) != tc.ok {
+			t.Errorf("ERROR: Validate: %s %v: %v", tc.name, tc.options, err)
+		}
+	}
+
+	if !reg.Has("first") || reg.Has("bogus") {
+		t.Errorf("ERROR: Has")
+	}
+
+	names := strings.Join(reg.Names(), ",")
+	if names != "allow,first,forbid,rate-limit,second" {
+		t.Errorf("ERROR: unexpected names: %q", names)
+	}
+
+	// chained in order
+	hc := Config{Name: "chained"}
+	for _, name := range []string{"first", "second"} {
+		p, err := reg.New(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hc.AddPolicy(p)
+	}
+
+	rec := httptest.NewRecorder()
+	hc.New(http.NotFoundHandler(), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	order := strings.Join(rec.Header().Values("X-Policy"), ",")
+	if order != "first,second" {
+		t.Errorf("ERROR: unexpected order: %q", order)
+	} else {
+		t.Logf("%s: success", order)
+	}
+}
+
+func TestRateLimitExchange(t *testing.T) {
+	p, err := DefaultRegistry.New(PolicyRateLimit, map[string]string{"rate": "0.001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := resolver.ExchangerFunc(func(_ context.Context, req *dns.Msg) (*dns.Msg, error) {
+		return new(dns.Msg).SetReply(req), nil
+	})
+	e := p.ExchangeMiddleware(ok)
+
+	req := new(dns.Msg).SetQuestion("example.org.", dns.TypeA)
+	for i, limited := range []bool{false, true} {
+		_, err := e.Exchange(context.Background(), req)
+		if (err != nil) != limited {
+			t.Errorf("ERROR: %v: %v", i, err)
+		} else {
+			t.Logf("%v: success", i)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package horizon
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/core"
+	"darvaza.org/resolver"
+)
+
+// rateLimiter is a token bucket shared by all the requests
+// of a [Horizon]
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimitPolicy limits the requests per second of a Horizon.
+// Options are "rate", required, and "burst", which defaults to
+// the rate rounded up.
+func newRateLimitPolicy(options map[string]string) (*Policy, error) {
+	rl, err := newRateLimiter(options)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{
+		Middleware:         rl.Middleware,
+		ExchangeMiddleware: rl.ExchangeMiddleware,
+	}
+	return p, nil
+}
+
+func newRateLimiter(options map[string]string) (*rateLimiter, error) {
+	rate, burst, err := parseRateLimitOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+	return rl, nil
+}
+
+// checkRateLimitOptions validates the options of a rate-limit policy
+func checkRateLimitOptions(options map[string]string) error {
+	_, _, err := parseRateLimitOptions(options)
+	return err
+}
+
+func parseRateLimitOptions(options map[string]string) (rate, burst float64, err error) {
+	if err := checkPolicyOptions(options, "rate", "burst"); err != nil {
+		return 0, 0, err
+	}
+
+	rate, err = strconv.ParseFloat(options["rate"], 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, 0, core.Wrapf(core.ErrInvalid, "rate: %q", options["rate"])
+	}
+
+	burst = math.Ceil(rate)
+	if s, ok := options["burst"]; ok {
+		n, err := strconv.ParseUint(s, 10, 31)
+		if err != nil || n == 0 {
+			return 0, 0, core.Wrapf(core.ErrInvalid, "burst: %q", s)
+		}
+		burst = float64(n)
+	}
+
+	return rate, burst, nil
+}
+
+// Allow takes a token if available
+func (rl *rateLimiter) Allow() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(rl.last).Seconds()
+	rl.last = now
+
+	rl.tokens = math.Min(rl.burst, rl.tokens+elapsed*rl.rate)
+	if rl.tokens < 1 {
+		return false
+	}
+
+	rl.tokens--
+	return true
+}
+
+// Middleware replies 429 to HTTP requests over the limit
+func (rl *rateLimiter) Middleware(next http.Handler) http.Handler {
+	fn := func(rw http.ResponseWriter, req *http.Request) {
+		if rl.Allow() {
+			next.ServeHTTP(rw, req)
+		} else {
+			TooManyRequestsHTTP(rw, req)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// ExchangeMiddleware refuses DNS requests over the limit
+func (rl *rateLimiter) ExchangeMiddleware(next resolver.Exchanger) resolver.Exchanger {
+	fn := func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+		if rl.Allow() {
+			return next.Exchange(ctx, req)
+		}
+		return ForbiddenExchange(ctx, req)
+	}
+	return resolver.ExchangerFunc(fn)
+}
+
+// TooManyRequestsHTTP is an http.HandlerFunc that always return a 429 error
+func TooManyRequestsHTTP(rw http.ResponseWriter, _ *http.Request) {
+	msg := bytes.NewBufferString("too many requests")
+
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.Header().Set("Retry-After", "1")
+	rw.WriteHeader(http.StatusTooManyRequests)
+	_, _ = msg.WriteTo(rw)
+}
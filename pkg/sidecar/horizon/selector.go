@@ -0,0 +1,258 @@
+package horizon
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/glob"
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+// Request describes what is known about a request when
+// choosing its [Horizon].
+type Request struct {
+	// RemoteAddr is the address of the client
+	RemoteAddr netip.Addr
+	// LocalAddr is the address of the listener
+	// the request arrived at
+	LocalAddr netip.AddrPort
+	// ServerName is the TLS SNI requested by the client
+	ServerName string
+	// Host is the HTTP Host header, without port.
+	// Empty on DNS requests.
+	Host string
+	// Peer is the identity of the client certificate
+	Peer *peer.Identity
+
+	// IsHTTP tells the Host header is known
+	IsHTTP bool
+}
+
+// NewHTTPRequest describes an [http.Request]
+func NewHTTPRequest(req *http.Request, remote netip.Addr) Request {
+	r := Request{
+		RemoteAddr: remote,
+		Host:       hostOnly(req.Host),
+		IsHTTP:     true,
+	}
+
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		r.LocalAddr, _ = core.AddrPort(addr)
+	}
+
+	if req.TLS != nil {
+		r.ServerName = req.TLS.ServerName
+	}
+
+	r.Peer, _ = peer.FromHTTPRequest(req)
+	return r
+}
+
+// NewDNSRequest describes a DNS request
+func NewDNSRequest(rw dns.ResponseWriter, remote netip.Addr) Request {
+	r := Request{
+		RemoteAddr: remote,
+	}
+
+	r.LocalAddr, _ = core.AddrPort(rw.LocalAddr())
+
+	if cs, ok := rw.(dns.ConnectionStater); ok {
+		if tcs := cs.ConnectionState(); tcs != nil {
+			r.ServerName = tcs.ServerName
+		}
+	}
+
+	r.Peer, _ = peer.FromDNSResponseWriter(rw)
+	return r
+}
+
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// selector holds the matchers of a [Horizon] besides the ranges.
+// Every non-empty matcher must accept the [Request], and any
+// entry of a matcher is enough to accept it.
+type selector struct {
+	serverNames []*glob.Glob
+	hosts       []*glob.Glob
+	listeners   []netip.AddrPort
+	peers       []*glob.Glob
+
+	// reject is set when the matchers couldn't be compiled,
+	// so nothing is accepted
+	reject bool
+}
+
+// newSelector compiles the matchers of a [Config], returning nil
+// if it has none.
+func newSelector(hc *Config) (*selector, error) {
+	var err error
+
+	sel := &selector{
+		listeners: hc.Listeners,
+	}
+
+	sel.serverNames, err = compileGlobs("ServerNames", hc.ServerNames, '.')
+	if err != nil {
+		return nil, err
+	}
+
+	sel.hosts, err = compileGlobs("Hosts", hc.Hosts, '.')
+	if err != nil {
+		return nil, err
+	}
+
+	sel.peers, err = compileGlobs("Peers", hc.Peers, '.', '/')
+	if err != nil {
+		return nil, err
+	}
+
+	if sel.isEmpty() {
+		return nil, nil
+	}
+	return sel, nil
+}
+
+func compileGlobs(field string, patterns []string, separators ...rune) ([]*glob.Glob, error) {
+	out := make([]*glob.Glob, 0, len(patterns))
+	for _, s := range patterns {
+		g, err := glob.Compile(strings.ToLower(s), separators...)
+		if err != nil {
+			return nil, core.Wrapf(err, "%s: %q", field, s)
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+func (sel *selector) isEmpty() bool {
+	return len(sel.serverNames) == 0 &&
+		len(sel.hosts) == 0 &&
+		len(sel.listeners) == 0 &&
+		len(sel.peers) == 0
+}
+
+// Accept tells if the [Request] satisfies all matchers.
+// Hosts are only checked on HTTP requests.
+func (sel *selector) Accept(r Request) bool {
+	switch {
+	case sel == nil:
+		return true
+	case sel.reject:
+		return false
+	}
+
+	return sel.acceptListener(r.LocalAddr) &&
+		acceptName(sel.serverNames, r.ServerName) &&
+		(!r.IsHTTP || acceptName(sel.hosts, r.Host)) &&
+		sel.acceptPeer(r.Peer)
+}
+
+func acceptName(globs []*glob.Glob, name string) bool {
+	return len(globs) == 0 || matchAnyGlob(globs, name)
+}
+
+// acceptListener checks the local address. Unspecified addresses
+// and port zero on the matchers act as wildcards.
+func (sel *selector) acceptListener(local netip.AddrPort) bool {
+	switch {
+	case len(sel.listeners) == 0:
+		return true
+	case !local.IsValid():
+		return false
+	}
+
+	for _, ap := range sel.listeners {
+		if listenerOverlaps(ap, local, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptPeer checks the SPIFFE ID, CommonName and DNS SANs of
+// verified client certificates.
+func (sel *selector) acceptPeer(id *peer.Identity) bool {
+	switch {
+	case len(sel.peers) == 0:
+		return true
+	case id == nil, !id.Verified:
+		return false
+	}
+
+	if id.SPIFFEID != nil && matchAnyGlob(sel.peers, id.SPIFFEID.String()) {
+		return true
+	}
+
+	if id.CommonName != "" && matchAnyGlob(sel.peers, id.CommonName) {
+		return true
+	}
+
+	for _, name := range id.DNSNames {
+		if matchAnyGlob(sel.peers, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reachableFrom tells if a listener bound to the given address
+// could satisfy the listener matchers. Unlike Accept, unspecified
+// addresses on the listener side act as wildcards too.
+func (sel *selector) reachableFrom(local netip.AddrPort) bool {
+	switch {
+	case sel == nil:
+		return true
+	case sel.reject:
+		return false
+	case len(sel.listeners) == 0, !local.IsValid():
+		return true
+	}
+
+	for _, ap := range sel.listeners {
+		if listenerOverlaps(ap, local, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func listenerOverlaps(want, local netip.AddrPort, wildLocal bool) bool {
+	if want.Port() != 0 && want.Port() != local.Port() {
+		return false
+	}
+
+	wa, la := want.Addr().Unmap(), local.Addr().Unmap()
+	switch {
+	case !wa.IsValid(), wa.IsUnspecified(), wa == la:
+		return true
+	default:
+		return wildLocal && la.IsUnspecified()
+	}
+}
+
+func matchAnyGlob(globs []*glob.Glob, s string) bool {
+	if s == "" {
+		return false
+	}
+
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package horizon
+
+import (
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+type testSelectorCase struct {
+	name    string
+	req     Request
+	horizon string
+}
+
+func newTestSelectorHorizons(t *testing.T) *Horizons {
+	internal := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	s, err := Configs{
+		{
+			Name:   "partner",
+			Ranges: internal,
+			Peers:  []string{"spiffe://partner.example/**"},
+		},
+		{
+			Name:        "api",
+			ServerNames: []string{"api.example.org"},
+			Hosts:       []string{"*.example.org"},
+		},
+		{
+			Name:      "admin",
+			Listeners: []netip.AddrPort{netip.MustParseAddrPort("127.0.0.1:0")},
+		},
+		{
+			Name:   "internal",
+			Ranges: internal,
+		},
+	}.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestIdentity(spiffe string, verified bool) *peer.Identity {
+	u, _ := url.Parse(spiffe)
+	return &peer.Identity{
+		SPIFFEID: u,
+		Verified: verified,
+	}
+}
+
+func TestMatchRequest(t *testing.T) {
+	s := newTestSelectorHorizons(t)
+
+	internal := netip.MustParseAddr("10.1.2.3")
+	public := netip.MustParseAddr("192.0.2.1")
+	local := netip.MustParseAddrPort("127.0.0.1:8080")
+	partner := "spiffe://partner.example/ns/default/sa/client"
+
+	var cases = []testSelectorCase{
+		{"internal", Request{RemoteAddr: internal}, "internal"},
+		{"partner", Request{RemoteAddr: internal, Peer: newTestIdentity(partner, true)}, "partner"},
+		{"partner unverified", Request{RemoteAddr: internal, Peer: newTestIdentity(partner, false)}, "internal"},
+		{"other peer", Request{RemoteAddr: internal,
+			Peer: newTestIdentity("spiffe://other.example/client", true)}, "internal"},
+		{"api", Request{RemoteAddr: public, ServerName: "API.example.org",
+			Host: "www.example.org", IsHTTP: true}, "api"},
+		{"api dns", Request{RemoteAddr: public, ServerName: "api.example.org"}, "api"},
+		{"api wrong host", Request{RemoteAddr: public, ServerName: "api.example.org",
+			Host: "example.net", IsHTTP: true}, ""},
+		{"api without SNI", Request{RemoteAddr: public, Host: "www.example.org", IsHTTP: true}, ""},
+		{"admin", Request{RemoteAddr: public, LocalAddr: local}, "admin"},
+		{"admin other listener", Request{RemoteAddr: public,
+			LocalAddr: netip.MustParseAddrPort("192.0.2.254:8080")}, ""},
+	}
+
+	for _, tc := range cases {
+		z, _, ok := s.MatchRequest(tc.req)
+
+		var name string
+		if ok {
+			name = z.Name()
+		}
+
+		if name != tc.horizon {
+			t.Errorf("ERROR: %s: %q (expected %q)", tc.name, name, tc.horizon)
+		} else {
+			t.Logf("%s: success", tc.name)
+		}
+	}
+}
+
+func TestSelectorExposed(t *testing.T) {
+	s := newTestSelectorHorizons(t)
+
+	for _, tc := range []struct {
+		local string
+		count int
+	}{
+		{"127.0.0.1:53", 2},
+		{"0.0.0.0:53", 4},
+		{"192.0.2.254:53", 3},
+	} {
+		exposed := s.Exposed(netip.MustParseAddrPort(tc.local))
+		if len(exposed) != tc.count {
+			t.Errorf("ERROR: %s: %v (expected %v horizons)", tc.local, exposed, tc.count)
+		} else {
+			t.Logf("%s: success", tc.local)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	hc := Config{Name: "bad", Hosts: []string{"[example.org"}}
+	if err := hc.Validate(); err == nil {
+		t.Errorf("ERROR: invalid glob accepted")
+	}
+
+	if _, err := NewHorizon(hc, nil, nil); err == nil {
+		t.Errorf("ERROR: invalid Horizon created")
+	}
+
+	var s Horizons
+	if err := s.AppendNew(hc, nil, nil); err == nil {
+		t.Errorf("ERROR: invalid Config appended")
+	}
+
+	// fails closed
+	z := hc.New(nil, nil)
+	if z.Accept(Request{Host: "example.org", IsHTTP: true}) {
+		t.Errorf("ERROR: invalid Config accepts requests")
+	}
+}
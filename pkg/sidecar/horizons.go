@@ -0,0 +1,168 @@
+package sidecar
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"darvaza.org/core"
+	"darvaza.org/resolver"
+	"darvaza.org/resolver/pkg/exdns"
+
+	"darvaza.org/sidecar/pkg/sidecar/horizon"
+)
+
+// HorizonConfig is the serializable description of a horizon.Config
+type HorizonConfig struct {
+	Name   string         `yaml:"name"`
+	Ranges []netip.Prefix `yaml:"ranges,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// ServerNames, Hosts, Listeners and Peers are additional
+	// matchers, see horizon.Config
+	ServerNames []string         `yaml:"server_names,omitempty" toml:",omitempty" json:",omitempty"`
+	Hosts       []string         `yaml:"hosts,omitempty" toml:",omitempty" json:",omitempty"`
+	Listeners   []netip.AddrPort `yaml:"listeners,omitempty" toml:",omitempty" json:",omitempty"`
+	Peers       []string         `yaml:"peers,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// Policies are applied in order to the requests of
+	// the horizon
+	Policies []PolicyConfig `yaml:"policies,omitempty" toml:",omitempty" json:",omitempty"`
+
+	// Resolvers are the upstream DNS servers of the horizon.
+	// If not specified the application's resolver is used.
+	Resolvers []string `yaml:"resolvers,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// PolicyConfig refers to a policy registered on a horizon.Registry,
+// like "allow", "forbid" or "rate-limit".
+type PolicyConfig struct {
+	Name    string            `yaml:"name"`
+	Options map[string]string `yaml:"options,omitempty" toml:",omitempty" json:",omitempty"`
+}
+
+// Export assembles the horizon.Config using the policies of the
+// given horizon.Registry
+func (hc *HorizonConfig) Export(reg *horizon.Registry) (horizon.Config, error) {
+	out := hc.matchers()
+
+	for _, pc := range hc.Policies {
+		p, err := reg.New(pc.Name, pc.Options)
+		if err != nil {
+			return horizon.Config{}, err
+		}
+		out.AddPolicy(p)
+	}
+
+	if len(hc.Resolvers) > 0 {
+		e, err := resolver.NewPoolExchanger(nil, hc.Resolvers...)
+		if err != nil {
+			return horizon.Config{}, core.Wrap(err, "Resolvers")
+		}
+		out.Exchanger = e
+	}
+
+	if err := out.Validate(); err != nil {
+		return horizon.Config{}, err
+	}
+	return out, nil
+}
+
+// Validate checks the HorizonConfig against the policies of the
+// given horizon.Registry, without creating them.
+func (hc *HorizonConfig) Validate(reg *horizon.Registry) error {
+	for _, pc := range hc.Policies {
+		if err := reg.Validate(pc.Name, pc.Options); err != nil {
+			return err
+		}
+	}
+
+	for _, server := range hc.Resolvers {
+		if _, err := exdns.AsServerAddress(server); err != nil {
+			return core.Wrap(err, "Resolvers")
+		}
+	}
+
+	out := hc.matchers()
+	return out.Validate()
+}
+
+func (hc *HorizonConfig) matchers() horizon.Config {
+	return horizon.Config{
+		Name:        hc.Name,
+		Ranges:      hc.Ranges,
+		ServerNames: hc.ServerNames,
+		Hosts:       hc.Hosts,
+		Listeners:   hc.Listeners,
+		Peers:       hc.Peers,
+	}
+}
+
+// HorizonConfigs assembles the horizon.Configs described on the Config,
+// using [Config.Policies] or the horizon.DefaultRegistry.
+func (cfg *Config) HorizonConfigs() (horizon.Configs, error) {
+	out := make(horizon.Configs, 0, len(cfg.Horizons))
+
+	err := cfg.forEachHorizon(func(reg *horizon.Registry, hc *HorizonConfig) error {
+		z, err := hc.Export(reg)
+		if err == nil {
+			out = append(out, z)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// validateHorizons checks the Horizons without assembling them
+func (cfg *Config) validateHorizons() error {
+	return cfg.forEachHorizon(func(reg *horizon.Registry, hc *HorizonConfig) error {
+		return hc.Validate(reg)
+	})
+}
+
+// forEachHorizon calls fn for each HorizonConfig, in order, after
+// checking their names
+func (cfg *Config) forEachHorizon(fn func(*horizon.Registry, *HorizonConfig) error) error {
+	reg := cfg.Policies
+	if reg == nil {
+		reg = horizon.DefaultRegistry
+	}
+
+	names := make(map[string]bool, len(cfg.Horizons))
+	for i := range cfg.Horizons {
+		hc := &cfg.Horizons[i]
+
+		switch {
+		case hc.Name == "":
+			return fmt.Errorf("Horizons[%v]: %s", i, "name required")
+		case names[hc.Name]:
+			return core.Wrapf(core.ErrExists, "Horizons[%v]: %q", i, hc.Name)
+		}
+		names[hc.Name] = true
+
+		if err := fn(reg, hc); err != nil {
+			return core.Wrapf(err, "Horizons[%v]", i)
+		}
+	}
+
+	return nil
+}
+
+// NewHorizons assembles the horizon.Horizons described on the [Config]
+// around the application's entrypoints, traced by the [Server]'s Tracer.
+func (srv *Server) NewHorizons(h http.Handler, e resolver.Exchanger) (*horizon.Horizons, error) {
+	hcc, err := srv.cfg.HorizonConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := hcc.New(h, e)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Tracer = srv.tracer
+	return s, nil
+}
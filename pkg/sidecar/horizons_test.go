@@ -0,0 +1,113 @@
+package sidecar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"darvaza.org/sidecar/pkg/config"
+	"darvaza.org/sidecar/pkg/sidecar/horizon"
+)
+
+const testHorizonsYAML = `
+name: localhost
+horizons:
+  - name: blocked
+    ranges: [192.0.2.0/24]
+    policies:
+      - name: forbid
+  - name: limited
+    ranges: [10.0.0.0/8]
+    resolvers: [127.0.0.1:53]
+    policies:
+      - name: allow
+      - name: rate-limit
+        options:
+          rate: "0.001"
+          burst: "2"
+  - name: public
+`
+
+func newTestHorizonsConfig(t *testing.T) *Config {
+	cfg := new(Config)
+
+	dec := new(config.YAML)
+	if err := dec.Decode(testHorizonsYAML, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestHorizonConfigs(t *testing.T) {
+	cfg := newTestHorizonsConfig(t)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	hcc, err := cfg.HorizonConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	s := hcc.Must(ok, nil)
+
+	for i, tc := range []struct {
+		remote string
+		status int
+	}{
+		{"192.0.2.1:1234", http.StatusForbidden},
+		{"10.0.0.1:1234", http.StatusOK},
+		{"10.0.0.1:1234", http.StatusOK},
+		{"10.0.0.1:1234", http.StatusTooManyRequests},
+		{"198.51.100.1:1234", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("ERROR: %v: %s: %v (expected %v)", i, tc.remote, rec.Code, tc.status)
+		} else {
+			t.Logf("%v: %s: success", i, tc.remote)
+		}
+	}
+}
+
+func TestHorizonConfigsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hc   HorizonConfig
+	}{
+		{"no name", HorizonConfig{}},
+		{"unknown policy", HorizonConfig{Name: "a", Policies: []PolicyConfig{{Name: "bogus"}}}},
+		{"bad option", HorizonConfig{Name: "a", Policies: []PolicyConfig{
+			{Name: horizon.PolicyRateLimit, Options: map[string]string{"rate": "fast"}},
+		}}},
+		{"bad glob", HorizonConfig{Name: "a", Hosts: []string{"[bogus"}}},
+		{"bad resolver", HorizonConfig{Name: "a", Resolvers: []string{"dns.example.org"}}},
+	} {
+		cfg := newTestHorizonsConfig(t)
+		cfg.Horizons = append(cfg.Horizons, tc.hc)
+
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("ERROR: %s: accepted", tc.name)
+		} else {
+			t.Logf("%s: %v: success", tc.name, err)
+		}
+	}
+
+	cfg := newTestHorizonsConfig(t)
+	cfg.Horizons = append(cfg.Horizons, cfg.Horizons[0])
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("ERROR: duplicated horizon accepted")
+	}
+}
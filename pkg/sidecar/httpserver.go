@@ -15,14 +15,15 @@ func (srv *Server) initHTTPServer() error {
 }
 
 func (srv *Server) newHTTPServerConfig() *httpserver.Config {
-	mTLS := srv.cfg.HTTP.MutualTLSOnly
+	hc := &srv.cfg.HTTP
 
 	hsc := &httpserver.Config{
 		Logger:  srv.cfg.Logger,
 		Context: srv.cfg.Context,
 
 		// TLS
-		TLSConfig: srv.newTLSServerConfig(mTLS),
+		TLSConfig:     srv.newTLSServerConfig(hc.HTTPSClientAuth()),
+		QUICTLSConfig: srv.newQUICTLSServerConfig(hc.QUICClientAuthMode()),
 
 		// Addresses
 		Bind: httpserver.BindingConfig{
@@ -31,6 +32,7 @@ func (srv *Server) newHTTPServerConfig() *httpserver.Config {
 			Port:          srv.cfg.HTTP.Port,
 			PortInsecure:  srv.cfg.HTTP.PortInsecure,
 			AllowInsecure: srv.cfg.HTTP.EnableInsecure,
+			ProxyProtocol: srv.cfg.HTTP.ProxyProtocol,
 		},
 
 		// HTTP
@@ -39,8 +41,30 @@ func (srv *Server) newHTTPServerConfig() *httpserver.Config {
 		WriteTimeout:      srv.cfg.HTTP.WriteTimeout,
 		IdleTimeout:       srv.cfg.HTTP.IdleTimeout,
 
+		// DNS over HTTPS
+		EnableDoH: srv.cfg.HTTP.EnableDoH,
+		QueryLog:  srv.newDNSQueryLog(),
+
+		Metrics:         srv.metrics,
+		Tracer:          srv.tracer,
+		AccessLog:       srv.accessLog,
 		GracefulTimeout: srv.cfg.Supervision.GracefulTimeout,
 	}
 
+	if srv.tickets != nil {
+		// QUIC tokens survive upgrades
+		hsc.QUICTokenKey = &srv.tickets.quicToken
+	}
+
+	if c, ok := srv.tls.(TLSConfigurer); ok {
+		// ACME-TLS-ALPN-01
+		c.ConfigureTLS(hsc.TLSConfig)
+	}
+
+	if p, ok := srv.tls.(AcmeHTTP01Provider); ok {
+		// ACME-HTTP-01
+		hsc.AcmeHTTP01 = p.AcmeHTTP01Handler()
+	}
+
 	return hsc
 }
@@ -7,10 +7,18 @@ import (
 	"net/netip"
 	"time"
 
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+
 	"darvaza.org/core"
 	"darvaza.org/slog"
 	"darvaza.org/slog/handlers/discard"
 	"darvaza.org/x/config"
+
+	"darvaza.org/sidecar/pkg/sidecar/accesslog"
+	"darvaza.org/sidecar/pkg/sidecar/dnsserver"
+	"darvaza.org/sidecar/pkg/sidecar/metrics"
+	"darvaza.org/sidecar/pkg/sidecar/tracing"
 )
 
 // Config describes how the [Server] will be assembled
@@ -22,6 +30,14 @@ type Config struct {
 	Bind      BindingConfig
 	TLSConfig *tls.Config
 
+	// QUICTLSConfig is an optional [tls.Config] to be used
+	// on the HTTP/3 listeners instead of TLSConfig.
+	QUICTLSConfig *tls.Config
+
+	// QUICTokenKey is an optional key used to encrypt the QUIC
+	// address validation tokens, allowing them to survive restarts.
+	QUICTokenKey *quic.TokenGeneratorKey
+
 	// AcmeHTTP01 is an optional [http.Handler] that will
 	// receive requests for /.well-known/acme-challenge
 	// with a valid token.
@@ -31,6 +47,31 @@ type Config struct {
 	// against this well-known path.
 	AcmeHTTP01 http.Handler
 
+	// EnableDoH mounts a DNS over HTTPS endpoint at [DoHPath]
+	// on the HTTPS and HTTP/3 servers.
+	EnableDoH bool
+
+	// DNSHandler is an optional [dns.Handler] answering the
+	// DoH queries. If not specified the main handler is used
+	// if it implements [dns.Handler].
+	DNSHandler dns.Handler
+
+	// QueryLog is an optional [dnsserver.QueryLog] logging the
+	// DoH queries and emitting them via dnstap.
+	QueryLog *dnsserver.QueryLog
+
+	// Metrics is an optional [metrics.Metrics] measuring
+	// requests and connections.
+	Metrics *metrics.Metrics
+
+	// Tracer is an optional [tracing.Tracer] starting a span
+	// for every request.
+	Tracer *tracing.Tracer
+
+	// AccessLog is an optional [accesslog.AccessLog] recording
+	// every request.
+	AccessLog *accesslog.AccessLog
+
 	ReadTimeout       time.Duration
 	ReadHeaderTimeout time.Duration
 	WriteTimeout      time.Duration
@@ -63,6 +104,10 @@ func (sc *Config) New(eg *core.ErrGroup) (*Server, error) {
 		return nil, err
 	}
 
+	if err := sc.Bind.Validate(); err != nil {
+		return nil, err
+	}
+
 	if eg == nil {
 		eg = &core.ErrGroup{
 			Parent: sc.Context,
@@ -91,4 +136,28 @@ type BindingConfig struct {
 	// AllowInsecure makes us handle plain HTTP requests
 	// instead of simply redirecting to the HTTPS port.
 	AllowInsecure bool
+
+	// ProxyProtocol lists the trusted sources, like L4 load
+	// balancers, allowed to send PROXY protocol headers on
+	// the TCP listeners.
+	ProxyProtocol []netip.Prefix
+}
+
+// Validate checks the ports don't collide once the defaults
+// are applied.
+func (bc *BindingConfig) Validate() error {
+	port := portOrDefault(bc.Port, DefaultSecurePort)
+	insecure := portOrDefault(bc.PortInsecure, DefaultInsecurePort)
+
+	if (bc.EnableInsecure || bc.AllowInsecure) && port == insecure {
+		return core.Wrapf(core.ErrInvalid, "Port and PortInsecure are both %v", port)
+	}
+	return nil
+}
+
+func portOrDefault(port, def uint16) uint16 {
+	if port == 0 {
+		return def
+	}
+	return port
 }
@@ -0,0 +1,247 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/core"
+)
+
+const (
+	// DoHPath is the path of the DNS over HTTPS endpoint
+	DoHPath = "/dns-query"
+	// DoHContentType is the media type of DNS over HTTPS
+	// requests and responses
+	DoHContentType = "application/dns-message"
+)
+
+var (
+	_ dns.ResponseWriter   = (*dohResponseWriter)(nil)
+	_ dns.ConnectionStater = (*dohResponseWriter)(nil)
+)
+
+// DoHMiddleware adds a DNS over HTTPS (RFC 8484) endpoint at
+// [DoHPath] passing queries to the given [dns.Handler].
+// Requests to other paths are passed to next.
+func DoHMiddleware(next http.Handler, dh dns.Handler) http.Handler {
+	if next == nil {
+		// end of the line.
+		next = http.NotFoundHandler()
+	}
+
+	if dh == nil {
+		// nothing to mount
+		return next
+	}
+
+	fn := func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != DoHPath {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		msg, code := readDoHRequest(req)
+		if msg == nil {
+			http.Error(rw, http.StatusText(code), code)
+			return
+		}
+
+		w := newDoHResponseWriter(req)
+		dh.ServeDNS(w, msg)
+
+		if w.rsp == nil {
+			http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		writeDoHResponse(rw, w.rsp)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// dnsHandler returns the [dns.Handler] to use for DoH requests,
+// if enabled.
+func (srv *Server) dnsHandler(h http.Handler) dns.Handler {
+	if !srv.cfg.EnableDoH {
+		return nil
+	}
+
+	dh := srv.cfg.DNSHandler
+	if dh == nil {
+		// use the main handler if capable
+		dh, _ = h.(dns.Handler)
+	}
+
+	if dh != nil {
+		dh = srv.cfg.QueryLog.Handler("doh", dh)
+		dh = srv.cfg.Metrics.DNSHandler("doh", dh)
+	}
+	return dh
+}
+
+func readDoHRequest(req *http.Request) (*dns.Msg, int) {
+	var b []byte
+	var err error
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		s := req.URL.Query().Get("dns")
+		if s == "" {
+			return nil, http.StatusBadRequest
+		}
+		b, err = base64.RawURLEncoding.DecodeString(s)
+	case http.MethodPost:
+		if req.Header.Get("Content-Type") != DoHContentType {
+			return nil, http.StatusUnsupportedMediaType
+		}
+		b, err = io.ReadAll(io.LimitReader(req.Body, dns.MaxMsgSize+1))
+		if len(b) > dns.MaxMsgSize {
+			return nil, http.StatusRequestEntityTooLarge
+		}
+	default:
+		return nil, http.StatusMethodNotAllowed
+	}
+
+	msg := new(dns.Msg)
+	if err == nil {
+		err = msg.Unpack(b)
+	}
+
+	if err != nil || msg.Response || len(msg.Question) != 1 {
+		return nil, http.StatusBadRequest
+	}
+
+	return msg, http.StatusOK
+}
+
+func writeDoHResponse(rw http.ResponseWriter, rsp *dns.Msg) {
+	b, err := rsp.Pack()
+	if err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	hdr := rw.Header()
+	hdr.Set("Content-Type", DoHContentType)
+	hdr.Set("Content-Length", strconv.Itoa(len(b)))
+	if ttl, ok := DoHMaxAge(rsp); ok {
+		hdr.Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	} else {
+		hdr.Set("Cache-Control", "no-cache")
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(b)
+}
+
+// DoHMaxAge returns the freshness lifetime of a DNS response,
+// the smallest TTL of its records, following RFC 8484 section 5.1.
+// Failed or empty responses shouldn't be cached.
+func DoHMaxAge(rsp *dns.Msg) (uint32, bool) {
+	if rsp.Rcode != dns.RcodeSuccess && rsp.Rcode != dns.RcodeNameError {
+		return 0, false
+	}
+
+	ttl := uint32(math.MaxUint32)
+	found := false
+
+	for _, section := range [][]dns.RR{rsp.Answer, rsp.Ns, rsp.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				// not a record
+				continue
+			}
+
+			ttl = min(ttl, hdr.Ttl)
+			found = true
+		}
+	}
+
+	return ttl, found
+}
+
+// dohResponseWriter is a [dns.ResponseWriter] capturing the response
+// to a DoH request.
+type dohResponseWriter struct {
+	req    *http.Request
+	local  net.Addr
+	remote net.Addr
+	tls    *tls.ConnectionState
+
+	rsp *dns.Msg
+}
+
+func newDoHResponseWriter(req *http.Request) *dohResponseWriter {
+	w := &dohResponseWriter{
+		req: req,
+		tls: req.TLS,
+	}
+
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		w.local = addr
+	}
+
+	if ap, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+		w.remote = net.TCPAddrFromAddrPort(ap)
+	}
+
+	return w
+}
+
+// LocalAddr returns the address of the HTTP server
+func (w *dohResponseWriter) LocalAddr() net.Addr { return w.local }
+
+// RemoteAddr returns the address of the HTTP client
+func (w *dohResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+// HTTPRequest returns the [http.Request] carrying the query,
+// so handlers can identify clients behind reverse proxies.
+func (w *dohResponseWriter) HTTPRequest() *http.Request { return w.req }
+
+// ConnectionState implements the [dns.ConnectionStater] interface
+func (w *dohResponseWriter) ConnectionState() *tls.ConnectionState { return w.tls }
+
+// WriteMsg stores the response
+func (w *dohResponseWriter) WriteMsg(msg *dns.Msg) error {
+	if w.rsp != nil {
+		return core.Wrap(core.ErrInvalid, "response already written")
+	}
+	w.rsp = msg
+	return nil
+}
+
+// Write stores a packed response
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(b); err != nil {
+		return 0, err
+	}
+
+	if err := w.WriteMsg(msg); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close does nothing
+func (*dohResponseWriter) Close() error { return nil }
+
+// TsigStatus returns nil as TSIG isn't supported over DoH
+func (*dohResponseWriter) TsigStatus() error { return nil }
+
+// TsigTimersOnly does nothing
+func (*dohResponseWriter) TsigTimersOnly(bool) {}
+
+// Hijack does nothing
+func (*dohResponseWriter) Hijack() {}
@@ -0,0 +1,155 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/sidecar/pkg/sidecar/dnsserver"
+	"darvaza.org/sidecar/pkg/sidecar/dnstap"
+)
+
+type testDoHCase struct {
+	name   string
+	req    *http.Request
+	status int
+	cache  string
+}
+
+func newTestDoHQuery(t *testing.T) []byte {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.org.", dns.TypeA)
+	msg.Id = 0
+
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("ERROR: Pack: %v", err)
+	}
+	return b
+}
+
+func newTestDoHHandler() dns.Handler {
+	return dns.HandlerFunc(func(rw dns.ResponseWriter, req *dns.Msg) {
+		rsp := new(dns.Msg)
+		rsp.SetReply(req)
+		rsp.Answer = append(rsp.Answer,
+			&dns.A{
+				Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.IPv4(192, 0, 2, 1),
+			},
+			&dns.A{
+				Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(192, 0, 2, 2),
+			})
+		_ = rw.WriteMsg(rsp)
+	})
+}
+
+func TestDoHMiddleware(t *testing.T) {
+	q := newTestDoHQuery(t)
+
+	post := func(ct string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader(q))
+		req.Header.Set("Content-Type", ct)
+		return req
+	}
+
+	var cases = []testDoHCase{
+		{"GET", httptest.NewRequest(http.MethodGet,
+			DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(q), nil), http.StatusOK, "max-age=60"},
+		{"POST", post(DoHContentType), http.StatusOK, "max-age=60"},
+		{"POST text/plain", post("text/plain"), http.StatusUnsupportedMediaType, ""},
+		{"GET no query", httptest.NewRequest(http.MethodGet, DoHPath, nil), http.StatusBadRequest, ""},
+		{"PUT", httptest.NewRequest(http.MethodPut, DoHPath, nil), http.StatusMethodNotAllowed, ""},
+		{"other path", httptest.NewRequest(http.MethodGet, "/foo", nil), http.StatusTeapot, ""},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+	h := DoHMiddleware(next, newTestDoHHandler())
+
+	for _, tc := range cases {
+		testOneDoH(t, h, tc)
+	}
+}
+
+func testOneDoH(t *testing.T, h http.Handler, tc testDoHCase) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tc.req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode != tc.status:
+		t.Errorf("ERROR: %s: status %v (expected %v)", tc.name, res.StatusCode, tc.status)
+	case tc.status != http.StatusOK:
+		t.Logf("%s: success", tc.name)
+	case res.Header.Get("Cache-Control") != tc.cache:
+		t.Errorf("ERROR: %s: Cache-Control %q (expected %q)", tc.name,
+			res.Header.Get("Cache-Control"), tc.cache)
+	default:
+		b, _ := io.ReadAll(res.Body)
+		rsp := new(dns.Msg)
+		if err := rsp.Unpack(b); err != nil || len(rsp.Answer) != 2 {
+			t.Errorf("ERROR: %s: bad response: %v", tc.name, err)
+			return
+		}
+		t.Logf("%s: success", tc.name)
+	}
+}
+
+func TestDoHQueryLog(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	out, err := (&dnstap.Config{File: name}).New()
+	if err != nil {
+		t.Fatalf("ERROR: dnstap: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- out.Run(ctx) }()
+
+	srv := &Server{
+		cfg: Config{
+			EnableDoH:  true,
+			DNSHandler: newTestDoHHandler(),
+			QueryLog:   &dnsserver.QueryLog{Dnstap: out},
+		},
+	}
+
+	q := newTestDoHQuery(t)
+	req := httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader(q))
+	req.Header.Set("Content-Type", DoHContentType)
+
+	h := DoHMiddleware(http.NotFoundHandler(), srv.dnsHandler(nil))
+	testOneDoH(t, h, testDoHCase{"POST", req, http.StatusOK, "max-age=60"})
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ERROR: dnstap: %v", err)
+	}
+
+	data, err := os.ReadFile(name)
+	switch {
+	case err != nil:
+		t.Fatalf("ERROR: ReadFile: %v", err)
+	case bytes.Count(data, q) != 2:
+		// query and response messages
+		t.Errorf("ERROR: query not emitted via dnstap")
+	default:
+		t.Log("dnstap: success")
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"golang.org/x/net/http2"
 
 	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/peer"
 )
 
 // NewHTTPServer creates a new [http.Server].
@@ -21,7 +23,8 @@ func (srv *Server) NewHTTPServer(proto string, addr net.Addr) *http.Server {
 		WriteTimeout:      srv.cfg.WriteTimeout,
 		IdleTimeout:       srv.cfg.IdleTimeout,
 
-		ErrorLog: srv.NewHTTPServerErrorLogger(proto, addr),
+		ErrorLog:  srv.NewHTTPServerErrorLogger(proto, addr),
+		ConnState: srv.cfg.Metrics.HTTPConnState(proto),
 	}
 }
 
@@ -41,17 +44,33 @@ func (srv *Server) NewH2Server(h http.Handler, addr net.Addr) (*http.Server, err
 
 // NewH2Handler returns the [http.Handler] to use on the H2 server.
 func (srv *Server) NewH2Handler(h http.Handler) http.Handler {
+	dh := srv.dnsHandler(h)
 	if h == nil {
 		// no handler implies 404.
 		h = http.NotFoundHandler()
 	}
 
+	// client certificate identity
+	h = peer.Middleware(h)
+
 	// ACME-HTTP-01 handler or 404 for /.well-known/acme-challenge
 	h = AcmeHTTP01Middleware(h, srv.cfg.AcmeHTTP01)
 
+	// DNS over HTTPS at /dns-query
+	h = DoHMiddleware(h, dh)
+
 	// Advertise QUIC
 	h = srv.QUICHeadersMiddleware(h)
 
+	// Trace
+	h = srv.cfg.Tracer.HTTPMiddleware("h2", h)
+
+	// Measure
+	h = srv.cfg.Metrics.HTTPMiddleware("h2", h)
+
+	// Log
+	h = srv.cfg.AccessLog.Middleware("h2", h)
+
 	return h
 }
 
@@ -77,10 +96,14 @@ func (srv *Server) spawnTCP(s *http.Server, proto string, lsn net.Listener, grac
 		core.Panic("unreachable")
 	}
 
+	srv.drained.Add(1)
 	srv.eg.Go(func(_ context.Context) error {
+		defer srv.stopped.Add(1)
+
 		srv.logListening(proto, addr)
 		return s.Serve(lsn)
 	}, func() error {
+		defer srv.drained.Done()
 		srv.logShuttingDown(proto, addr)
 
 		ctx := context.Background()
@@ -45,6 +45,15 @@ func (srv *Server) NewH2CHandler(h http.Handler) http.Handler {
 	// Advertise QUIC
 	h = srv.QUICHeadersMiddleware(h)
 
+	// Trace
+	h = srv.cfg.Tracer.HTTPMiddleware("h2c", h)
+
+	// Measure
+	h = srv.cfg.Metrics.HTTPMiddleware("h2c", h)
+
+	// Log
+	h = srv.cfg.AccessLog.Middleware("h2c", h)
+
 	return h
 }
 
@@ -64,7 +73,7 @@ func (srv *Server) spawnH2C(h http.Handler, listeners []*net.TCPListener, gracef
 	for _, lsn := range listeners {
 		s := srv.NewH2CServer(h, lsn.Addr())
 
-		srv.spawnTCP(s, "h2c", lsn, graceful)
+		srv.spawnTCP(s, "h2c", srv.withProxyProtocol(lsn), graceful)
 	}
 
 	return nil
@@ -2,6 +2,8 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"strings"
@@ -10,6 +12,9 @@ import (
 	"darvaza.org/core"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/logging"
+
+	"darvaza.org/sidecar/pkg/sidecar/peer"
 )
 
 const (
@@ -23,17 +28,17 @@ const (
 )
 
 // asQUICEarlyListeners converts a slice of UDP Listeners into QUIC Listeners.
-func (srv *Server) asQUICEarlyListeners(listeners []*net.UDPConn) ([]*quic.EarlyListener, error) {
-	var out []*quic.EarlyListener
+func (srv *Server) asQUICEarlyListeners(listeners []*net.UDPConn) ([]http3.QUICEarlyListener, error) {
+	var out []http3.QUICEarlyListener
 
 	if l := len(listeners); l > 0 {
 		cfg := srv.NewQUICConfig()
-		tlsConf := srv.NewTLSConfig()
+		tlsConf := srv.NewQUICTLSConfig()
 		tlsConf = http3.ConfigureTLSConfig(tlsConf)
 
-		out = make([]*quic.EarlyListener, l)
+		out = make([]http3.QUICEarlyListener, l)
 		for i, udp := range listeners {
-			lsn, err := quic.ListenEarly(udp, tlsConf, cfg)
+			lsn, err := srv.listenQUIC(udp, tlsConf, cfg)
 			if err != nil {
 				return nil, err
 			}
@@ -44,31 +49,98 @@ func (srv *Server) asQUICEarlyListeners(listeners []*net.UDPConn) ([]*quic.Early
 	return out, nil
 }
 
+// listenQUIC creates a QUIC listener on a UDP socket, using
+// the configured token key if any.
+func (srv *Server) listenQUIC(udp *net.UDPConn, tlsConf *tls.Config,
+	cfg *quic.Config) (http3.QUICEarlyListener, error) {
+	//
+	if srv.cfg.QUICTokenKey == nil {
+		lsn, err := quic.ListenEarly(udp, tlsConf, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return lsn, nil
+	}
+
+	tr := &quic.Transport{
+		Conn:              udp,
+		TokenGeneratorKey: srv.cfg.QUICTokenKey,
+	}
+
+	lsn, err := tr.ListenEarly(tlsConf, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &quicListener{EarlyListener: lsn, tr: tr}, nil
+}
+
+// quicListener is a [quic.EarlyListener] owning its [quic.Transport]
+type quicListener struct {
+	*quic.EarlyListener
+	tr *quic.Transport
+}
+
+// Close closes the listener and its transport
+func (l *quicListener) Close() error {
+	err := l.EarlyListener.Close()
+	_ = l.tr.Close()
+	return err
+}
+
 // NewH3Server creates a new [http3.Server].
-func (*Server) NewH3Server(h http.Handler, addr net.Addr) *http3.Server {
+func (srv *Server) NewH3Server(h http.Handler, addr net.Addr) *http3.Server {
 	if h == nil {
 		h = http.NotFoundHandler()
 	}
 
-	return &http3.Server{
+	h3s := &http3.Server{
 		Addr:    addr.String(),
 		Handler: h,
 	}
+
+	if m := srv.cfg.Metrics; m != nil {
+		h3s.ConnContext = func(ctx context.Context, conn quic.Connection) context.Context {
+			m.ConnOpened("h3")
+			go func() {
+				<-conn.Context().Done()
+				m.ConnClosed("h3")
+			}()
+			return ctx
+		}
+	}
+
+	return h3s
 }
 
 // NewH3Handler returns the [http.Handler] to use on the H3 server.
 func (srv *Server) NewH3Handler(h http.Handler) http.Handler {
+	dh := srv.dnsHandler(h)
 	if h == nil {
 		h = http.NotFoundHandler()
 	}
 
+	// client certificate identity
+	h = peer.Middleware(h)
+
 	// ACME-HTTP-01 handler or 404 for /.well-known/acme-challenge
 	h = AcmeHTTP01Middleware(h, srv.cfg.AcmeHTTP01)
 
+	// DNS over HTTPS at /dns-query
+	h = DoHMiddleware(h, dh)
+
+	// Trace
+	h = srv.cfg.Tracer.HTTPMiddleware("h3", h)
+
+	// Measure
+	h = srv.cfg.Metrics.HTTPMiddleware("h3", h)
+
+	// Log
+	h = srv.cfg.AccessLog.Middleware("h3", h)
+
 	return h
 }
 
-func (srv *Server) spawnH3(h http.Handler, listeners []*quic.EarlyListener, graceful time.Duration) error {
+func (srv *Server) spawnH3(h http.Handler, listeners []http3.QUICEarlyListener, graceful time.Duration) error {
 	h = srv.NewH3Handler(h)
 
 	for _, lsn := range listeners {
@@ -80,7 +152,7 @@ func (srv *Server) spawnH3(h http.Handler, listeners []*quic.EarlyListener, grac
 	return nil
 }
 
-func (srv *Server) spawnQUIC(h3s *http3.Server, lsn *quic.EarlyListener, _ time.Duration) {
+func (srv *Server) spawnQUIC(h3s *http3.Server, lsn http3.QUICEarlyListener, _ time.Duration) {
 	const proto = "h3"
 
 	addr, ok := core.AddrPort(lsn.Addr())
@@ -88,10 +160,14 @@ func (srv *Server) spawnQUIC(h3s *http3.Server, lsn *quic.EarlyListener, _ time.
 		core.Panic("unreachable")
 	}
 
+	srv.drained.Add(1)
 	srv.eg.Go(func(_ context.Context) error {
+		defer srv.stopped.Add(1)
+
 		srv.logListening(proto, addr)
 		return h3s.ServeListener(lsn)
 	}, func() error {
+		defer srv.drained.Done()
 		srv.logShuttingDown(proto, addr)
 		// err := h3s.CloseGracefully(graceful) // not implemented
 		return h3s.Close()
@@ -104,8 +180,24 @@ func (srv *Server) spawnQUIC(h3s *http3.Server, lsn *quic.EarlyListener, _ time.
 
 // NewQUICConfig returns the [quic.Config] to be used on the
 // [http3.Server].
-func (*Server) NewQUICConfig() *quic.Config {
-	return &quic.Config{}
+func (srv *Server) NewQUICConfig() *quic.Config {
+	cfg := &quic.Config{}
+
+	if m := srv.cfg.Metrics; m != nil {
+		// TLS handshake failures
+		cfg.Tracer = func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+			return &logging.ConnectionTracer{
+				ClosedConnection: func(err error) {
+					var te *quic.TransportError
+					if errors.As(err, &te) && te.ErrorCode.IsCryptoError() {
+						m.TLSHandshakeFailed("h3")
+					}
+				},
+			}
+		}
+	}
+
+	return cfg
 }
 
 // SetQUICHeaders appends QUIC's Alt-Svc to the [http.Response] headers.
@@ -4,8 +4,10 @@ package httpserver
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,6 +22,10 @@ type Server struct {
 
 	eg *core.ErrGroup
 	sl *Listeners
+	// drained counts the HTTP servers yet to shut down
+	drained sync.WaitGroup
+	// stopped counts the HTTP servers no longer serving
+	stopped atomic.Int32
 
 	quicAltSvc string
 }
@@ -103,6 +109,21 @@ func (srv *Server) Wait() error {
 	return srv.eg.Wait()
 }
 
+// Healthy is a health check failing once any of the
+// spawned HTTP servers has stopped serving.
+func (srv *Server) Healthy(context.Context) error {
+	if n := srv.stopped.Load(); n > 0 {
+		return fmt.Errorf("%v HTTP servers stopped", n)
+	}
+	return nil
+}
+
+// WaitShutdown blocks until the spawned HTTP servers have
+// shut down, after the cancellation of the [core.ErrGroup].
+func (srv *Server) WaitShutdown() {
+	srv.drained.Wait()
+}
+
 // Close tries to initiate a cancellation
 // if the server is running, and closes all listeners.
 // Errors are ignored.
@@ -3,12 +3,16 @@ package httpserver
 import (
 	"io"
 	"net"
+	"net/netip"
 	"sync/atomic"
 	"syscall"
 
-	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 
+	"darvaza.org/core"
 	"darvaza.org/x/net/bind"
+
+	"darvaza.org/sidecar/pkg/sidecar/proxyproto"
 )
 
 const (
@@ -22,7 +26,7 @@ const (
 type Listeners struct {
 	Secure   []net.Listener
 	Insecure []*net.TCPListener
-	QUIC     []*quic.EarlyListener
+	QUIC     []http3.QUICEarlyListener
 
 	up atomic.Bool
 }
@@ -35,6 +39,47 @@ func (sl *Listeners) Close() error {
 	return nil
 }
 
+// Addresses returns the addresses bound by the [Listeners]
+// grouped by protocol, "h2c", "h2" and "h3".
+func (sl *Listeners) Addresses() map[string][]netip.AddrPort {
+	out := make(map[string][]netip.AddrPort)
+
+	for _, l := range sl.Insecure {
+		appendAddr(out, "h2c", l.Addr())
+	}
+	for _, l := range sl.Secure {
+		appendAddr(out, "h2", l.Addr())
+	}
+	for _, l := range sl.QUIC {
+		appendAddr(out, "h3", l.Addr())
+	}
+
+	return out
+}
+
+func appendAddr(out map[string][]netip.AddrPort, proto string, addr net.Addr) {
+	if ap, ok := core.AddrPort(addr); ok {
+		out[proto] = append(out[proto], ap)
+	}
+}
+
+// Addresses returns the addresses the [Server] is listening
+// grouped by protocol, or nil if it isn't listening.
+// Ports may differ from the [BindingConfig] when PortStrict
+// isn't set.
+func (srv *Server) Addresses() map[string][]netip.AddrPort {
+	if srv.sl == nil {
+		return nil
+	}
+	return srv.sl.Addresses()
+}
+
+// withProxyProtocol wraps a TCP listener to read PROXY protocol
+// headers sent by trusted sources, if any.
+func (srv *Server) withProxyProtocol(lsn net.Listener) net.Listener {
+	return proxyproto.NewListener(lsn, srv.cfg.Bind.ProxyProtocol)
+}
+
 func closeAll[T io.Closer](s []T) {
 	for _, l := range s {
 		_ = l.Close()
@@ -105,7 +150,7 @@ func (srv *Server) newListeners(cfg *BindingConfig, bc *bind.Config) (*Listeners
 	return sl, nil
 }
 
-func (srv *Server) bindTLS(bc *bind.Config) ([]net.Listener, []*quic.EarlyListener, error) {
+func (srv *Server) bindTLS(bc *bind.Config) ([]net.Listener, []http3.QUICEarlyListener, error) {
 	tcp, udp, err := bc.Bind()
 	if err != nil {
 		return nil, nil, err
@@ -19,6 +19,15 @@ func (srv *Server) NewTLSConfig() *tls.Config {
 	return nil
 }
 
+// NewQUICTLSConfig returns the [tls.Config] to be used on
+// the HTTP/3 listeners of the [Server].
+func (srv *Server) NewQUICTLSConfig() *tls.Config {
+	if tc := srv.cfg.QUICTLSConfig; tc != nil {
+		return tc.Clone()
+	}
+	return srv.NewTLSConfig()
+}
+
 // asSecureListeners converts a slice of TCP Listeners into TLS Listeners.
 func (srv *Server) asSecureListeners(listeners []*net.TCPListener) []net.Listener {
 	var out []net.Listener
@@ -28,7 +37,7 @@ func (srv *Server) asSecureListeners(listeners []*net.TCPListener) []net.Listene
 
 		out = make([]net.Listener, l)
 		for i, tcp := range listeners {
-			out[i] = tls.NewListener(tcp, tlsConf)
+			out[i] = tls.NewListener(srv.withProxyProtocol(tcp), tlsConf)
 		}
 	}
 	return out
@@ -13,3 +13,7 @@ func (srv *Server) error(err error) slog.Logger {
 func (srv *Server) warn() slog.Logger {
 	return srv.cfg.Logger.Warn()
 }
+
+func (srv *Server) info() slog.Logger {
+	return srv.cfg.Logger.Info()
+}
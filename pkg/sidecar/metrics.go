@@ -0,0 +1,22 @@
+package sidecar
+
+import (
+	"darvaza.org/sidecar/pkg/sidecar/metrics"
+)
+
+func (srv *Server) initMetrics() error {
+	m := metrics.New()
+	m.Register(metrics.NewGaugeFunc("sidecar_certificate_expiry_days",
+		"Remaining validity of the served certificates.", "name",
+		srv.DaysToExpiry))
+
+	srv.metrics = m
+	return nil
+}
+
+// Metrics returns the instruments of the [Server], served on the
+// admin listener's /metrics, where applications can register
+// their own collectors.
+func (srv *Server) Metrics() *metrics.Metrics {
+	return srv.metrics
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+)
+
+// DNSHandler measures the queries handled by next on the given
+// protocol, "udp", "tcp" or "tcp+tls".
+func (m *Metrics) DNSHandler(proto string, next dns.Handler) dns.Handler {
+	if m == nil {
+		return next
+	}
+
+	return dns.HandlerFunc(func(rw dns.ResponseWriter, req *dns.Msg) {
+		rw, o := observe.DNS(rw)
+		start := time.Now()
+
+		next.ServeDNS(rw, req)
+
+		m.dnsDuration.Observe(time.Since(start).Seconds(), proto, o.Horizon())
+		m.dnsQueries.Inc(proto, rcodeLabel(o), o.Horizon())
+	})
+}
+
+func rcodeLabel(o *observe.Observation) string {
+	rcode, ok := o.Rcode()
+	if !ok {
+		return "NONE"
+	}
+
+	if s, ok := dns.RcodeToString[rcode]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+)
+
+// HTTPMiddleware measures the requests handled by next on the given
+// protocol, "h2c", "h2" or "h3".
+func (m *Metrics) HTTPMiddleware(proto string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw, req, o := observe.HTTP(rw, req)
+		start := time.Now()
+
+		next.ServeHTTP(rw, req)
+
+		m.httpDuration.Observe(time.Since(start).Seconds(), proto, o.Horizon())
+		m.httpRequests.Inc(proto, strconv.Itoa(o.Status()), o.Horizon())
+	})
+}
+
+// HTTPConnState returns a [http.Server.ConnState] hook counting the
+// connections of the given protocol, and the TLS connections
+// closed before completing the handshake.
+func (m *Metrics) HTTPConnState(proto string) func(net.Conn, http.ConnState) {
+	if m == nil {
+		return nil
+	}
+
+	return func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			m.ConnOpened(proto)
+		case http.StateHijacked:
+			m.ConnClosed(proto)
+		case http.StateClosed:
+			m.ConnClosed(proto)
+			if c, ok := conn.(*tls.Conn); ok && !c.ConnectionState().HandshakeComplete {
+				m.TLSHandshakeFailed(proto)
+			}
+		}
+	}
+}
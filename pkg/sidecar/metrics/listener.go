@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+// Listener wraps a [net.Listener] counting its connections on the
+// given protocol, and those closed before completing the TLS
+// handshake if they are [tls.Conn].
+func (m *Metrics) Listener(proto string, lsn net.Listener) net.Listener {
+	if m == nil {
+		return lsn
+	}
+
+	return &listener{Listener: lsn, m: m, proto: proto}
+}
+
+type listener struct {
+	net.Listener
+
+	m     *Metrics
+	proto string
+}
+
+func (lsn *listener) Accept() (net.Conn, error) {
+	c, err := lsn.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	lsn.m.ConnOpened(lsn.proto)
+	if tc, ok := c.(*tls.Conn); ok {
+		return &tlsConn{Conn: tc, l: lsn}, nil
+	}
+	return &conn{Conn: c, l: lsn}, nil
+}
+
+type conn struct {
+	net.Conn
+
+	l    *listener
+	once sync.Once
+}
+
+func (c *conn) Close() error {
+	c.once.Do(func() { c.l.m.ConnClosed(c.l.proto) })
+	return c.Conn.Close()
+}
+
+// tlsConn is a [tls.Conn] counting failed handshakes, and
+// keeping ConnectionState available.
+type tlsConn struct {
+	*tls.Conn
+
+	l    *listener
+	once sync.Once
+}
+
+func (c *tlsConn) Close() error {
+	c.once.Do(func() {
+		c.l.m.ConnClosed(c.l.proto)
+		if !c.Conn.ConnectionState().HandshakeComplete {
+			c.l.m.TLSHandshakeFailed(c.l.proto)
+		}
+	})
+	return c.Conn.Close()
+}
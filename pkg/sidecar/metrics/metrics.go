@@ -0,0 +1,117 @@
+// Package metrics implements the instrumentation of the sidecar
+// servers, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// ContentType is the MIME type of the Prometheus text
+// exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the
+// latency histograms
+var DefaultDurationBuckets = []float64{
+	.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+var _ http.Handler = (*Metrics)(nil)
+
+// Metrics holds the instruments of the HTTP, QUIC and DNS servers
+// and any other [Collector] registered by the application.
+// A nil *Metrics is valid and measures nothing.
+type Metrics struct {
+	mu         sync.Mutex
+	collectors []Collector
+
+	httpRequests *CounterVec
+	httpDuration *HistogramVec
+	dnsQueries   *CounterVec
+	dnsDuration  *HistogramVec
+	connections  *GaugeVec
+	tlsFailures  *CounterVec
+}
+
+// New creates a new [Metrics] with the servers' instruments
+// registered.
+func New() *Metrics {
+	m := &Metrics{
+		httpRequests: NewCounterVec("sidecar_http_requests_total",
+			"HTTP requests handled.", "proto", "code", "horizon"),
+		httpDuration: NewHistogramVec("sidecar_http_request_duration_seconds",
+			"Time spent handling HTTP requests.", nil, "proto", "horizon"),
+		dnsQueries: NewCounterVec("sidecar_dns_queries_total",
+			"DNS queries handled.", "proto", "rcode", "horizon"),
+		dnsDuration: NewHistogramVec("sidecar_dns_query_duration_seconds",
+			"Time spent handling DNS queries.", nil, "proto", "horizon"),
+		connections: NewGaugeVec("sidecar_active_connections",
+			"Connections currently open.", "proto"),
+		tlsFailures: NewCounterVec("sidecar_tls_handshake_failures_total",
+			"Connections closed before completing the TLS handshake.", "proto"),
+	}
+
+	m.Register(m.httpRequests, m.httpDuration,
+		m.dnsQueries, m.dnsDuration,
+		m.connections, m.tlsFailures)
+
+	return m
+}
+
+// Register adds collectors to be rendered by [Metrics.ServeHTTP].
+func (m *Metrics) Register(collectors ...Collector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range collectors {
+		if c != nil {
+			m.collectors = append(m.collectors, c)
+		}
+	}
+}
+
+// WriteText renders all registered collectors
+func (m *Metrics) WriteText(buf *bytes.Buffer) {
+	m.mu.Lock()
+	collectors := m.collectors
+	m.mu.Unlock()
+
+	for _, c := range collectors {
+		c.Collect(buf)
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer
+
+	m.WriteText(&buf)
+
+	rw.Header().Set("Content-Type", ContentType)
+	rw.Header().Set("Cache-Control", "no-store")
+	_, _ = buf.WriteTo(rw)
+}
+
+// ConnOpened counts a new connection of the given protocol
+func (m *Metrics) ConnOpened(proto string) {
+	if m != nil {
+		m.connections.Inc(proto)
+	}
+}
+
+// ConnClosed discounts a connection of the given protocol
+func (m *Metrics) ConnClosed(proto string) {
+	if m != nil {
+		m.connections.Dec(proto)
+	}
+}
+
+// TLSHandshakeFailed counts a failed TLS handshake on the
+// given protocol
+func (m *Metrics) TLSHandshakeFailed(proto string) {
+	if m != nil {
+		m.tlsFailures.Inc(proto)
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+)
+
+type testDNSWriter struct {
+	dns.ResponseWriter
+}
+
+func (testDNSWriter) WriteMsg(*dns.Msg) error { return nil }
+func (testDNSWriter) RemoteAddr() net.Addr    { return &net.UDPAddr{} }
+
+func TestMetrics(t *testing.T) {
+	m := New()
+
+	// HTTP
+	h := m.HTTPMiddleware("h2", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		observe.SetHorizon(req.Context(), "lan")
+		rw.WriteHeader(http.StatusTeapot)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// DNS
+	dh := m.DNSHandler("udp", dns.HandlerFunc(func(rw dns.ResponseWriter, req *dns.Msg) {
+		observe.SetDNSHorizon(rw, "wan")
+		rsp := new(dns.Msg)
+		rsp.SetRcode(req, dns.RcodeRefused)
+		_ = rw.WriteMsg(rsp)
+	}))
+	dh.ServeDNS(testDNSWriter{}, new(dns.Msg).SetQuestion("example.org.", dns.TypeA))
+
+	// Connections
+	m.ConnOpened("tcp+tls")
+	m.ConnOpened("tcp+tls")
+	m.ConnClosed("tcp+tls")
+	m.TLSHandshakeFailed("tcp+tls")
+
+	var buf bytes.Buffer
+	m.WriteText(&buf)
+	out := buf.String()
+
+	for _, s := range []string{
+		"# TYPE sidecar_http_requests_total counter\n",
+		`sidecar_http_requests_total{proto="h2",code="418",horizon="lan"} 2` + "\n",
+		"# TYPE sidecar_http_request_duration_seconds histogram\n",
+		`sidecar_http_request_duration_seconds_bucket{proto="h2",horizon="lan",le="+Inf"} 2` + "\n",
+		`sidecar_http_request_duration_seconds_count{proto="h2",horizon="lan"} 2` + "\n",
+		`sidecar_dns_queries_total{proto="udp",rcode="REFUSED",horizon="wan"} 1` + "\n",
+		`sidecar_active_connections{proto="tcp+tls"} 1` + "\n",
+		`sidecar_tls_handshake_failures_total{proto="tcp+tls"} 1` + "\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("ERROR: missing %q", s)
+		} else {
+			t.Logf("%q: success", strings.TrimSpace(s))
+		}
+	}
+
+	if t.Failed() {
+		t.Log(out)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	h := http.NotFoundHandler()
+	if m.HTTPMiddleware("h2", h) == nil || m.HTTPConnState("h2") != nil {
+		t.Error("ERROR: nil Metrics wrapping")
+	}
+
+	m.ConnOpened("tcp")
+	m.TLSHandshakeFailed("tcp")
+}
@@ -0,0 +1,299 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Collector is a metric, or a family of them, that can be
+// rendered in the Prometheus text exposition format.
+type Collector interface {
+	Collect(buf *bytes.Buffer)
+}
+
+var (
+	_ Collector = (*CounterVec)(nil)
+	_ Collector = (*GaugeVec)(nil)
+	_ Collector = (*HistogramVec)(nil)
+	_ Collector = (*GaugeFunc)(nil)
+)
+
+type series struct {
+	values []string
+	value  float64
+
+	// histograms
+	counts []uint64
+	sum    float64
+}
+
+// metricVec is a family of series of the same metric
+// distinguished by their label values
+type metricVec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	// histograms
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(kind, name, help string, labels []string) *metricVec {
+	return &metricVec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+// with returns the series for the given label values, creating
+// it if needed. Missing values are left empty and extra values
+// ignored. The lock is expected to be held.
+func (v *metricVec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		values = append(values[:0:0], values...)
+		values = append(values, make([]string, len(v.labels))...)[:len(v.labels)]
+	}
+
+	key := strings.Join(values, "\xff")
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+
+	s := &series{
+		values: append([]string{}, values...),
+	}
+	if v.buckets != nil {
+		s.counts = make([]uint64, len(v.buckets))
+	}
+
+	v.series[key] = s
+	return s
+}
+
+func (v *metricVec) update(fn func(*series), values []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fn(v.with(values))
+}
+
+// Collect renders all series sorted by their label values
+func (v *metricVec) Collect(buf *bytes.Buffer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(buf, v.name, v.help, v.kind)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := v.series[k]
+		if v.buckets != nil {
+			v.writeHistogram(buf, s)
+		} else {
+			writeSample(buf, v.name, v.labels, s.values, s.value)
+		}
+	}
+}
+
+func (v *metricVec) writeHistogram(buf *bytes.Buffer, s *series) {
+	var count uint64
+
+	labels := append(v.labels[:len(v.labels):len(v.labels)], "le")
+	for i, le := range v.buckets {
+		count += s.counts[i]
+		values := append(s.values[:len(s.values):len(s.values)], formatFloat(le))
+		writeSample(buf, v.name+"_bucket", labels, values, float64(count))
+	}
+
+	writeSample(buf, v.name+"_sum", v.labels, s.values, s.sum)
+	writeSample(buf, v.name+"_count", v.labels, s.values, float64(count))
+}
+
+// CounterVec is a family of counters
+type CounterVec struct {
+	v *metricVec
+}
+
+// NewCounterVec creates a new [CounterVec] with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: newVec("counter", name, help, labels)}
+}
+
+// Inc increments by one the counter of the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter of the given label values.
+// Negative deltas are ignored.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta > 0 {
+		c.v.update(func(s *series) { s.value += delta }, values)
+	}
+}
+
+// Collect implements the [Collector] interface
+func (c *CounterVec) Collect(buf *bytes.Buffer) { c.v.Collect(buf) }
+
+// GaugeVec is a family of gauges
+type GaugeVec struct {
+	v *metricVec
+}
+
+// NewGaugeVec creates a new [GaugeVec] with the given label names
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: newVec("gauge", name, help, labels)}
+}
+
+// Set sets the gauge of the given label values
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.v.update(func(s *series) { s.value = value }, values)
+}
+
+// Add adds to the gauge of the given label values
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.v.update(func(s *series) { s.value += delta }, values)
+}
+
+// Inc increments by one the gauge of the given label values
+func (g *GaugeVec) Inc(values ...string) { g.Add(1, values...) }
+
+// Dec decrements by one the gauge of the given label values
+func (g *GaugeVec) Dec(values ...string) { g.Add(-1, values...) }
+
+// Collect implements the [Collector] interface
+func (g *GaugeVec) Collect(buf *bytes.Buffer) { g.v.Collect(buf) }
+
+// HistogramVec is a family of histograms
+type HistogramVec struct {
+	v *metricVec
+}
+
+// NewHistogramVec creates a new [HistogramVec] with the given
+// upper bounds and label names. If no buckets are given
+// [DefaultDurationBuckets] are used.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+
+	v := newVec("histogram", name, help, labels)
+	v.buckets = append([]float64{}, buckets...)
+	sort.Float64s(v.buckets)
+	if !math.IsInf(v.buckets[len(v.buckets)-1], 1) {
+		v.buckets = append(v.buckets, math.Inf(1))
+	}
+
+	return &HistogramVec{v: v}
+}
+
+// Observe adds an observation to the histogram of the given
+// label values
+func (h *HistogramVec) Observe(x float64, values ...string) {
+	i := sort.SearchFloat64s(h.v.buckets, x)
+	if i == len(h.v.buckets) {
+		// NaN
+		i--
+	}
+
+	h.v.update(func(s *series) {
+		s.counts[i]++
+		s.sum += x
+	}, values)
+}
+
+// Collect implements the [Collector] interface
+func (h *HistogramVec) Collect(buf *bytes.Buffer) { h.v.Collect(buf) }
+
+// GaugeFunc is a family of gauges computed when collected
+type GaugeFunc struct {
+	name  string
+	help  string
+	label string
+	fn    func() map[string]float64
+}
+
+// NewGaugeFunc creates a [GaugeFunc] calling fn on each
+// collection, using the keys of the returned map as the
+// value of the given label.
+func NewGaugeFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	return &GaugeFunc{
+		name:  name,
+		help:  help,
+		label: label,
+		fn:    fn,
+	}
+}
+
+// Collect implements the [Collector] interface
+func (g *GaugeFunc) Collect(buf *bytes.Buffer) {
+	m := g.fn()
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	writeHeader(buf, g.name, g.help, "gauge")
+	for _, k := range keys {
+		writeSample(buf, g.name, []string{g.label}, []string{k}, m[k])
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, kind string) {
+	if help != "" {
+		buf.WriteString("# HELP " + name + " ")
+		buf.WriteString(strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeSample(buf *bytes.Buffer, name string, labels, values []string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(label + `="`)
+			buf.WriteString(labelValueReplacer.Replace(values[i]))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(value))
+	buf.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
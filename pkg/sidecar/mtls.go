@@ -0,0 +1,155 @@
+package sidecar
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync/atomic"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/x509utils"
+)
+
+// ClientAuthMode describes the client certificates policy
+// of a secure listener
+type ClientAuthMode string
+
+const (
+	// ClientAuthNone doesn't request client certificates
+	ClientAuthNone ClientAuthMode = "none"
+	// ClientAuthRequest requests a client certificate but
+	// doesn't verify it
+	ClientAuthRequest ClientAuthMode = "request"
+	// ClientAuthVerifyIfGiven verifies the client certificate
+	// if one is provided
+	ClientAuthVerifyIfGiven ClientAuthMode = "verify_if_given"
+	// ClientAuthRequire requires a valid client certificate
+	ClientAuthRequire ClientAuthMode = "require"
+)
+
+// IsValid tells if the [ClientAuthMode] is known. Empty is valid
+// and means the default.
+func (m ClientAuthMode) IsValid() bool {
+	switch m {
+	case "", ClientAuthNone, ClientAuthRequest, ClientAuthVerifyIfGiven, ClientAuthRequire:
+		return true
+	default:
+		return false
+	}
+}
+
+// ClientAuthType returns the [tls.ClientAuthType] corresponding
+// to the [ClientAuthMode]
+func (m ClientAuthMode) ClientAuthType() tls.ClientAuthType {
+	switch m {
+	case ClientAuthRequest:
+		return tls.RequestClientCert
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.NoClientCert
+	}
+}
+
+// or returns the [ClientAuthMode] or an alternative if empty
+func (m ClientAuthMode) or(alt ClientAuthMode) ClientAuthMode {
+	if m == "" {
+		return alt
+	}
+	return m
+}
+
+// revive:disable:flag-parameter
+
+// legacyClientAuthMode converts a MutualTLSOnly flag into a [ClientAuthMode]
+func legacyClientAuthMode(mTLS bool) ClientAuthMode {
+	// revive:enable:flag-parameter
+	if mTLS {
+		return ClientAuthRequire
+	}
+	return ClientAuthNone
+}
+
+func (cfg *Config) validateClientAuth() error {
+	for name, m := range map[string]ClientAuthMode{
+		"HTTP.ClientAuth":     cfg.HTTP.ClientAuth,
+		"HTTP.QUICClientAuth": cfg.HTTP.QUICClientAuth,
+		"DNS.ClientAuth":      cfg.DNS.ClientAuth,
+	} {
+		if !m.IsValid() {
+			return fmt.Errorf("%s: %q: %s", name, m, "invalid client auth mode")
+		}
+	}
+	return nil
+}
+
+// HTTPSClientAuth returns the client certificates policy for the HTTPS listeners
+func (hc *HTTPConfig) HTTPSClientAuth() ClientAuthMode {
+	return hc.ClientAuth.or(legacyClientAuthMode(hc.MutualTLSOnly))
+}
+
+// QUICClientAuthMode returns the client certificates policy for the QUIC listeners
+func (hc *HTTPConfig) QUICClientAuthMode() ClientAuthMode {
+	return hc.QUICClientAuth.or(hc.HTTPSClientAuth())
+}
+
+// DoTClientAuth returns the client certificates policy for the DoT listeners
+func (dc *DNSConfig) DoTClientAuth() ClientAuthMode {
+	return dc.ClientAuth.or(legacyClientAuthMode(dc.MutualTLSOnly))
+}
+
+func (srv *Server) initClientCAs() error {
+	fn := srv.cfg.TLS.ClientCAs
+	if fn == "" {
+		// use the Store's
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	err := x509utils.ReadStringPEM(fn, func(_ string, block *pem.Block) bool {
+		if c, _ := x509utils.BlockToCertificate(block); c != nil {
+			pool.AddCert(c)
+		}
+		return false
+	})
+
+	if err != nil {
+		return core.Wrap(err, "ClientCAs")
+	}
+
+	srv.clientCAs = pool
+	return nil
+}
+
+// configureClientCAs sets the pool used to verify client certificates.
+// When the Store's pool is used, it's followed through rotations.
+func (srv *Server) configureClientCAs(tc *tls.Config) {
+	if srv.clientCAs != nil {
+		tc.ClientCAs = srv.clientCAs
+		return
+	}
+
+	var last atomic.Pointer[tls.Config]
+
+	tc.ClientCAs = srv.tls.GetCAPool()
+	tc.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool := srv.tls.GetCAPool()
+		if pool == tc.ClientCAs {
+			// unchanged
+			return nil, nil
+		}
+
+		if c := last.Load(); c != nil && c.ClientCAs == pool {
+			return c, nil
+		}
+
+		c := tc.Clone()
+		c.ClientCAs = pool
+		c.GetConfigForClient = nil
+		last.Store(c)
+		return c, nil
+	}
+}
@@ -0,0 +1,43 @@
+package sidecar
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+type testClientAuthCase struct {
+	cfg   HTTPConfig
+	https tls.ClientAuthType
+	quic  tls.ClientAuthType
+}
+
+func TestClientAuthMode(t *testing.T) {
+	var cases = []testClientAuthCase{
+		{HTTPConfig{}, tls.NoClientCert, tls.NoClientCert},
+		{HTTPConfig{MutualTLSOnly: true}, tls.RequireAndVerifyClientCert, tls.RequireAndVerifyClientCert},
+		{HTTPConfig{MutualTLSOnly: true, ClientAuth: ClientAuthRequest},
+			tls.RequestClientCert, tls.RequestClientCert},
+		{HTTPConfig{ClientAuth: ClientAuthVerifyIfGiven, QUICClientAuth: ClientAuthNone},
+			tls.VerifyClientCertIfGiven, tls.NoClientCert},
+		{HTTPConfig{QUICClientAuth: ClientAuthRequire}, tls.NoClientCert, tls.RequireAndVerifyClientCert},
+	}
+
+	for i, tc := range cases {
+		https := tc.cfg.HTTPSClientAuth().ClientAuthType()
+		quic := tc.cfg.QUICClientAuthMode().ClientAuthType()
+
+		switch {
+		case https != tc.https:
+			t.Errorf("ERROR: %v: HTTPS:%v (expected %v)", i, https, tc.https)
+		case quic != tc.quic:
+			t.Errorf("ERROR: %v: QUIC:%v (expected %v)", i, quic, tc.quic)
+		default:
+			t.Logf("%v: success", i)
+		}
+	}
+
+	cfg := &Config{HTTP: HTTPConfig{ClientAuth: "bogus"}}
+	if err := cfg.validateClientAuth(); err == nil {
+		t.Error("ERROR: validateClientAuth: failed to fail")
+	}
+}
@@ -0,0 +1,78 @@
+package observe
+
+import (
+	"crypto/tls"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	_ dns.ResponseWriter   = (*dnsRecorder)(nil)
+	_ dns.ConnectionStater = (*dnsRecorder)(nil)
+)
+
+// DNS returns the [Observation] of a DNS request. The first
+// middleware to ask wraps the [dns.ResponseWriter] to record
+// the response, inner middleware get the same [Observation]
+// and the [dns.ResponseWriter] unchanged.
+func DNS(rw dns.ResponseWriter) (dns.ResponseWriter, *Observation) {
+	if o, ok := FromDNS(rw); ok {
+		return rw, o
+	}
+
+	rec := &dnsRecorder{ResponseWriter: rw, o: new(Observation)}
+	return rec, rec.o
+}
+
+// FromDNS returns the [Observation] of the DNS request being
+// answered through the given [dns.ResponseWriter].
+func FromDNS(rw dns.ResponseWriter) (*Observation, bool) {
+	for rw != nil {
+		switch w := rw.(type) {
+		case *dnsRecorder:
+			return w.o, true
+		case interface{ Unwrap() dns.ResponseWriter }:
+			// wrapped by another middleware
+			rw = w.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// SetDNSHorizon sets the horizon of the DNS request being
+// answered through the given [dns.ResponseWriter].
+func SetDNSHorizon(rw dns.ResponseWriter, name string) {
+	if o, ok := FromDNS(rw); ok {
+		o.SetHorizon(name)
+	}
+}
+
+// dnsRecorder is a [dns.ResponseWriter] remembering the
+// rcode of the response
+type dnsRecorder struct {
+	dns.ResponseWriter
+	o *Observation
+}
+
+func (rec *dnsRecorder) WriteMsg(msg *dns.Msg) error {
+	if !rec.o.written {
+		rec.o.written = true
+		rec.o.rcode = msg.Rcode
+	}
+	return rec.ResponseWriter.WriteMsg(msg)
+}
+
+// Unwrap returns the original [dns.ResponseWriter]
+func (rec *dnsRecorder) Unwrap() dns.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// ConnectionState implements the [dns.ConnectionStater] interface
+func (rec *dnsRecorder) ConnectionState() *tls.ConnectionState {
+	if cs, ok := rec.ResponseWriter.(dns.ConnectionStater); ok {
+		return cs.ConnectionState()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package observe
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// HTTP returns the [Observation] of an [http.Request]. The first
+// middleware to ask attaches a new one to the request and wraps the
+// [http.ResponseWriter] to record the response, inner middleware get
+// the same [Observation] and their arguments unchanged.
+func HTTP(rw http.ResponseWriter, req *http.Request) (http.ResponseWriter, *http.Request, *Observation) {
+	if o, ok := Get(req.Context()); ok {
+		return rw, req, o
+	}
+
+	o := new(Observation)
+	req = req.WithContext(ctxKey.WithValue(req.Context(), o))
+	return &recorder{ResponseWriter: rw, o: o}, req, o
+}
+
+// recorder is a [http.ResponseWriter] remembering the
+// status code and size of the response
+type recorder struct {
+	http.ResponseWriter
+	o *Observation
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.o.status == 0 && code >= http.StatusOK {
+		// ignoring informational responses
+		rec.o.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.o.status == 0 {
+		rec.o.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.o.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows [http.ResponseController] to reach the
+// original [http.ResponseWriter]
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Flush implements the [http.Flusher] interface
+func (rec *recorder) Flush() {
+	_ = http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Hijack implements the [http.Hijacker] interface
+func (rec *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rec.ResponseWriter).Hijack()
+}
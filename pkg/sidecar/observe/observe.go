@@ -0,0 +1,77 @@
+// Package observe records what is learnt about a request while
+// it's handled, so the access log, metrics and tracing middleware
+// share a single recorder.
+package observe
+
+import (
+	"context"
+	"net/http"
+
+	"darvaza.org/core"
+)
+
+var ctxKey = core.NewContextKey[*Observation]("observe.observation")
+
+// Observation holds the outcome of a request and details only
+// known by inner handlers, like the horizon. A nil *Observation
+// is valid and records nothing.
+type Observation struct {
+	status  int
+	bytes   int64
+	rcode   int
+	written bool
+	horizon string
+}
+
+// Get returns the [Observation] of the request of the given context
+func Get(ctx context.Context) (*Observation, bool) {
+	return ctxKey.Get(ctx)
+}
+
+// SetHorizon sets the horizon of the HTTP request of the given
+// context.
+func SetHorizon(ctx context.Context, name string) {
+	if o, ok := Get(ctx); ok {
+		o.SetHorizon(name)
+	}
+}
+
+// SetHorizon sets the horizon the request was handled by
+func (o *Observation) SetHorizon(name string) {
+	if o != nil {
+		o.horizon = name
+	}
+}
+
+// Horizon returns the horizon the request was handled by, if known
+func (o *Observation) Horizon() string {
+	if o == nil {
+		return ""
+	}
+	return o.horizon
+}
+
+// Status returns the status code of an HTTP response,
+// 200 if not set explicitly.
+func (o *Observation) Status() int {
+	if o == nil || o.status == 0 {
+		return http.StatusOK
+	}
+	return o.status
+}
+
+// Bytes returns the size of the body of an HTTP response
+func (o *Observation) Bytes() int64 {
+	if o == nil {
+		return 0
+	}
+	return o.bytes
+}
+
+// Rcode returns the rcode of a DNS response, if written
+func (o *Observation) Rcode() (int, bool) {
+	if o == nil || !o.written {
+		return 0, false
+	}
+	return o.rcode, true
+}
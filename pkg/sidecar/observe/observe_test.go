@@ -0,0 +1,71 @@
+package observe
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type testDNSWriter struct {
+	dns.ResponseWriter
+}
+
+func (testDNSWriter) WriteMsg(*dns.Msg) error { return nil }
+func (testDNSWriter) RemoteAddr() net.Addr    { return &net.UDPAddr{} }
+
+func newTestMiddleware(out **Observation, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw, req, o := HTTP(rw, req)
+		*out = o
+		next.ServeHTTP(rw, req)
+	})
+}
+
+func TestHTTP(t *testing.T) {
+	var outer, inner *Observation
+
+	h := newTestMiddleware(&outer, newTestMiddleware(&inner,
+		http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			SetHorizon(req.Context(), "lan")
+			rw.WriteHeader(http.StatusCreated)
+			_, _ = rw.Write([]byte("hello"))
+		})))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	switch {
+	case outer == nil || outer != inner:
+		t.Errorf("ERROR: observation not shared")
+	case outer.Status() != http.StatusCreated:
+		t.Errorf("ERROR: status %v", outer.Status())
+	case outer.Bytes() != 5:
+		t.Errorf("ERROR: bytes %v", outer.Bytes())
+	case outer.Horizon() != "lan":
+		t.Errorf("ERROR: horizon %q", outer.Horizon())
+	default:
+		t.Log("success")
+	}
+}
+
+func TestDNS(t *testing.T) {
+	rw, outer := DNS(testDNSWriter{})
+	rw2, inner := DNS(rw)
+
+	SetDNSHorizon(rw2, "wan")
+	req := new(dns.Msg).SetQuestion("example.org.", dns.TypeA)
+	_ = rw2.WriteMsg(new(dns.Msg).SetRcode(req, dns.RcodeRefused))
+
+	rcode, ok := outer.Rcode()
+	switch {
+	case outer != inner || rw != rw2:
+		t.Errorf("ERROR: observation not shared")
+	case !ok || rcode != dns.RcodeRefused:
+		t.Errorf("ERROR: rcode %v %v", rcode, ok)
+	case outer.Horizon() != "wan":
+		t.Errorf("ERROR: horizon %q", outer.Horizon())
+	default:
+		t.Log("success")
+	}
+}
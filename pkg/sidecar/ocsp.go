@@ -0,0 +1,38 @@
+package sidecar
+
+import (
+	"crypto/tls"
+
+	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/ocsp"
+)
+
+func (srv *Server) initOCSP() error {
+	if !srv.cfg.TLS.OCSP.Enabled {
+		return nil
+	}
+
+	oc := &ocsp.Config{
+		Logger:  srv.cfg.Logger,
+		Timeout: srv.cfg.TLS.OCSP.Timeout,
+	}
+
+	st, err := oc.New(srv.tls.GetCertificate)
+	if err != nil {
+		return core.Wrap(err, "OCSP")
+	}
+
+	srv.ocsp = st
+	return nil
+}
+
+// getCertificateFunc returns the function used by the secure
+// listeners to get the certificate to serve, stapling
+// OCSP responses if enabled.
+func (srv *Server) getCertificateFunc() func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if srv.ocsp != nil {
+		return srv.ocsp.GetCertificate
+	}
+	return srv.tls.GetCertificate
+}
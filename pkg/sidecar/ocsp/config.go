@@ -0,0 +1,103 @@
+// Package ocsp implements OCSP stapling for the certificates
+// served by sidecars, and a minimal OCSP responder for tests.
+package ocsp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+const (
+	// DefaultTimeout is how long we wait for an OCSP responder
+	// by default
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetryInterval indicates how long we wait by default
+	// before retrying a failed request
+	DefaultRetryInterval = 5 * time.Minute
+	// DefaultCheckInterval indicates how often the staples are
+	// checked for refresh by default
+	DefaultCheckInterval = time.Minute
+	// DefaultRefreshInterval is used to refresh responses
+	// without NextUpdate
+	DefaultRefreshInterval = time.Hour
+	// DefaultUnusedTTL indicates how long unrequested certificates
+	// are kept by default
+	DefaultUnusedTTL = 24 * time.Hour
+)
+
+// Config describes how the [Stapler] gets OCSP responses
+type Config struct {
+	Logger slog.Logger
+
+	// HTTPClient is used to talk to the OCSP responders
+	HTTPClient *http.Client
+
+	Timeout         time.Duration
+	RetryInterval   time.Duration
+	CheckInterval   time.Duration
+	RefreshInterval time.Duration
+	UnusedTTL       time.Duration
+}
+
+// SetDefaults fills gaps in the [Config]
+func (cfg *Config) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DefaultCheckInterval
+	}
+
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultRefreshInterval
+	}
+
+	if cfg.UnusedTTL <= 0 {
+		cfg.UnusedTTL = DefaultUnusedTTL
+	}
+
+	return nil
+}
+
+// New creates a [Stapler] adding OCSP staples to the certificates
+// returned by the given function.
+func (cfg *Config) New(get func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*Stapler, error) {
+	if get == nil {
+		return nil, core.Wrap(core.ErrInvalid, "GetCertificate not provided")
+	}
+
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	st := &Stapler{
+		cfg:     *cfg,
+		get:     get,
+		entries: make(map[[sha256.Size]byte]*entry),
+		wake:    make(chan struct{}, 1),
+	}
+	return st, nil
+}
@@ -0,0 +1,141 @@
+package ocsp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	xocsp "golang.org/x/crypto/ocsp"
+)
+
+type testPKI struct {
+	key *ecdsa.PrivateKey
+	ca  *x509.Certificate
+	url string
+}
+
+func newTestPKI(t *testing.T, revoked *big.Int) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test OCSP CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, _ := x509.ParseCertificate(der)
+	r := &Responder{
+		Issuer: ca,
+		Key:    key,
+		Status: func(serial *big.Int) (int, time.Time) {
+			if serial.Cmp(revoked) == 0 {
+				return xocsp.Revoked, time.Now().Add(-time.Minute)
+			}
+			return xocsp.Good, time.Time{}
+		},
+	}
+
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+
+	return &testPKI{key: key, ca: ca, url: s.URL}
+}
+
+func (pki *testPKI) issue(t *testing.T, serial int64) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.org"},
+		DNSNames:     []string{"example.org"},
+		OCSPServer:   []string{pki.url},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, pki.ca, key.Public(), pki.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, pki.ca.Raw},
+		PrivateKey:  key,
+	}
+}
+
+func TestStapler(t *testing.T) {
+	pki := newTestPKI(t, big.NewInt(3))
+	good, revoked := pki.issue(t, 2), pki.issue(t, 3)
+
+	cert := good
+	st, err := new(Config).New(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cert, nil
+	})
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, c := range []*tls.Certificate{good, revoked} {
+		cert = c
+		if out, _ := st.GetCertificate(nil); len(out.OCSPStaple) > 0 {
+			t.Error("ERROR: stapled before fetching")
+		}
+	}
+
+	st.Refresh(ctx)
+
+	// good
+	cert = good
+	out, _ := st.GetCertificate(nil)
+	if len(out.OCSPStaple) == 0 {
+		t.Fatal("ERROR: good certificate not stapled")
+	}
+
+	leaf, _ := x509.ParseCertificate(good.Certificate[0])
+	resp, err := xocsp.ParseResponseForCert(out.OCSPStaple, leaf, pki.ca)
+	switch {
+	case err != nil:
+		t.Errorf("ERROR: ParseResponse: %v", err)
+	case resp.Status != xocsp.Good:
+		t.Errorf("ERROR: status: %v", statusString(resp.Status))
+	case len(good.OCSPStaple) > 0:
+		t.Error("ERROR: store's certificate modified")
+	default:
+		t.Log("good: success")
+	}
+
+	// revoked
+	cert = revoked
+	if out, _ := st.GetCertificate(nil); len(out.OCSPStaple) > 0 {
+		t.Error("ERROR: revoked certificate stapled")
+	} else {
+		t.Log("revoked: success")
+	}
+}
@@ -0,0 +1,298 @@
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	xocsp "golang.org/x/crypto/ocsp"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+)
+
+// maxResponseSize is the largest OCSP response accepted
+const maxResponseSize = 64 << 10
+
+// Stapler adds OCSP staples to the served certificates.
+// Responses are fetched in the background by [Stapler.Run] the
+// first time a certificate is served, and refreshed halfway
+// through their validity.
+type Stapler struct {
+	mu  sync.Mutex
+	cfg Config
+
+	get     func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	entries map[[sha256.Size]byte]*entry
+	wake    chan struct{}
+}
+
+// entry is the OCSP state of a served certificate
+type entry struct {
+	leaf   *x509.Certificate
+	issuer *x509.Certificate
+	// skip indicates the certificate can't be stapled
+	skip bool
+
+	// cert is the certificate as returned by the store,
+	// and stapled its copy including the staple
+	cert    *tls.Certificate
+	stapled *tls.Certificate
+
+	staple     []byte
+	nextUpdate time.Time
+	refreshAt  time.Time
+	lastUsed   time.Time
+}
+
+// GetCertificate returns the certificate with its OCSP staple
+// when one is available.
+func (st *Stapler) GetCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := st.get(chi)
+	if err != nil || cert == nil || len(cert.OCSPStaple) > 0 {
+		return cert, err
+	}
+
+	return st.staple(cert, time.Now()), nil
+}
+
+func (st *Stapler) staple(cert *tls.Certificate, now time.Time) *tls.Certificate {
+	if len(cert.Certificate) < 2 {
+		// issuer unknown
+		return cert
+	}
+
+	key := sha256.Sum256(cert.Certificate[0])
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	e, ok := st.entries[key]
+	if !ok {
+		e = newEntry(cert)
+		st.entries[key] = e
+
+		if !e.skip {
+			st.wakeUp()
+		}
+	}
+
+	e.lastUsed = now
+	return e.get(cert, now)
+}
+
+func newEntry(cert *tls.Certificate) *entry {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return &entry{skip: true}
+	}
+
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil || len(leaf.OCSPServer) == 0 {
+		return &entry{skip: true}
+	}
+
+	return &entry{
+		leaf:   leaf,
+		issuer: issuer,
+	}
+}
+
+// get returns the stapled certificate if the staple is still valid
+func (e *entry) get(cert *tls.Certificate, now time.Time) *tls.Certificate {
+	if e.staple == nil || (!e.nextUpdate.IsZero() && now.After(e.nextUpdate)) {
+		return cert
+	}
+
+	if e.cert != cert || e.stapled == nil {
+		c := *cert
+		c.OCSPStaple = e.staple
+
+		e.cert, e.stapled = cert, &c
+	}
+
+	return e.stapled
+}
+
+func (st *Stapler) wakeUp() {
+	select {
+	case st.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run keeps the staples updated until the context is cancelled.
+func (st *Stapler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(st.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		st.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-st.wake:
+		}
+	}
+}
+
+// Refresh fetches the OCSP responses of the served certificates
+// that are new or due for renewal.
+func (st *Stapler) Refresh(ctx context.Context) {
+	for _, e := range st.due(time.Now()) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		st.refresh(ctx, e)
+	}
+}
+
+// due returns the entries needing a new response, forgetting
+// those expired or no longer served.
+func (st *Stapler) due(now time.Time) []*entry {
+	var out []*entry
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for key, e := range st.entries {
+		switch {
+		case now.Sub(e.lastUsed) > st.cfg.UnusedTTL,
+			e.leaf != nil && now.After(e.leaf.NotAfter):
+			delete(st.entries, key)
+		case !e.skip && !e.refreshAt.After(now):
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
+
+func (st *Stapler) refresh(ctx context.Context, e *entry) {
+	resp, der, err := st.request(ctx, e.leaf, e.issuer)
+	now := time.Now()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	switch {
+	case err != nil:
+		e.refreshAt = now.Add(st.cfg.RetryInterval)
+		st.logger(slog.Warn, e, err).Print("failed to get OCSP response")
+	case resp.Status != xocsp.Good:
+		e.staple, e.stapled = nil, nil
+		e.refreshAt = now.Add(st.cfg.RetryInterval)
+		st.logger(slog.Error, e, nil).WithField("status", statusString(resp.Status)).
+			Print("certificate not good according to OCSP")
+	default:
+		e.staple, e.stapled = der, nil
+		e.nextUpdate = resp.NextUpdate
+		e.refreshAt = st.refreshTime(resp, now)
+		st.logger(slog.Debug, e, nil).WithField("next_update", resp.NextUpdate).
+			Print("OCSP response updated")
+	}
+}
+
+// refreshTime returns when a response should be refreshed,
+// halfway through its validity
+func (st *Stapler) refreshTime(resp *xocsp.Response, now time.Time) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return now.Add(st.cfg.RefreshInterval)
+	}
+
+	t := resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+	if t.Before(now) {
+		t = now.Add(st.cfg.RetryInterval)
+	}
+	return t
+}
+
+// request tries the OCSP responders of a certificate in order
+func (st *Stapler) request(ctx context.Context, leaf, issuer *x509.Certificate) (*xocsp.Response, []byte, error) {
+	body, err := xocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, server := range leaf.OCSPServer {
+		var resp *xocsp.Response
+		var der []byte
+
+		resp, der, err = st.post(ctx, server, body, leaf, issuer)
+		if err == nil {
+			return resp, der, nil
+		}
+	}
+
+	return nil, nil, err
+}
+
+func (st *Stapler) post(ctx context.Context, server string, body []byte,
+	leaf, issuer *x509.Certificate) (*xocsp.Response, []byte, error) {
+	//
+	ctx, cancel := context.WithTimeout(ctx, st.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Content-Type", RequestContentType)
+	req.Header.Set("Accept", ResponseContentType)
+
+	res, err := st.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, core.Wrapf(core.ErrInvalid, "%s: HTTP %v", server, res.StatusCode)
+	}
+
+	der, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := xocsp.ParseResponseForCert(der, leaf, issuer)
+	if err != nil {
+		return nil, nil, core.Wrap(err, server)
+	}
+	return resp, der, nil
+}
+
+func (st *Stapler) logger(level slog.LogLevel, e *entry, err error) slog.Logger {
+	l := st.cfg.Logger.WithLevel(level).WithFields(slog.Fields{
+		"subject": e.leaf.Subject.String(),
+		"serial":  e.leaf.SerialNumber.String(),
+	})
+	if err != nil {
+		l = l.WithField(slog.ErrorFieldName, err)
+	}
+	return l
+}
+
+func statusString(status int) string {
+	switch status {
+	case xocsp.Good:
+		return "good"
+	case xocsp.Revoked:
+		return "revoked"
+	case xocsp.Unknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("status:%v", status)
+	}
+}
@@ -0,0 +1,131 @@
+// Package peer provides the identity of clients presenting
+// a certificate on secure listeners
+package peer
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"net/url"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/core"
+)
+
+// SPIFFEScheme is the URI scheme of SPIFFE IDs
+const SPIFFEScheme = "spiffe"
+
+// Identity is the normalized identity of a peer presenting
+// a client certificate.
+type Identity struct {
+	// CommonName is the subject's CN
+	CommonName string
+	// DNSNames are the DNS SANs
+	DNSNames []string
+	// IPAddresses are the IP SANs
+	IPAddresses []netip.Addr
+	// EmailAddresses are the email SANs
+	EmailAddresses []string
+	// URIs are the URI SANs
+	URIs []*url.URL
+	// SPIFFEID is the first spiffe:// URI SAN, if any
+	SPIFFEID *url.URL
+	// Fingerprint is the hex encoded SHA-256 of the certificate
+	Fingerprint string
+	// Verified tells if the certificate was verified against
+	// the client CAs
+	Verified bool
+	// Certificate is the presented leaf certificate
+	Certificate *x509.Certificate
+}
+
+// NewIdentity extracts the [Identity] of a certificate
+func NewIdentity(cert *x509.Certificate) *Identity {
+	if cert == nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	id := &Identity{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       core.SliceCopy(cert.DNSNames),
+		EmailAddresses: core.SliceCopy(cert.EmailAddresses),
+		URIs:           core.SliceCopy(cert.URIs),
+		Fingerprint:    hex.EncodeToString(sum[:]),
+		Certificate:    cert,
+	}
+
+	for _, ip := range cert.IPAddresses {
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			id.IPAddresses = append(id.IPAddresses, addr.Unmap())
+		}
+	}
+
+	for _, u := range cert.URIs {
+		if u.Scheme == SPIFFEScheme {
+			id.SPIFFEID = u
+			break
+		}
+	}
+
+	return id
+}
+
+// FromConnectionState extracts the [Identity] of the peer
+// of a TLS connection, if a certificate was presented.
+func FromConnectionState(cs *tls.ConnectionState) (*Identity, bool) {
+	if cs == nil || len(cs.PeerCertificates) == 0 {
+		return nil, false
+	}
+
+	id := NewIdentity(cs.PeerCertificates[0])
+	id.Verified = len(cs.VerifiedChains) > 0
+	return id, true
+}
+
+// FromHTTPRequest extracts the [Identity] of the peer
+// of an [http.Request]
+func FromHTTPRequest(req *http.Request) (*Identity, bool) {
+	return FromConnectionState(req.TLS)
+}
+
+// FromDNSResponseWriter extracts the [Identity] of the peer
+// of a DNS request
+func FromDNSResponseWriter(rw dns.ResponseWriter) (*Identity, bool) {
+	if cs, ok := rw.(dns.ConnectionStater); ok {
+		return FromConnectionState(cs.ConnectionState())
+	}
+	return nil, false
+}
+
+// Get gets the peer's [Identity] from the context.
+func Get(ctx context.Context) (*Identity, bool) {
+	return idCtxKey.Get(ctx)
+}
+
+// WithIdentity stores the given [Identity] on a sub-context.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return idCtxKey.WithValue(ctx, id)
+}
+
+var idCtxKey = core.NewContextKey[*Identity]("peer.identity")
+
+// Middleware stores the peer's [Identity] in the request's context
+// when a client certificate was presented.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(rw http.ResponseWriter, req *http.Request) {
+		if id, ok := FromHTTPRequest(req); ok {
+			ctx := WithIdentity(req.Context(), id)
+			req = req.WithContext(ctx)
+		}
+
+		next.ServeHTTP(rw, req)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,88 @@
+package peer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		DNSNames:     []string{"client.example.org"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		URIs: []*url.URL{
+			{Scheme: "https", Host: "example.org"},
+			{Scheme: "spiffe", Host: "example.org", Path: "/ns/default/sa/client"},
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestMiddleware(t *testing.T) {
+	var got *Identity
+
+	cert := newTestCertificate(t)
+	h := Middleware(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		got, _ = Get(req.Context())
+	}))
+
+	// plain
+	req := httptest.NewRequest("GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != nil {
+		t.Errorf("ERROR: unexpected identity: %+v", got)
+	}
+
+	// mTLS
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	switch {
+	case got == nil:
+		t.Fatal("ERROR: identity missing")
+	case got.CommonName != "client":
+		t.Errorf("ERROR: CommonName: %q", got.CommonName)
+	case got.SPIFFEID == nil || got.SPIFFEID.String() != "spiffe://example.org/ns/default/sa/client":
+		t.Errorf("ERROR: SPIFFEID: %v", got.SPIFFEID)
+	case len(got.IPAddresses) != 1 || !got.IPAddresses[0].Is4():
+		t.Errorf("ERROR: IPAddresses: %v", got.IPAddresses)
+	case len(got.Fingerprint) != 64:
+		t.Errorf("ERROR: Fingerprint: %q", got.Fingerprint)
+	case !got.Verified:
+		t.Error("ERROR: Verified: false")
+	default:
+		t.Logf("%s: success", got.SPIFFEID)
+	}
+}
@@ -0,0 +1,180 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"darvaza.org/core"
+)
+
+// DefaultTimeout indicates how long we wait by default for the
+// PROXY protocol header once a trusted connection has been accepted
+const DefaultTimeout = 5 * time.Second
+
+var (
+	_ net.Listener = (*Listener)(nil)
+	_ net.Conn     = (*Conn)(nil)
+)
+
+// Listener is a [net.Listener] expecting a PROXY protocol header
+// on every connection coming from a trusted source. Connections
+// from other sources are passed through untouched.
+type Listener struct {
+	net.Listener
+
+	trusted []netip.Prefix
+	timeout time.Duration
+}
+
+// NewListener wraps a [net.Listener] to read PROXY protocol headers
+// from the given trusted sources. If none are given the listener
+// is returned unchanged.
+func NewListener(lsn net.Listener, trusted []netip.Prefix) net.Listener {
+	if lsn == nil || len(trusted) == 0 {
+		return lsn
+	}
+
+	return &Listener{
+		Listener: lsn,
+		trusted:  trusted,
+		timeout:  DefaultTimeout,
+	}
+}
+
+// Accept waits for the next connection. The header is read
+// on first use of the returned [net.Conn] so Accept never
+// blocks on slow clients.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.IsTrusted(conn.RemoteAddr()) {
+		// not from a balancer
+		return conn, nil
+	}
+
+	return &Conn{Conn: conn, timeout: l.timeout}, nil
+}
+
+// IsTrusted tells if a remote address is allowed to send
+// PROXY protocol headers
+func (l *Listener) IsTrusted(addr net.Addr) bool {
+	ap, ok := core.AddrPort(addr)
+	if !ok {
+		return false
+	}
+
+	ip := ap.Addr().Unmap()
+	for _, p := range l.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a [net.Conn] whose addresses are those conveyed
+// by the PROXY protocol header
+type Conn struct {
+	net.Conn
+
+	once     sync.Once
+	timeout  time.Duration
+	deadline atomic.Int64 // read deadline set by the user, in UnixNano
+	r        *bufio.Reader
+	hdr      *Header
+	err      error
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			// the header timeout doesn't extend the user's deadline
+			restore := c.readDeadline()
+			deadline := time.Now().Add(c.timeout)
+			if !restore.IsZero() && restore.Before(deadline) {
+				deadline = restore
+			}
+
+			_ = c.Conn.SetReadDeadline(deadline)
+			defer func() { _ = c.Conn.SetReadDeadline(restore) }()
+		}
+
+		c.r = bufio.NewReader(c.Conn)
+		c.hdr, c.err = ReadHeader(c.r)
+	})
+}
+
+func (c *Conn) readDeadline() time.Time {
+	if ns := c.deadline.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+func (c *Conn) storeDeadline(t time.Time) {
+	if t.IsZero() {
+		c.deadline.Store(0)
+	} else {
+		c.deadline.Store(t.UnixNano())
+	}
+}
+
+// SetDeadline sets the read and write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.storeDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.storeDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Header returns the PROXY protocol header received,
+// reading it if needed.
+func (c *Conn) Header() (*Header, error) {
+	c.init()
+	return c.hdr, c.err
+}
+
+// Read reads data after the PROXY protocol header
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client's address as told by the
+// balancer, or the balancer's if it wasn't shared.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.hdr != nil && c.hdr.Source.IsValid() {
+		return tcpAddr(c.hdr.Source)
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to as
+// told by the balancer, or ours if it wasn't shared.
+func (c *Conn) LocalAddr() net.Addr {
+	c.init()
+	if c.hdr != nil && c.hdr.Destination.IsValid() {
+		return tcpAddr(c.hdr.Destination)
+	}
+	return c.Conn.LocalAddr()
+}
+
+// Unwrap returns the underlying [net.Conn]
+func (c *Conn) Unwrap() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,189 @@
+// Package proxyproto implements the receiving side of the
+// PROXY protocol, versions 1 and 2, on stream listeners placed
+// behind L4 load balancers.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"darvaza.org/core"
+)
+
+// v2Signature starts every PROXY protocol v2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// v1MaxLength is the longest v1 header allowed, CRLF included
+	v1MaxLength = 107
+
+	v2HeaderLength = 16
+	v2Version      = 0x20
+	v2CmdLocal     = 0x00
+	v2CmdProxy     = 0x01
+
+	v2FamilyInet  = 0x10
+	v2FamilyInet6 = 0x20
+	v2TransStream = 0x01
+)
+
+// Header is the information conveyed by a PROXY protocol
+// header. Source and Destination are invalid when the balancer
+// didn't share them, like on health checks.
+type Header struct {
+	Version     int
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+}
+
+// ReadHeader reads a PROXY protocol header of either version.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	sig, err := r.Peek(len(v2Signature))
+	switch {
+	case err != nil:
+		return nil, err
+	case bytes.Equal(sig, v2Signature):
+		return readHeaderV2(r)
+	case bytes.HasPrefix(sig, []byte("PROXY ")):
+		return readHeaderV1(r)
+	default:
+		return nil, errInvalid("no header")
+	}
+}
+
+func readHeaderV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+
+	for len(line) < v1MaxLength {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, c)
+		if c == '\n' {
+			return parseHeaderV1(string(line))
+		}
+	}
+
+	return nil, errInvalid("v1 header too long")
+}
+
+func parseHeaderV1(line string) (*Header, error) {
+	line, ok := strings.CutSuffix(line, "\r\n")
+	if !ok {
+		return nil, errInvalid("v1 header not terminated by CRLF")
+	}
+
+	fields := strings.Split(line, " ")
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		// addresses not shared
+		return &Header{Version: 1}, nil
+	case len(fields) != 6:
+		return nil, errInvalid("bad v1 header")
+	case fields[1] != "TCP4" && fields[1] != "TCP6":
+		return nil, errInvalid("bad v1 protocol")
+	}
+
+	src, err1 := parseAddrPortV1(fields[2], fields[4])
+	dst, err2 := parseAddrPortV1(fields[3], fields[5])
+	if err := core.CoalesceError(err1, err2); err != nil {
+		return nil, err
+	}
+
+	if src.Addr().Is4() != (fields[1] == "TCP4") {
+		return nil, errInvalid("v1 address family mismatch")
+	}
+
+	return &Header{Version: 1, Source: src, Destination: dst}, nil
+}
+
+func parseAddrPortV1(addr, port string) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, errInvalid("bad v1 address")
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, errInvalid("bad v1 port")
+	}
+
+	return netip.AddrPortFrom(ip, uint16(p)), nil
+}
+
+func readHeaderV2(r *bufio.Reader) (*Header, error) {
+	var hdr [v2HeaderLength]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	verCmd, family := hdr[12], hdr[13]
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case verCmd&0xf0 != v2Version:
+		return nil, errInvalid("bad v2 version")
+	case verCmd&0x0f == v2CmdLocal:
+		// health check by the balancer itself
+		return &Header{Version: 2}, nil
+	case verCmd&0x0f != v2CmdProxy:
+		return nil, errInvalid("bad v2 command")
+	}
+
+	return parseAddressesV2(family, payload)
+}
+
+func parseAddressesV2(family byte, b []byte) (*Header, error) {
+	h := &Header{Version: 2}
+
+	if family&0x0f != v2TransStream {
+		// not TCP, addresses ignored
+		return h, nil
+	}
+
+	var size int
+	switch family & 0xf0 {
+	case v2FamilyInet:
+		size = 4
+	case v2FamilyInet6:
+		size = 16
+	default:
+		// UNSPEC or UNIX, addresses ignored
+		return h, nil
+	}
+
+	// source, destination and both ports
+	if len(b) < 2*size+4 {
+		return nil, errInvalid("v2 addresses truncated")
+	}
+
+	src, _ := netip.AddrFromSlice(b[:size])
+	dst, _ := netip.AddrFromSlice(b[size : 2*size])
+	sport := binary.BigEndian.Uint16(b[2*size:])
+	dport := binary.BigEndian.Uint16(b[2*size+2:])
+
+	h.Source = netip.AddrPortFrom(src, sport)
+	h.Destination = netip.AddrPortFrom(dst, dport)
+	return h, nil
+}
+
+func errInvalid(reason string) error {
+	return core.Wrap(core.ErrInvalid, "proxyproto: "+reason)
+}
+
+// tcpAddr converts a valid [netip.AddrPort] into a [net.TCPAddr]
+func tcpAddr(ap netip.AddrPort) net.Addr {
+	return net.TCPAddrFromAddrPort(ap)
+}
@@ -0,0 +1,127 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+type testReadHeaderCase struct {
+	name   string
+	input  string
+	ok     bool
+	source string
+}
+
+func newV2Header(cmd, family byte, addrs []byte) string {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, v2Version|cmd, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(addrs)))
+	return string(append(b, addrs...))
+}
+
+func newV2Inet(src, dst netip.AddrPort) []byte {
+	var b []byte
+	b = append(b, src.Addr().AsSlice()...)
+	b = append(b, dst.Addr().AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	return binary.BigEndian.AppendUint16(b, dst.Port())
+}
+
+func TestReadHeader(t *testing.T) {
+	src4 := netip.MustParseAddrPort("192.0.2.1:56324")
+	dst4 := netip.MustParseAddrPort("198.51.100.1:443")
+	src6 := netip.MustParseAddrPort("[2001:db8::1]:56324")
+	dst6 := netip.MustParseAddrPort("[2001:db8::2]:443")
+
+	var cases = []testReadHeaderCase{
+		{"v1 TCP4", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", true, src4.String()},
+		{"v1 TCP6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", true, src6.String()},
+		{"v1 UNKNOWN", "PROXY UNKNOWN\r\n", true, "invalid AddrPort"},
+		{"v1 mismatch", "PROXY TCP6 192.0.2.1 198.51.100.1 56324 443\r\n", false, ""},
+		{"v1 no CRLF", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n", false, ""},
+		{"v1 bad port", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 99999\r\n", false, ""},
+		{"v1 too long", "PROXY " + strings.Repeat("X", 200) + "\r\n", false, ""},
+		{"v2 TCP4", newV2Header(v2CmdProxy, v2FamilyInet|v2TransStream, newV2Inet(src4, dst4)), true, src4.String()},
+		{"v2 TCP6", newV2Header(v2CmdProxy, v2FamilyInet6|v2TransStream, newV2Inet(src6, dst6)), true, src6.String()},
+		{"v2 LOCAL", newV2Header(v2CmdLocal, 0, nil), true, "invalid AddrPort"},
+		{"v2 truncated", newV2Header(v2CmdProxy, v2FamilyInet|v2TransStream, []byte{1, 2, 3}), false, ""},
+		{"no header", "GET / HTTP/1.1\r\nHost: example.org\r\n\r\n", false, ""},
+	}
+
+	for _, tc := range cases {
+		hdr, err := ReadHeader(bufio.NewReader(strings.NewReader(tc.input)))
+		switch {
+		case err != nil && tc.ok:
+			t.Errorf("ERROR: %s: %v", tc.name, err)
+		case err == nil && !tc.ok:
+			t.Errorf("ERROR: %s: failed to fail", tc.name)
+		case err == nil && hdr.Source.String() != tc.source:
+			t.Errorf("ERROR: %s: %q (expected %q)", tc.name, hdr.Source, tc.source)
+		default:
+			t.Logf("%s: success", tc.name)
+		}
+	}
+}
+
+type testListenerCase struct {
+	name    string
+	trusted string
+	remote  string
+	data    string
+}
+
+func TestListener(t *testing.T) {
+	const header = "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+
+	var cases = []testListenerCase{
+		{"trusted", "127.0.0.0/8", "192.0.2.1:56324", "hello"},
+		{"untrusted", "10.0.0.0/8", "127.0.0.1", header + "hello"},
+	}
+
+	for _, tc := range cases {
+		testOneListener(t, header, tc)
+	}
+}
+
+func testOneListener(t *testing.T, header string, tc testListenerCase) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lsn := NewListener(tcp, []netip.Prefix{netip.MustParsePrefix(tc.trusted)})
+	defer lsn.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", tcp.Addr().String())
+		if err == nil {
+			_, _ = c.Write([]byte(header + "hello"))
+			_ = c.Close()
+		}
+	}()
+
+	conn, err := lsn.Accept()
+	if err != nil {
+		t.Fatalf("ERROR: %s: Accept: %v", tc.name, err)
+	}
+	defer conn.Close()
+
+	remote := conn.RemoteAddr().String()
+	data, err := io.ReadAll(conn)
+
+	switch {
+	case err != nil:
+		t.Errorf("ERROR: %s: Read: %v", tc.name, err)
+	case !strings.HasPrefix(remote, tc.remote):
+		t.Errorf("ERROR: %s: RemoteAddr %q (expected %q)", tc.name, remote, tc.remote)
+	case string(data) != tc.data:
+		t.Errorf("ERROR: %s: data %q (expected %q)", tc.name, data, tc.data)
+	default:
+		t.Logf("%s: success", tc.name)
+	}
+}
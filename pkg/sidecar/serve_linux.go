@@ -22,6 +22,11 @@ func (srv *Server) ListenAndServe(app http.Handler) error {
 		return err
 	}
 
+	// Session ticket keys from the previous process
+	if err := srv.inheritSessionTickets(upg.Fds); err != nil {
+		srv.error(err).Println("failed to inherit session ticket keys")
+	}
+
 	// Prepare Server
 	if app == nil {
 		app = http.NotFoundHandler()
@@ -78,14 +83,14 @@ func (srv *Server) onSIGHUP(upg *tableflip.Upgrader, app http.Handler) {
 		if err := r.Reload(); err != nil {
 			srv.error(err).Println("reload failed")
 		}
-	} else if err := upg.Upgrade(); err != nil {
+	} else if err := srv.upgrade(upg); err != nil {
 		srv.error(err).Println("upgrade failed")
 	}
 }
 
 func (srv *Server) onSIGUSR2(upg *tableflip.Upgrader, _ http.Handler) {
 	// attempt to upgrade on SIGUSR2
-	if err := upg.Upgrade(); err != nil {
+	if err := srv.upgrade(upg); err != nil {
 		srv.error(err).Println("upgrade failed")
 	}
 }
@@ -40,14 +40,21 @@ func (srv *Server) ListenWithUpgrader(upg bind.Upgrader) error {
 // ListenWithListener listens to all needed ports using a net.ListenerConfig
 // context
 func (srv *Server) ListenWithListener(lc bind.TCPUDPListener) error {
-	err := srv.hs.ListenWithListener(lc)
+	err := srv.listenAdmin(lc)
 	if err != nil {
 		return err
 	}
 
+	err = srv.hs.ListenWithListener(lc)
+	if err != nil {
+		srv.closeAdmin()
+		return err
+	}
+
 	err = srv.ds.ListenWithListener(lc)
 	if err != nil {
 		_ = srv.hs.Close()
+		srv.closeAdmin()
 		return err
 	}
 
@@ -2,11 +2,19 @@
 package sidecar
 
 import (
+	"crypto/x509"
+	"sync/atomic"
+
 	"darvaza.org/core"
 	"darvaza.org/darvaza/shared/storage"
 
+	"darvaza.org/sidecar/pkg/sidecar/accesslog"
 	"darvaza.org/sidecar/pkg/sidecar/dnsserver"
+	"darvaza.org/sidecar/pkg/sidecar/dnstap"
 	"darvaza.org/sidecar/pkg/sidecar/httpserver"
+	"darvaza.org/sidecar/pkg/sidecar/metrics"
+	"darvaza.org/sidecar/pkg/sidecar/ocsp"
+	"darvaza.org/sidecar/pkg/sidecar/tracing"
 )
 
 // Server is the HTTP Server of the sidecar
@@ -14,9 +22,22 @@ type Server struct {
 	cfg Config
 	eg  core.ErrGroup
 
-	tls storage.Store
-	hs  *httpserver.Server
-	ds  *dnsserver.Server
+	ready   atomic.Bool
+	hc      healthChecks
+	admin   *adminServer
+	exposer atomic.Value // HorizonExposer
+
+	tls       storage.Store
+	clientCAs *x509.CertPool
+	ocsp      *ocsp.Stapler
+	tickets   *ticketKeys
+	metrics   *metrics.Metrics
+	tracer    *tracing.Tracer
+	accessLog *accesslog.AccessLog
+	dnstap    *dnstap.Output
+	em        expiryMonitor
+	hs        *httpserver.Server
+	ds        *dnsserver.Server
 }
 
 // New creates a new HTTP [Server] using the given [Config]
@@ -36,17 +57,8 @@ func New(cfg *Config) (*Server, error) {
 		return nil, err
 	}
 
-	// TLS
-	s := cfg.Store
-	if s == nil {
-		s, err = newFallbackTLSStore()
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	// and continue
-	return cfg.newServer(s)
+	return cfg.newServer(cfg.Store)
 }
 
 // New creates a new Server from the Config
@@ -82,8 +94,17 @@ func (cfg *Config) newServer(s storage.Store) (*Server, error) {
 func (srv *Server) init() error {
 	for _, fn := range []func() error{
 		srv.initAddresses,
+		srv.initTLS,
+		srv.initClientCAs,
+		srv.initOCSP,
+		srv.initSessionTickets,
+		srv.initMetrics,
+		srv.initTracing,
+		srv.initAccessLog,
+		srv.initDnstap,
 		srv.initHTTPServer,
 		srv.initDNSServer,
+		srv.initAdmin,
 	} {
 		if err := fn(); err != nil {
 			return err
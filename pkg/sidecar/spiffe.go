@@ -0,0 +1,23 @@
+package sidecar
+
+import (
+	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/spiffe"
+)
+
+// SPIFFEAllowList returns the SPIFFE IDs and trust domains
+// allowed to connect. If empty, any verified client is.
+func (tc *TLSConfig) SPIFFEAllowList() spiffe.AllowList {
+	return spiffe.AllowList{
+		IDs:          tc.AllowedSPIFFEIDs,
+		TrustDomains: tc.AllowedTrustDomains,
+	}
+}
+
+func (tc *TLSConfig) validateSPIFFE() error {
+	if err := tc.SPIFFEAllowList().Validate(); err != nil {
+		return core.Wrap(err, "TLS")
+	}
+	return nil
+}
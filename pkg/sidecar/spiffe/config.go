@@ -0,0 +1,127 @@
+package spiffe
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+const (
+	// EndpointSocketEnv is the environment variable indicating
+	// the address of the Workload API
+	EndpointSocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+	// DefaultWatchInterval is how often the files are checked
+	// for changes by default
+	DefaultWatchInterval = 5 * time.Second
+	// DefaultRetryInterval indicates how long we wait by default
+	// before reconnecting to the Workload API
+	DefaultRetryInterval = 5 * time.Second
+	// DefaultFetchTimeout indicates how long we wait by default
+	// for the first SVID
+	DefaultFetchTimeout = 30 * time.Second
+)
+
+// Config describes where the [Store] gets the SVIDs from.
+// If CertFile is set the files are used, otherwise the
+// Workload API.
+type Config struct {
+	Logger slog.Logger
+
+	// Address is the Workload API endpoint, as unix:///path or
+	// tcp://addr:port. Defaults to $SPIFFE_ENDPOINT_SOCKET
+	Address string
+
+	// CertFile is the PEM file with the SVID and its intermediates
+	CertFile string
+	// KeyFile is the PEM file with the SVID's key. Defaults to CertFile
+	KeyFile string
+	// BundleFile is the PEM file with the trust bundle
+	BundleFile string
+
+	WatchInterval time.Duration
+	RetryInterval time.Duration
+	FetchTimeout  time.Duration
+}
+
+// SetDefaults fills gaps in the [Config]
+func (cfg *Config) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.CertFile == "" && cfg.Address == "" {
+		cfg.Address = os.Getenv(EndpointSocketEnv)
+	}
+
+	if cfg.CertFile != "" && cfg.KeyFile == "" {
+		cfg.KeyFile = cfg.CertFile
+	}
+
+	if cfg.WatchInterval <= 0 {
+		cfg.WatchInterval = DefaultWatchInterval
+	}
+
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+
+	if cfg.FetchTimeout <= 0 {
+		cfg.FetchTimeout = DefaultFetchTimeout
+	}
+
+	return nil
+}
+
+// Validate tells if the [Config] can be used
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.CertFile != "":
+		if cfg.BundleFile == "" {
+			return core.Wrap(core.ErrInvalid, "no trust bundle file")
+		}
+		return nil
+	case cfg.Address == "":
+		return core.Wrap(core.ErrInvalid, "no Workload API address nor files")
+	default:
+		_, _, err := parseAddress(cfg.Address)
+		return err
+	}
+}
+
+// New creates a new [Store] from the [Config], waiting for
+// the first SVID.
+func (cfg *Config) New() (*Store, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Store{cfg: *cfg}
+
+	var err error
+	if cfg.CertFile != "" {
+		err = s.initFiles()
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.FetchTimeout)
+		defer cancel()
+
+		err = s.initWorkloadAPI(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
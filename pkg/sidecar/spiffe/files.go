@@ -0,0 +1,133 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/x509utils"
+
+	"darvaza.org/sidecar/pkg/sidecar/store"
+)
+
+func (s *Store) initFiles() error {
+	stamps := s.getStamps()
+	svid, err := s.loadFiles()
+	if err != nil {
+		return err
+	}
+
+	s.stamps = stamps
+	s.setSVID(svid)
+	return nil
+}
+
+// runFiles checks the files periodically until the context
+// is cancelled.
+func (s *Store) runFiles(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.checkFiles()
+		}
+	}
+}
+
+// checkFiles reloads the SVID if the files have changed. If the
+// new files fail to load, the previous SVID is kept until they
+// change again.
+func (s *Store) checkFiles() {
+	stamps := s.getStamps()
+	if core.SliceEqualFn(stamps, s.stamps, store.FileStamp.Equal) {
+		return
+	}
+
+	s.stamps = stamps
+	svid, err := s.loadFiles()
+	if err != nil {
+		s.error(err).WithField("filename", s.cfg.CertFile).
+			Print("failed to reload SVID, keeping the old one")
+		return
+	}
+
+	s.setSVID(svid)
+}
+
+func (s *Store) loadFiles() (*SVID, error) {
+	chain, err := readCertificates(s.cfg.CertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := readKey(s.cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := readCertificates(s.cfg.BundleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	svid, err := newSVID(chain, key, bundle)
+	if err != nil {
+		return nil, core.Wrap(err, s.cfg.CertFile)
+	}
+	return svid, nil
+}
+
+func (s *Store) getStamps() []store.FileStamp {
+	return []store.FileStamp{
+		store.NewFileStamp(s.cfg.CertFile),
+		store.NewFileStamp(s.cfg.KeyFile),
+		store.NewFileStamp(s.cfg.BundleFile),
+	}
+}
+
+func readCertificates(filename string) ([]*x509.Certificate, error) {
+	var out []*x509.Certificate
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = x509utils.ReadPEM(data, func(_ string, block *pem.Block) bool {
+		if c, _ := x509utils.BlockToCertificate(block); c != nil {
+			out = append(out, c)
+		}
+		return false
+	})
+
+	if len(out) == 0 {
+		return nil, core.Wrap(core.ErrInvalid, filename)
+	}
+	return out, nil
+}
+
+func readKey(filename string) (x509utils.PrivateKey, error) {
+	var key x509utils.PrivateKey
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = x509utils.ReadPEM(data, func(_ string, block *pem.Block) bool {
+		key, _ = x509utils.BlockToPrivateKey(block)
+		return key != nil
+	})
+
+	if key == nil {
+		return nil, core.Wrap(core.ErrInvalid, filename)
+	}
+	return key, nil
+}
@@ -0,0 +1,186 @@
+// Package spiffe implements a [storage.Store] serving X.509 SVIDs
+// obtained from the SPIFFE Workload API, or from files written by a
+// local agent, and the authorization of peers by SPIFFE ID.
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"strings"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage/simple"
+	"darvaza.org/darvaza/shared/x509utils"
+
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+// ParseID parses and validates a SPIFFE ID
+func ParseID(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateID(u); err != nil {
+		return nil, core.Wrap(err, s)
+	}
+
+	return u, nil
+}
+
+func validateID(u *url.URL) error {
+	switch {
+	case u.Scheme != peer.SPIFFEScheme:
+		return core.Wrap(core.ErrInvalid, "invalid scheme")
+	case u.Host == "" || u.Port() != "":
+		return core.Wrap(core.ErrInvalid, "invalid trust domain")
+	case u.User != nil, u.RawQuery != "", u.Fragment != "":
+		return core.Wrap(core.ErrInvalid, "invalid SPIFFE ID")
+	default:
+		return nil
+	}
+}
+
+// GetID returns the SPIFFE ID of a certificate, if any.
+func GetID(cert *x509.Certificate) (*url.URL, bool) {
+	if cert != nil {
+		for _, u := range cert.URIs {
+			if validateID(u) == nil {
+				return u, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// SVID is an X.509 SPIFFE Verifiable Identity Document
+// and the trust bundles to verify peers.
+type SVID struct {
+	// ID is the SPIFFE ID of the workload
+	ID *url.URL
+	// Certificate is the SVID chain and its private key
+	Certificate *tls.Certificate
+	// Bundle contains the X.509 authorities of the trust domain
+	Bundle []*x509.Certificate
+	// Federated contains the X.509 authorities of federated
+	// trust domains
+	Federated map[string][]*x509.Certificate
+}
+
+// newSVID assembles a [SVID] validating the chain and the key
+func newSVID(chain []*x509.Certificate, key x509utils.PrivateKey, bundle []*x509.Certificate) (*SVID, error) {
+	if len(chain) == 0 {
+		return nil, core.Wrap(core.ErrInvalid, "empty SVID")
+	}
+
+	leaf := chain[0]
+	id, ok := GetID(leaf)
+	switch {
+	case !ok:
+		return nil, core.Wrap(core.ErrInvalid, "SVID without SPIFFE ID")
+	case key == nil || !simple.PairMatch(leaf, key):
+		return nil, core.Wrap(core.ErrInvalid, "SVID key doesn't match")
+	case len(bundle) == 0:
+		return nil, core.Wrap(core.ErrInvalid, "empty trust bundle")
+	}
+
+	cert := &tls.Certificate{
+		PrivateKey: key,
+		Leaf:       leaf,
+	}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return &SVID{
+		ID:          id,
+		Certificate: cert,
+		Bundle:      bundle,
+	}, nil
+}
+
+// NewCAPool creates a [x509.CertPool] containing the trust bundle
+// and the federated ones.
+func (svid *SVID) NewCAPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, c := range svid.Bundle {
+		pool.AddCert(c)
+	}
+	for _, bundle := range svid.Federated {
+		for _, c := range bundle {
+			pool.AddCert(c)
+		}
+	}
+	return pool
+}
+
+// AllowList authorizes peers by SPIFFE ID. Entries can be
+// full SPIFFE IDs, or trust domains to accept any workload on them.
+type AllowList struct {
+	IDs          []string
+	TrustDomains []string
+}
+
+// IsEmpty tells if the [AllowList] has no entries
+func (al AllowList) IsEmpty() bool {
+	return len(al.IDs) == 0 && len(al.TrustDomains) == 0
+}
+
+// Validate checks all entries are valid
+func (al AllowList) Validate() error {
+	for _, s := range al.IDs {
+		if _, err := ParseID(s); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range al.TrustDomains {
+		if _, err := ParseID(peer.SPIFFEScheme + "://" + trustDomain(s)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Allows tells if the given SPIFFE ID is authorized
+func (al AllowList) Allows(id *url.URL) bool {
+	if id == nil {
+		return false
+	}
+
+	for _, s := range al.TrustDomains {
+		if strings.EqualFold(trustDomain(s), id.Host) {
+			return true
+		}
+	}
+
+	return core.SliceContains(al.IDs, id.String())
+}
+
+// trustDomain removes the optional spiffe:// prefix
+// of a trust domain
+func trustDomain(s string) string {
+	return strings.TrimPrefix(s, peer.SPIFFEScheme+"://")
+}
+
+// VerifyConnection implements [tls.Config.VerifyConnection], rejecting
+// peers presenting a certificate without an authorized SPIFFE ID.
+// Peers presenting no certificate are left to the ClientAuth policy.
+func (al AllowList) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+
+	id, ok := GetID(cs.PeerCertificates[0])
+	switch {
+	case !ok:
+		return core.Wrap(core.ErrInvalid, "peer without SPIFFE ID")
+	case !al.Allows(id):
+		return core.Wrapf(core.ErrInvalid, "%q: SPIFFE ID not allowed", id.String())
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,238 @@
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"darvaza.org/darvaza/shared/x509utils"
+)
+
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test SPIFFE CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{key: key, cert: cert}
+}
+
+func (ca *testCA) issue(t *testing.T, id string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := ParseID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func (ca *testCA) writeFiles(t *testing.T, dir, id string) *Config {
+	cert, key := ca.issue(t, id)
+
+	cfg := &Config{
+		CertFile:   filepath.Join(dir, "svid.pem"),
+		KeyFile:    filepath.Join(dir, "svid_key.pem"),
+		BundleFile: filepath.Join(dir, "svid_bundle.pem"),
+	}
+
+	for fn, data := range map[string][]byte{
+		cfg.CertFile:   x509utils.EncodeCertificate(cert.Raw),
+		cfg.KeyFile:    x509utils.EncodePKCS8PrivateKey(key),
+		cfg.BundleFile: x509utils.EncodeCertificate(ca.cert.Raw),
+	} {
+		if err := os.WriteFile(fn, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func TestFiles(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	s, err := ca.writeFiles(t, dir, "spiffe://example.org/a").New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	if id := s.SVID().ID.String(); id != "spiffe://example.org/a" {
+		t.Errorf("ERROR: ID: %q", id)
+	}
+
+	// rotate
+	ca.writeFiles(t, dir, "spiffe://example.org/b")
+	s.stamps = nil
+	s.checkFiles()
+
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{})
+	switch {
+	case err != nil:
+		t.Errorf("ERROR: GetCertificate: %v", err)
+	case cert.Leaf.URIs[0].String() != "spiffe://example.org/b":
+		t.Errorf("ERROR: GetCertificate: %v", cert.Leaf.URIs)
+	default:
+		t.Log("rotation: success")
+	}
+
+	// broken rotation keeps the previous SVID
+	_ = os.WriteFile(s.cfg.KeyFile, []byte("garbage"), 0o600)
+	s.checkFiles()
+	if s.SVID().Certificate != cert {
+		t.Error("ERROR: SVID replaced by a broken one")
+	}
+}
+
+func TestWorkloadAPI(t *testing.T) {
+	ca := newTestCA(t)
+	cert, key := ca.issue(t, "spiffe://example.org/workload")
+
+	// X509SVID
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, "spiffe://example.org/workload")
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, cert.Raw)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	svid = protowire.AppendBytes(svid, keyDER)
+	svid = protowire.AppendTag(svid, 4, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, ca.cert.Raw)
+
+	// X509SVIDResponse
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, svid)
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != fetchX509SVIDPath || req.Header.Get(workloadHeader) != "true" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var hdr [5]byte
+		binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+
+		rw.Header().Set("Content-Type", "application/grpc")
+		rw.Header().Set("Trailer", "Grpc-Status")
+		_, _ = rw.Write(hdr[:])
+		_, _ = rw.Write(msg)
+		rw.Header().Set("Grpc-Status", "0")
+	})
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	lsn, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := &http.Server{Handler: h2c.NewHandler(h, &http2.Server{})}
+	go func() { _ = hs.Serve(lsn) }()
+	t.Cleanup(func() { _ = hs.Close() })
+
+	cfg := &Config{Address: "unix://" + socket}
+	s, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	leaf := s.SVID().Certificate.Leaf
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: s.GetCAPool()}); err != nil {
+		t.Errorf("ERROR: Verify: %v", err)
+	} else {
+		t.Logf("%s: success", s.SVID().ID)
+	}
+}
+
+type testAllowListCase struct {
+	id      string
+	allowed bool
+}
+
+func TestAllowList(t *testing.T) {
+	al := AllowList{
+		IDs:          []string{"spiffe://example.org/ns/default/sa/web"},
+		TrustDomains: []string{"spiffe://trusted.example.org", "other.example.org"},
+	}
+
+	if err := al.Validate(); err != nil {
+		t.Fatalf("ERROR: Validate: %v", err)
+	}
+
+	var cases = []testAllowListCase{
+		{"spiffe://example.org/ns/default/sa/web", true},
+		{"spiffe://example.org/ns/default/sa/db", false},
+		{"spiffe://trusted.example.org/anything", true},
+		{"spiffe://other.example.org/x", true},
+		{"spiffe://evil.example.org/ns/default/sa/web", false},
+	}
+
+	for _, tc := range cases {
+		id, _ := ParseID(tc.id)
+		if ok := al.Allows(id); ok != tc.allowed {
+			t.Errorf("ERROR: %q: %v (expected %v)", tc.id, ok, tc.allowed)
+		} else {
+			t.Logf("%q: success", tc.id)
+		}
+	}
+
+	if err := (AllowList{IDs: []string{"https://example.org"}}).Validate(); err == nil {
+		t.Error("ERROR: Validate: failed to fail")
+	}
+}
@@ -0,0 +1,84 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/fs"
+	"sync"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage"
+	"darvaza.org/slog"
+
+	"darvaza.org/sidecar/pkg/sidecar/store"
+)
+
+var _ storage.Store = (*Store)(nil)
+
+// Store is a [storage.Store] serving the workload's X.509 SVID
+// regardless of the requested name, and using its trust bundles
+// as CA pool. SVIDs are rotated live while [Store.Run] is running.
+type Store struct {
+	mu  sync.RWMutex
+	cfg Config
+
+	svid *SVID
+	pool *x509.CertPool
+
+	// stamps are the versions of the files last loaded
+	stamps []store.FileStamp
+}
+
+// GetCertificate returns the current SVID.
+func (s *Store) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if svid := s.SVID(); svid != nil {
+		return svid.Certificate, nil
+	}
+	return nil, core.Wrap(fs.ErrNotExist, "no SVID available")
+}
+
+// GetCAPool returns the current trust bundles.
+func (s *Store) GetCAPool() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pool
+}
+
+// SVID returns the current [SVID].
+func (s *Store) SVID() *SVID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.svid
+}
+
+// Run keeps the SVID updated until the context is cancelled.
+func (s *Store) Run(ctx context.Context) error {
+	if s.cfg.CertFile != "" {
+		return s.runFiles(ctx)
+	}
+	return s.runWorkloadAPI(ctx)
+}
+
+func (s *Store) setSVID(svid *SVID) {
+	pool := svid.NewCAPool()
+
+	s.mu.Lock()
+	s.svid, s.pool = svid, pool
+	s.mu.Unlock()
+
+	s.cfg.Logger.Info().WithFields(slog.Fields{
+		"spiffe_id": svid.ID.String(),
+		"not_after": svid.Certificate.Leaf.NotAfter,
+	}).Print("SVID updated")
+}
+
+func (s *Store) error(err error) slog.Logger {
+	l := s.cfg.Logger.Error()
+	if err != nil {
+		l = l.WithField(slog.ErrorFieldName, err)
+	}
+	return l
+}
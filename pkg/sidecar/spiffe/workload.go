@@ -0,0 +1,349 @@
+package spiffe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/x509utils"
+	"darvaza.org/slog"
+)
+
+const (
+	// fetchX509SVIDPath is the gRPC method streaming X.509 SVIDs
+	fetchX509SVIDPath = "/SpiffeWorkloadAPI/FetchX509SVID"
+	// workloadHeader is the metadata required by the Workload API
+	workloadHeader = "workload.spiffe.io"
+
+	// maxMessageSize is the largest gRPC message accepted
+	maxMessageSize = 4 << 20
+)
+
+// parseAddress splits a Workload API address into the network
+// and address to dial.
+func parseAddress(addr string) (network, address string, err error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", core.Wrap(err, addr)
+	}
+
+	switch {
+	case u.Scheme == "unix" && u.Path != "":
+		return "unix", u.Path, nil
+	case u.Scheme == "unix" && u.Opaque != "":
+		return "unix", u.Opaque, nil
+	case u.Scheme == "tcp" && u.Host != "":
+		return "tcp", u.Host, nil
+	default:
+		return "", "", core.Wrapf(core.ErrInvalid, "%q: invalid Workload API address", addr)
+	}
+}
+
+// initWorkloadAPI waits for the first SVID
+func (s *Store) initWorkloadAPI(ctx context.Context) error {
+	return s.watchWorkloadAPI(ctx, func(svid *SVID) bool {
+		s.setSVID(svid)
+		return false
+	})
+}
+
+// runWorkloadAPI receives SVID updates until the context is
+// cancelled, reconnecting when the stream fails.
+func (s *Store) runWorkloadAPI(ctx context.Context) error {
+	for {
+		err := s.watchWorkloadAPI(ctx, func(svid *SVID) bool {
+			s.setSVID(svid)
+			return true
+		})
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		s.cfg.Logger.Warn().WithField(slog.ErrorFieldName, err).
+			WithField("address", s.cfg.Address).
+			Print("Workload API stream interrupted, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.cfg.RetryInterval):
+		}
+	}
+}
+
+// watchWorkloadAPI calls FetchX509SVID and passes each received
+// SVID to the callback until it returns false, or the stream ends.
+func (s *Store) watchWorkloadAPI(ctx context.Context, fn func(*SVID) bool) error {
+	tr, err := s.newWorkloadTransport()
+	if err != nil {
+		return err
+	}
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := fetchX509SVID(ctx, tr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for {
+		msg, err := readMessage(resp.Body)
+		switch {
+		case errors.Is(err, io.EOF):
+			return core.Coalesce(grpcStatus(resp.Trailer), io.ErrUnexpectedEOF)
+		case err != nil:
+			return err
+		}
+
+		svid, err := parseX509SVIDResponse(msg)
+		if err != nil {
+			s.error(err).Print("invalid SVID received from the Workload API")
+			continue
+		}
+
+		if !fn(svid) {
+			return nil
+		}
+	}
+}
+
+func (s *Store) newWorkloadTransport() (*http2.Transport, error) {
+	network, address, err := parseAddress(s.cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}, nil
+}
+
+func fetchX509SVID(ctx context.Context, tr http.RoundTripper) (*http.Response, error) {
+	// empty X509SVIDRequest
+	body := bytes.NewReader(make([]byte, 5))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost"+fetchX509SVIDPath, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set(workloadHeader, "true")
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkResponse(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("workload API: HTTP %v", resp.StatusCode)
+	}
+
+	// Trailers-Only responses carry the status on the headers
+	return grpcStatus(resp.Header)
+}
+
+// grpcStatus converts a non-OK gRPC status into an error
+func grpcStatus(h http.Header) error {
+	code := h.Get("Grpc-Status")
+	if code == "" || code == "0" {
+		return nil
+	}
+
+	msg, _ := url.PathUnescape(h.Get("Grpc-Message"))
+	return fmt.Errorf("workload API: grpc-status %s: %s", code, msg)
+}
+
+// readMessage reads a length-prefixed gRPC message
+func readMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[1:])
+	switch {
+	case hdr[0] != 0:
+		return nil, core.Wrap(core.ErrInvalid, "compressed message")
+	case size > maxMessageSize:
+		return nil, core.Wrap(core.ErrInvalid, "message too large")
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// forEachBytesField calls a function for every length-delimited
+// field of a protobuf message, skipping all others.
+func forEachBytesField(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseX509SVIDResponse decodes a X509SVIDResponse message,
+// using the first (default) SVID.
+func parseX509SVIDResponse(b []byte) (*SVID, error) {
+	var svids [][]byte
+	federated := make(map[string][]*x509.Certificate)
+
+	err := forEachBytesField(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1: // svids
+			svids = append(svids, v)
+		case 3: // federated_bundles
+			td, bundle, err := parseBundleEntry(v)
+			if err != nil {
+				return err
+			}
+			federated[td] = bundle
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil:
+		return nil, err
+	case len(svids) == 0:
+		return nil, core.Wrap(core.ErrInvalid, "no SVIDs")
+	}
+
+	svid, err := parseX509SVID(svids[0])
+	if err != nil {
+		return nil, err
+	}
+
+	svid.Federated = federated
+	return svid, nil
+}
+
+// parseX509SVID decodes a X509SVID message
+func parseX509SVID(b []byte) (*SVID, error) {
+	var id string
+	var chain, bundle []*x509.Certificate
+	var key x509utils.PrivateKey
+
+	err := forEachBytesField(b, func(num protowire.Number, v []byte) error {
+		var err error
+
+		switch num {
+		case 1: // spiffe_id
+			id = string(v)
+		case 2: // x509_svid
+			chain, err = x509.ParseCertificates(v)
+		case 3: // x509_svid_key
+			key, err = parsePKCS8PrivateKey(v)
+		case 4: // bundle
+			bundle, err = x509.ParseCertificates(v)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	svid, err := newSVID(chain, key, bundle)
+	switch {
+	case err != nil:
+		return nil, err
+	case svid.ID.String() != id:
+		return nil, core.Wrapf(core.ErrInvalid, "%q: SPIFFE ID mismatch", id)
+	default:
+		return svid, nil
+	}
+}
+
+// parseBundleEntry decodes a map<string, bytes> entry
+func parseBundleEntry(b []byte) (string, []*x509.Certificate, error) {
+	var td string
+	var bundle []*x509.Certificate
+
+	err := forEachBytesField(b, func(num protowire.Number, v []byte) error {
+		var err error
+
+		switch num {
+		case 1:
+			td = string(v)
+		case 2:
+			bundle, err = x509.ParseCertificates(v)
+		}
+		return err
+	})
+
+	return td, bundle, err
+}
+
+func parsePKCS8PrivateKey(der []byte) (x509utils.PrivateKey, error) {
+	pk, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pk.(x509utils.PrivateKey)
+	if !ok {
+		return nil, core.Wrap(core.ErrInvalid, "unsupported private key")
+	}
+	return key, nil
+}
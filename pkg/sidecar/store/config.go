@@ -2,6 +2,8 @@
 package store
 
 import (
+	"time"
+
 	"darvaza.org/darvaza/shared/storage"
 	"darvaza.org/darvaza/shared/storage/simple"
 	"darvaza.org/slog"
@@ -12,13 +14,23 @@ type Config struct {
 	Key   string `default:"key.pem"`
 	Cert  string `default:"cert.pem"`
 	Roots string `default:"caroot.pem"`
+
+	// WatchInterval indicates how often a [Watcher] checks
+	// the files for changes
+	WatchInterval time.Duration `default:"30s"`
 }
 
 // New creates a simple [storage.Store] from the config
 func (cfg *Config) New(logger slog.Logger) (storage.Store, error) {
+	return newStore(logger, cfg.Key, cfg.Cert, cfg.Roots)
+}
+
+// newStore creates a simple [storage.Store] from PEM encoded
+// content, files or directories
+func newStore(logger slog.Logger, blocks ...string) (storage.Store, error) {
 	sc := &simple.Config{
 		Logger: logger,
 	}
 
-	return sc.New(cfg.Key, cfg.Cert, cfg.Roots)
+	return sc.New(blocks...)
 }
@@ -0,0 +1,327 @@
+package store
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage"
+	"darvaza.org/darvaza/shared/storage/simple"
+	"darvaza.org/darvaza/shared/x509utils"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+var (
+	_ storage.Store = (*SelfSigned)(nil)
+)
+
+const (
+	// SelfSignedCAKeyFile is the name of the file holding the
+	// private key of the persisted self-signed CA
+	SelfSignedCAKeyFile = "ca-key.pem"
+	// SelfSignedCACertFile is the name of the file holding the
+	// certificate of the persisted self-signed CA
+	SelfSignedCACertFile = "ca.pem"
+
+	// DefaultSelfSignedCADuration is how long a generated CA is valid
+	DefaultSelfSignedCADuration = 10 * 365 * 24 * time.Hour
+	// DefaultSelfSignedDuration is how long a generated leaf
+	// certificate is valid
+	DefaultSelfSignedDuration = 90 * 24 * time.Hour
+)
+
+// SelfSignedConfig describes an ephemeral local CA and the leaf
+// certificate it issues for the sidecar.
+type SelfSignedConfig struct {
+	Logger slog.Logger
+
+	// Name is the hostname the leaf certificate is issued for
+	Name string
+	// Hosts are additional hostnames the leaf certificate is valid for
+	Hosts []string
+	// Addrs are the IP addresses the leaf certificate is valid for
+	Addrs []netip.Addr
+
+	// Dir is an optional directory where the CA is persisted so
+	// restarts keep the same trust anchor
+	Dir string
+
+	CADuration time.Duration
+	Duration   time.Duration
+}
+
+// SetDefaults fills gaps in the [SelfSignedConfig]
+func (cfg *SelfSignedConfig) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.CADuration <= 0 {
+		cfg.CADuration = DefaultSelfSignedCADuration
+	}
+
+	if cfg.Duration <= 0 {
+		cfg.Duration = DefaultSelfSignedDuration
+	}
+
+	return nil
+}
+
+// New creates a [SelfSigned] store from the config
+func (cfg *SelfSignedConfig) New() (*SelfSigned, error) {
+	if cfg == nil {
+		cfg = new(SelfSignedConfig)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	caKey, ca, err := cfg.getCA()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := cfg.newLeaf(caKey, ca)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	s := &SelfSigned{
+		ca:   ca,
+		cert: cert,
+		pool: pool,
+	}
+	return s, nil
+}
+
+func (cfg *SelfSignedConfig) getCA() (x509utils.PrivateKey, *x509.Certificate, error) {
+	if cfg.Dir == "" {
+		// ephemeral
+		return cfg.newCA()
+	}
+
+	keyFile := filepath.Join(cfg.Dir, SelfSignedCAKeyFile)
+	certFile := filepath.Join(cfg.Dir, SelfSignedCACertFile)
+
+	key, ca, err := readCA(keyFile, certFile)
+	switch {
+	case err == nil:
+		// reuse
+		cfg.Logger.Info().WithField("filename", certFile).Print("self-signed CA loaded")
+		return key, ca, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		// broken
+		return nil, nil, err
+	}
+
+	key, ca, err = cfg.newCA()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeCA(cfg.Dir, keyFile, certFile, key, ca); err != nil {
+		return nil, nil, err
+	}
+
+	cfg.Logger.Info().WithField("filename", certFile).Print("self-signed CA created")
+	return key, ca, nil
+}
+
+func (cfg *SelfSignedConfig) newCA() (x509utils.PrivateKey, *x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := newCertTemplate(cfg.Name+" CA", cfg.CADuration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.MaxPathLenZero = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	ca, err := createCertificate(tmpl, tmpl, key, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, ca, nil
+}
+
+func (cfg *SelfSignedConfig) newLeaf(caKey x509utils.PrivateKey, ca *x509.Certificate) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := newCertTemplate(cfg.Name, cfg.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{
+		x509.ExtKeyUsageServerAuth,
+		x509.ExtKeyUsageClientAuth,
+	}
+	tmpl.DNSNames, tmpl.IPAddresses = cfg.leafNames()
+
+	leaf, err := createCertificate(tmpl, ca, key, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{leaf.Raw, ca.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	return cert, nil
+}
+
+func (cfg *SelfSignedConfig) leafNames() ([]string, []net.IP) {
+	var names []string
+	var ips []net.IP
+
+	for _, s := range append([]string{cfg.Name}, cfg.Hosts...) {
+		if s != "" && !core.SliceContains(names, s) {
+			names = append(names, s)
+		}
+	}
+
+	for _, addr := range cfg.Addrs {
+		if addr.IsValid() && !addr.IsUnspecified() {
+			ips = append(ips, net.IP(addr.Unmap().AsSlice()))
+		}
+	}
+
+	return names, ips
+}
+
+func newCertTemplate(cn string, d time.Duration) (*x509.Certificate, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: cn,
+		},
+		// tolerate small clock skews
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(d),
+	}
+	return tmpl, nil
+}
+
+func createCertificate(tmpl, parent *x509.Certificate,
+	key, signer x509utils.PrivateKey) (*x509.Certificate, error) {
+	//
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+func readCA(keyFile, certFile string) (x509utils.PrivateKey, *x509.Certificate, error) {
+	var key x509utils.PrivateKey
+	var ca *x509.Certificate
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if block, _ := pem.Decode(keyPEM); block != nil {
+		key, err = x509utils.BlockToPrivateKey(block)
+		if err != nil {
+			return nil, nil, core.Wrap(err, keyFile)
+		}
+	}
+
+	if block, _ := pem.Decode(certPEM); block != nil {
+		ca, err = x509utils.BlockToCertificate(block)
+		if err != nil {
+			return nil, nil, core.Wrap(err, certFile)
+		}
+	}
+
+	switch {
+	case key == nil:
+		return nil, nil, core.Wrap(core.ErrInvalid, keyFile)
+	case ca == nil, !ca.IsCA:
+		return nil, nil, core.Wrap(core.ErrInvalid, certFile)
+	case !simple.PairMatch(ca, key):
+		return nil, nil, core.Wrap(core.ErrInvalid, "CA key and certificate mismatch")
+	default:
+		return key, ca, nil
+	}
+}
+
+func writeCA(dir, keyFile, certFile string, key x509utils.PrivateKey, ca *x509.Certificate) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyFile, x509utils.EncodePKCS8PrivateKey(key), 0o600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(certFile, x509utils.EncodeCertificate(ca.Raw), 0o644)
+}
+
+// SelfSigned is a [storage.Store] serving a single leaf certificate
+// issued by a local CA.
+type SelfSigned struct {
+	ca   *x509.Certificate
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// GetCertificate returns the leaf certificate regardless of the
+// requested name.
+func (s *SelfSigned) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert, nil
+}
+
+// GetCAPool returns a pool containing the local CA.
+func (s *SelfSigned) GetCAPool() *x509.CertPool {
+	return s.pool
+}
+
+// CA returns the certificate of the local CA.
+func (s *SelfSigned) CA() *x509.Certificate {
+	return s.ca
+}
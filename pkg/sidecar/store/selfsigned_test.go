@@ -0,0 +1,70 @@
+package store
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/netip"
+	"testing"
+)
+
+func TestSelfSignedVerify(t *testing.T) {
+	cfg := &SelfSignedConfig{
+		Name:  "sidecar.example.org",
+		Hosts: []string{"localhost"},
+		Addrs: []netip.Addr{
+			netip.MustParseAddr("127.0.0.1"),
+			netip.MustParseAddr("::"),
+		},
+	}
+
+	s, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("ERROR: GetCertificate: %v", err)
+	}
+
+	for _, name := range []string{"sidecar.example.org", "localhost", "127.0.0.1"} {
+		_, err := cert.Leaf.Verify(x509.VerifyOptions{
+			DNSName: name,
+			Roots:   s.GetCAPool(),
+		})
+		if err != nil {
+			t.Errorf("ERROR: %q: %v", name, err)
+		}
+	}
+
+	if n := len(cert.Leaf.IPAddresses); n != 1 {
+		t.Errorf("ERROR: %v IP addresses (expected 1)", n)
+	}
+}
+
+func TestSelfSignedPersist(t *testing.T) {
+	cfg := &SelfSignedConfig{
+		Name: "sidecar.example.org",
+		Dir:  t.TempDir(),
+	}
+
+	s1, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	s2, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	if !s1.CA().Equal(s2.CA()) {
+		t.Error("ERROR: CA not reused")
+	}
+
+	c1, _ := s1.GetCertificate(nil)
+	c2, _ := s2.GetCertificate(nil)
+	if c1.Leaf.Equal(c2.Leaf) {
+		t.Error("ERROR: leaf certificate reused")
+	}
+}
@@ -0,0 +1,261 @@
+package store
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/fs"
+	"strings"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage"
+	"darvaza.org/darvaza/shared/storage/simple"
+	"darvaza.org/darvaza/shared/x509utils"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+var (
+	_ storage.Store = (*SNI)(nil)
+)
+
+// SNIConfig describes a [storage.Store] serving multiple
+// certificates selected by the TLS Server Name Indication.
+type SNIConfig struct {
+	Logger slog.Logger
+
+	// Dir is the directory containing the PEM encoded keys and
+	// certificates. Keys are paired with their certificates
+	// regardless of the file they are stored in.
+	Dir string `default:"certs"`
+
+	// Roots is an optional CA bundle exposed via GetCAPool.
+	Roots string
+
+	// Default is the name of the certificate to use when
+	// the client doesn't provide SNI or the name is unknown.
+	// If empty such handshakes will fail.
+	Default string
+}
+
+// SetDefaults fills gaps in the [SNIConfig]
+func (cfg *SNIConfig) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.Dir == "" {
+		cfg.Dir = "certs"
+	}
+
+	return nil
+}
+
+// New loads the directory and creates a new [SNI] store.
+func (cfg *SNIConfig) New() (*SNI, error) {
+	if cfg == nil {
+		cfg = new(SNIConfig)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	pool, err := cfg.loadRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := cfg.loadCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SNI{
+		pool:     pool,
+		names:    make(map[string][]*tls.Certificate),
+		patterns: make(map[string][]*tls.Certificate),
+	}
+
+	for _, c := range certs {
+		s.add(c)
+	}
+
+	if cfg.Default != "" {
+		s.def = s.find(nil, strings.ToLower(cfg.Default))
+		if s.def == nil {
+			return nil, core.Wrapf(fs.ErrNotExist, "%q: default certificate not found", cfg.Default)
+		}
+	}
+
+	return s, nil
+}
+
+func (cfg *SNIConfig) loadRoots() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if cfg.Roots == "" {
+		return pool, nil
+	}
+
+	err := x509utils.ReadStringPEM(cfg.Roots, func(_ string, block *pem.Block) bool {
+		if c, _ := x509utils.BlockToCertificate(block); c != nil {
+			pool.AddCert(c)
+		}
+		return false
+	})
+	return pool, err
+}
+
+// loadCertificates reads all PEM files in the directory, and pairs
+// every leaf certificate with its key. The certificates following
+// a leaf on the same file are considered its chain.
+func (cfg *SNIConfig) loadCertificates() ([]*tls.Certificate, error) {
+	var keys []x509utils.PrivateKey
+	var chains [][]*x509.Certificate
+	var last string
+
+	err := x509utils.ReadStringPEM(cfg.Dir, func(filename string, block *pem.Block) bool {
+		if key, _ := x509utils.BlockToPrivateKey(block); key != nil {
+			keys = append(keys, key)
+		} else if c, _ := x509utils.BlockToCertificate(block); c != nil {
+			n := len(chains)
+			switch {
+			case !c.IsCA, n == 0, filename != last:
+				// new chain
+				chains = append(chains, []*x509.Certificate{c})
+			default:
+				// intermediate
+				chains[n-1] = append(chains[n-1], c)
+			}
+		}
+
+		last = filename
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := cfg.pairCertificates(chains, keys)
+	if len(out) == 0 {
+		return nil, core.Wrap(fs.ErrNotExist, cfg.Dir+": no certificates found")
+	}
+	return out, nil
+}
+
+func (cfg *SNIConfig) pairCertificates(chains [][]*x509.Certificate,
+	keys []x509utils.PrivateKey) []*tls.Certificate {
+	//
+	var out []*tls.Certificate
+
+	for _, chain := range chains {
+		leaf := chain[0]
+		if leaf.IsCA {
+			// not served
+			continue
+		}
+
+		key := findKey(leaf, keys)
+		if key == nil {
+			cfg.Logger.Warn().
+				WithField("subject", leaf.Subject.String()).
+				Print("private key not found, certificate ignored")
+			continue
+		}
+
+		c := &tls.Certificate{
+			PrivateKey: key,
+			Leaf:       leaf,
+		}
+		for _, crt := range chain {
+			c.Certificate = append(c.Certificate, crt.Raw)
+		}
+		out = append(out, c)
+	}
+
+	return out
+}
+
+func findKey(cert *x509.Certificate, keys []x509utils.PrivateKey) x509utils.PrivateKey {
+	for _, key := range keys {
+		if simple.PairMatch(cert, key) {
+			return key
+		}
+	}
+	return nil
+}
+
+// SNI is a [storage.Store] that selects the certificate
+// using the ServerName of the TLS ClientHello.
+type SNI struct {
+	pool *x509.CertPool
+	def  *tls.Certificate
+
+	names    map[string][]*tls.Certificate
+	patterns map[string][]*tls.Certificate
+}
+
+func (s *SNI) add(c *tls.Certificate) {
+	if c.Leaf == nil {
+		return
+	}
+
+	names, patterns := x509utils.Names(c.Leaf)
+	for _, name := range names {
+		s.names[name] = append(s.names[name], c)
+	}
+	for _, pattern := range patterns {
+		s.patterns[pattern] = append(s.patterns[pattern], c)
+	}
+}
+
+// GetCertificate returns the certificate matching the requested
+// ServerName, or the default if there is no match.
+func (s *SNI) GetCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if name, ok := x509utils.SanitiseName(chi.ServerName); ok {
+		if c := s.find(chi, strings.ToLower(name)); c != nil {
+			return c, nil
+		}
+	}
+
+	if s.def != nil {
+		return s.def, nil
+	}
+
+	return nil, core.Wrapf(fs.ErrNotExist, "%q: certificate not found", chi.ServerName)
+}
+
+func (s *SNI) find(chi *tls.ClientHelloInfo, name string) *tls.Certificate {
+	// IP
+	if ip, ok := x509utils.NameAsIP(name); ok {
+		return findSupported(chi, s.names[ip])
+	}
+
+	// exact
+	if c := findSupported(chi, s.names[name]); c != nil {
+		return c
+	}
+
+	// wildcard
+	if suffix, ok := x509utils.NameAsSuffix(name); ok {
+		return findSupported(chi, s.patterns[suffix])
+	}
+
+	return nil
+}
+
+// findSupported returns the first certificate supported by
+// the client, or the first one if we don't have a ClientHello.
+func findSupported(chi *tls.ClientHelloInfo, certs []*tls.Certificate) *tls.Certificate {
+	for _, c := range certs {
+		if chi == nil || chi.SupportsCertificate(c) == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// GetCAPool returns the CAs loaded with the certificates.
+func (s *SNI) GetCAPool() *x509.CertPool {
+	return s.pool
+}
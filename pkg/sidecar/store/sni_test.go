@@ -0,0 +1,101 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"darvaza.org/darvaza/shared/x509utils"
+)
+
+type testSNICase struct {
+	name     string // ServerName
+	expected string // CommonName, empty for failure
+}
+
+func writeTestBundle(t *testing.T, dir string, roots *bytes.Buffer, name string, hosts ...string) {
+	s, err := (&SelfSignedConfig{Name: name, Hosts: hosts}).New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	cert, _ := s.GetCertificate(nil)
+	key, _ := cert.PrivateKey.(x509utils.PrivateKey)
+
+	var b bytes.Buffer
+	b.Write(x509utils.EncodePKCS8PrivateKey(key))
+	b.Write(x509utils.EncodeCertificate(cert.Leaf.Raw))
+	writeTestFile(t, filepath.Join(dir, name+".pem"), b.Bytes())
+
+	roots.Write(x509utils.EncodeCertificate(s.CA().Raw))
+}
+
+func newTestSNI(t *testing.T, def string) *SNI {
+	var roots bytes.Buffer
+
+	base := t.TempDir()
+	dir := filepath.Join(base, "certs")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestBundle(t, dir, &roots, "a.example.org")
+	writeTestBundle(t, dir, &roots, "b.example.org", "*.b.example.org")
+
+	cfg := &SNIConfig{
+		Dir:     dir,
+		Roots:   filepath.Join(base, "caroot.pem"),
+		Default: def,
+	}
+	writeTestFile(t, cfg.Roots, roots.Bytes())
+
+	s, err := cfg.New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+	return s
+}
+
+func TestSNI(t *testing.T) {
+	var cases = []testSNICase{
+		{"a.example.org", "a.example.org"},
+		{"A.Example.Org", "a.example.org"},
+		{"b.example.org", "b.example.org"},
+		{"www.b.example.org", "b.example.org"},
+		{"x.www.b.example.org", ""},
+		{"c.example.org", ""},
+		{"", ""},
+	}
+
+	s := newTestSNI(t, "")
+	for _, tc := range cases {
+		testOneSNI(t, s, tc)
+	}
+
+	// with default
+	s = newTestSNI(t, "a.example.org")
+	for _, tc := range cases {
+		if tc.expected == "" {
+			tc.expected = "a.example.org"
+		}
+		testOneSNI(t, s, tc)
+	}
+}
+
+func testOneSNI(t *testing.T, s *SNI, tc testSNICase) {
+	cert, err := s.GetCertificate(newTestHello(tc.name))
+	switch {
+	case err != nil && tc.expected == "":
+		t.Logf("%q: failed successfully", tc.name)
+	case err != nil:
+		t.Errorf("ERROR: %q: %v", tc.name, err)
+	case tc.expected == "":
+		t.Errorf("ERROR: %q: failed to fail", tc.name)
+	case cert.Leaf.Subject.CommonName != tc.expected:
+		t.Errorf("ERROR: %q: %q (expected %q)", tc.name,
+			cert.Leaf.Subject.CommonName, tc.expected)
+	default:
+		t.Logf("%q: success (%q)", tc.name, tc.expected)
+	}
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/darvaza/shared/storage"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+	"darvaza.org/x/config"
+)
+
+var (
+	_ storage.Store = (*Watcher)(nil)
+)
+
+// Watcher is a [storage.Store] built from the files described by a
+// [Config], and reloaded whenever they change.
+// If the new files fail to load, the previous certificates are kept.
+type Watcher struct {
+	mu     sync.RWMutex
+	cfg    Config
+	logger slog.Logger
+
+	s      storage.Store
+	stamps []FileStamp
+}
+
+// NewWatcher creates a [Watcher] from the config, loading the
+// files for the first time. Empty fields take the values of their
+// `default` tags.
+func (cfg *Config) NewWatcher(logger slog.Logger) (*Watcher, error) {
+	if logger == nil {
+		logger = discard.New()
+	}
+
+	w := &Watcher{
+		cfg:    *cfg,
+		logger: logger,
+	}
+
+	if err := config.Set(&w.cfg); err != nil {
+		return nil, err
+	}
+
+	stamps := w.getStamps()
+	s, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+
+	w.s = s
+	w.stamps = stamps
+	return w, nil
+}
+
+// GetCertificate returns the TLS Certificate that should be used
+// for a given TLS request.
+func (w *Watcher) GetCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return w.getStore().GetCertificate(chi)
+}
+
+// GetCAPool returns a reference to the Certificates Pool.
+func (w *Watcher) GetCAPool() *x509.CertPool {
+	return w.getStore().GetCAPool()
+}
+
+func (w *Watcher) getStore() storage.Store {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.s
+}
+
+// Run checks the files periodically until the context is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.cfg.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_, _ = w.Check()
+		}
+	}
+}
+
+// Check reloads the files if they have changed since the last attempt.
+// It returns true if a new store was loaded, or the error that
+// prevented it.
+func (w *Watcher) Check() (bool, error) {
+	stamps := w.getStamps()
+
+	w.mu.RLock()
+	changed := !core.SliceEqualFn(stamps, w.stamps, FileStamp.Equal)
+	w.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	err := w.reload(stamps)
+	return err == nil, err
+}
+
+// Reload loads the files unconditionally. If they fail to load
+// the previous certificates are kept.
+func (w *Watcher) Reload() error {
+	return w.reload(w.getStamps())
+}
+
+func (w *Watcher) reload(stamps []FileStamp) error {
+	s, err := w.load()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// don't retry until the files change again
+	w.stamps = stamps
+
+	if err != nil {
+		w.logger.Error().
+			WithField(slog.ErrorFieldName, err).
+			WithField("filename", w.cfg.Cert).
+			Print("failed to reload TLS certificates, keeping the old ones")
+		return err
+	}
+
+	w.s = s
+	w.logger.Info().
+		WithField("filename", w.cfg.Cert).
+		Print("TLS certificates reloaded")
+	return nil
+}
+
+// load reads the key and the certificate once, verifying they
+// match before building the store from the same content.
+func (w *Watcher) load() (storage.Store, error) {
+	cfg := &w.cfg
+
+	key, err := os.ReadFile(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := os.ReadFile(cfg.Cert)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return nil, core.Wrap(err, cfg.Cert)
+	}
+
+	return newStore(w.logger, string(key), string(cert), cfg.Roots)
+}
+
+func (w *Watcher) getStamps() []FileStamp {
+	cfg := &w.cfg
+	return []FileStamp{
+		NewFileStamp(cfg.Key),
+		NewFileStamp(cfg.Cert),
+		NewFileStamp(cfg.Roots),
+	}
+}
+
+// FileStamp identifies the version of a file
+type FileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Equal tells if two stamps refer to the same version of a file
+func (fs FileStamp) Equal(other FileStamp) bool {
+	return fs.size == other.size && fs.modTime.Equal(other.modTime)
+}
+
+// NewFileStamp returns the [FileStamp] of the current version of a
+// file. Missing files and empty names have a zero stamp.
+func NewFileStamp(filename string) FileStamp {
+	var fs FileStamp
+
+	if filename != "" {
+		if fi, err := os.Stat(filename); err == nil {
+			fs.modTime = fi.ModTime()
+			fs.size = fi.Size()
+		}
+	}
+
+	return fs
+}
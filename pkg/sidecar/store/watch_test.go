@@ -0,0 +1,102 @@
+package store
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"darvaza.org/darvaza/shared/x509utils"
+)
+
+func writeTestPair(t *testing.T, dir, name string) *Config {
+	s, err := (&SelfSignedConfig{Name: name}).New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	cert, _ := s.GetCertificate(nil)
+	key, _ := cert.PrivateKey.(x509utils.PrivateKey)
+
+	cfg := &Config{
+		Key:   filepath.Join(dir, "key.pem"),
+		Cert:  filepath.Join(dir, "cert.pem"),
+		Roots: filepath.Join(dir, "caroot.pem"),
+	}
+
+	writeTestFile(t, cfg.Key, x509utils.EncodePKCS8PrivateKey(key))
+	writeTestFile(t, cfg.Cert, x509utils.EncodeCertificate(cert.Leaf.Raw))
+	writeTestFile(t, cfg.Roots, x509utils.EncodeCertificate(s.CA().Raw))
+	return cfg
+}
+
+func writeTestFile(t *testing.T, filename string, data []byte) {
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatalf("ERROR: %s: %v", filename, err)
+	}
+
+	// make sure the stamp changes
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(filename, future, future)
+}
+
+func newTestHello(name string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        name,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+	}
+}
+
+func testWatcherName(t *testing.T, w *Watcher, expected string) {
+	cert, err := w.GetCertificate(newTestHello(expected))
+	switch {
+	case err != nil:
+		t.Errorf("ERROR: GetCertificate: %v", err)
+	case cert.Leaf == nil:
+		t.Error("ERROR: GetCertificate: no leaf")
+	case cert.Leaf.Subject.CommonName != expected:
+		t.Errorf("ERROR: %q (expected %q)", cert.Leaf.Subject.CommonName, expected)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	cfg := writeTestPair(t, dir, "one.example.org")
+
+	w, err := cfg.NewWatcher(nil)
+	if err != nil {
+		t.Fatalf("ERROR: NewWatcher: %v", err)
+	}
+	testWatcherName(t, w, "one.example.org")
+
+	// unchanged
+	if ok, err := w.Check(); ok || err != nil {
+		t.Errorf("ERROR: Check: %v, %v (expected false, nil)", ok, err)
+	}
+
+	// rotated
+	writeTestPair(t, dir, "two.example.org")
+	if ok, err := w.Check(); !ok || err != nil {
+		t.Errorf("ERROR: Check: %v, %v (expected true, nil)", ok, err)
+	}
+	testWatcherName(t, w, "two.example.org")
+
+	// broken, keep the old one
+	writeTestFile(t, cfg.Cert, []byte("garbage"))
+	if ok, err := w.Check(); ok || err == nil {
+		t.Errorf("ERROR: Check: %v, %v (expected false, error)", ok, err)
+	}
+	testWatcherName(t, w, "two.example.org")
+
+	// mismatch, keep the old one
+	other := writeTestPair(t, t.TempDir(), "three.example.org")
+	data, _ := os.ReadFile(other.Cert)
+	writeTestFile(t, cfg.Cert, data)
+	if ok, err := w.Check(); ok || err == nil {
+		t.Errorf("ERROR: Check: %v, %v (expected false, error)", ok, err)
+	}
+	testWatcherName(t, w, "two.example.org")
+}
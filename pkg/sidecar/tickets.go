@@ -0,0 +1,164 @@
+package sidecar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"darvaza.org/core"
+)
+
+const (
+	// DefaultSessionTicketKeyRotation indicates how often the session
+	// ticket keys are rotated when no interval is configured
+	DefaultSessionTicketKeyRotation = 24 * time.Hour
+
+	// sessionTicketKeysKept is how many session ticket keys are kept
+	// to resume sessions issued before a rotation
+	sessionTicketKeysKept = 3
+)
+
+// ticketKeys holds the session ticket keys shared by all
+// the secure listeners, rotated periodically, and the key
+// used for QUIC address validation tokens.
+type ticketKeys struct {
+	mu   sync.Mutex
+	keys [][32]byte
+
+	// ring is a [tls.Config] only used to encrypt and
+	// decrypt tickets with the current keys
+	ring atomic.Pointer[tls.Config]
+
+	// quicToken is the key of the QUIC tokens
+	quicToken quic.TokenGeneratorKey
+}
+
+func newTicketKeys() (*ticketKeys, error) {
+	tk := new(ticketKeys)
+
+	if _, err := rand.Read(tk.quicToken[:]); err != nil {
+		return nil, err
+	}
+
+	if err := tk.Rotate(); err != nil {
+		return nil, err
+	}
+
+	return tk, nil
+}
+
+// Rotate adds a new key to encrypt tickets, keeping the
+// previous ones to decrypt
+func (tk *ticketKeys) Rotate() error {
+	var key [32]byte
+
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	keys := append([][32]byte{key}, tk.keys...)
+	if len(keys) > sessionTicketKeysKept {
+		keys = keys[:sessionTicketKeysKept]
+	}
+
+	tk.setKeys(keys)
+	return nil
+}
+
+func (tk *ticketKeys) setKeys(keys [][32]byte) {
+	ring := new(tls.Config)
+	ring.SetSessionTicketKeys(keys)
+
+	tk.keys = keys
+	tk.ring.Store(ring)
+}
+
+// MarshalBinary encodes the QUIC token key followed by
+// the session ticket keys
+func (tk *ticketKeys) MarshalBinary() ([]byte, error) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	out := make([]byte, 0, 32*(len(tk.keys)+1))
+	out = append(out, tk.quicToken[:]...)
+	for _, key := range tk.keys {
+		out = append(out, key[:]...)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary replaces the keys with those encoded
+// by [ticketKeys.MarshalBinary]
+func (tk *ticketKeys) UnmarshalBinary(data []byte) error {
+	if len(data) < 64 || len(data)%32 != 0 {
+		return core.Wrap(core.ErrInvalid, "invalid session ticket keys")
+	}
+
+	keys := make([][32]byte, len(data)/32-1)
+	for i := range keys {
+		copy(keys[i][:], data[32*(i+1):])
+	}
+
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	copy(tk.quicToken[:], data)
+	tk.setKeys(keys)
+	return nil
+}
+
+// configure makes a [tls.Config] use the shared keys. Clones
+// made afterwards follow the rotations as well.
+func (tk *ticketKeys) configure(tc *tls.Config) {
+	tc.WrapSession = func(cs tls.ConnectionState, ss *tls.SessionState) ([]byte, error) {
+		return tk.ring.Load().EncryptTicket(cs, ss)
+	}
+	tc.UnwrapSession = func(identity []byte, cs tls.ConnectionState) (*tls.SessionState, error) {
+		return tk.ring.Load().DecryptTicket(identity, cs)
+	}
+}
+
+func (srv *Server) initSessionTickets() error {
+	if srv.cfg.TLS.SessionTicketsDisabled {
+		return nil
+	}
+
+	tk, err := newTicketKeys()
+	if err != nil {
+		return err
+	}
+
+	srv.tickets = tk
+	return nil
+}
+
+// runSessionTicketsRotation rotates the session ticket keys
+// until the context is cancelled.
+func (srv *Server) runSessionTicketsRotation(ctx context.Context) error {
+	interval := srv.cfg.TLS.SessionTicketKeyRotation
+	if interval <= 0 {
+		interval = DefaultSessionTicketKeyRotation
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := srv.tickets.Rotate(); err != nil {
+				srv.error(err).Print("failed to rotate session ticket keys")
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package sidecar
+
+import (
+	"io"
+	"os"
+
+	"github.com/cloudflare/tableflip"
+	"golang.org/x/sys/unix"
+)
+
+// sessionTicketsFile is the name of the file used to hand the
+// session ticket keys over to the new process on upgrades
+const sessionTicketsFile = "sidecar-session-tickets"
+
+// sessionTicketsFds is the subset of [tableflip.Fds] used
+// to hand the session ticket keys over
+type sessionTicketsFds interface {
+	File(name string) (*os.File, error)
+	AddFile(name string, f *os.File) error
+}
+
+var _ sessionTicketsFds = (*tableflip.Fds)(nil)
+
+// inheritSessionTickets replaces the session ticket keys with
+// those handed over by the parent process, if any.
+func (srv *Server) inheritSessionTickets(fds sessionTicketsFds) error {
+	if srv.tickets == nil {
+		return nil
+	}
+
+	f, err := fds.File(sessionTicketsFile)
+	if err != nil || f == nil {
+		return err
+	}
+	defer f.Close()
+
+	// the offset is shared with the parent, so read from the start
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 4096))
+	if err != nil {
+		return err
+	}
+
+	if err := srv.tickets.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	srv.info().Print("session ticket keys inherited")
+	return nil
+}
+
+// exportSessionTickets hands the current session ticket keys
+// over to the next process via an anonymous memory file.
+func (srv *Server) exportSessionTickets(fds sessionTicketsFds) error {
+	if srv.tickets == nil {
+		return nil
+	}
+
+	data, err := srv.tickets.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	fd, err := unix.MemfdCreate(sessionTicketsFile, unix.MFD_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	f := os.NewFile(uintptr(fd), sessionTicketsFile)
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+
+	return fds.AddFile(sessionTicketsFile, f)
+}
+
+// upgrade hands the session ticket keys over and starts the
+// new process
+func (srv *Server) upgrade(upg *tableflip.Upgrader) error {
+	if err := srv.exportSessionTickets(upg.Fds); err != nil {
+		srv.error(err).Println("failed to hand session ticket keys over")
+	}
+
+	return upg.Upgrade()
+}
@@ -0,0 +1,90 @@
+//go:build linux
+
+package sidecar
+
+import (
+	"crypto/tls"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"darvaza.org/slog/handlers/discard"
+
+	"darvaza.org/sidecar/pkg/sidecar/store"
+)
+
+// testFds keeps the files handed over, duplicated as
+// [tableflip.Fds] does
+type testFds map[string]*os.File
+
+func (fds testFds) File(name string) (*os.File, error) {
+	f, ok := fds[name]
+	if !ok {
+		return nil, nil
+	}
+	delete(fds, name)
+	return f, nil
+}
+
+func (fds testFds) AddFile(name string, f *os.File) error {
+	fd, err := unix.Dup(int(f.Fd()))
+	if err != nil {
+		return err
+	}
+	fds[name] = os.NewFile(uintptr(fd), name)
+	return nil
+}
+
+func TestSessionTicketsHandover(t *testing.T) {
+	sc := &store.SelfSignedConfig{Name: "example.org"}
+	s, err := sc.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk, err := newTicketKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tk.Rotate()
+
+	parent := &Server{tickets: tk}
+	server := &tls.Config{GetCertificate: s.GetCertificate}
+	parent.tickets.configure(server)
+
+	client := &tls.Config{
+		ServerName:         "example.org",
+		RootCAs:            s.GetCAPool(),
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	// ticket issued before the handover
+	if testResumed(t, server, client) {
+		t.Error("ERROR: resumed without a ticket")
+	}
+
+	fds := make(testFds)
+	if err := parent.exportSessionTickets(fds); err != nil {
+		t.Fatalf("ERROR: export: %v", err)
+	}
+
+	child := new(Server)
+	child.cfg.Logger = discard.New()
+	child.tickets, _ = newTicketKeys()
+	if err := child.inheritSessionTickets(fds); err != nil {
+		t.Fatalf("ERROR: inherit: %v", err)
+	}
+
+	server2 := &tls.Config{GetCertificate: s.GetCertificate}
+	child.tickets.configure(server2)
+
+	switch {
+	case !testResumed(t, server2, client):
+		t.Error("ERROR: not resumed after handover")
+	case child.tickets.quicToken != tk.quicToken:
+		t.Error("ERROR: QUIC token key not handed over")
+	default:
+		t.Log("success")
+	}
+}
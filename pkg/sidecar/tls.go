@@ -2,32 +2,83 @@ package sidecar
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 
 	"darvaza.org/core"
 	"darvaza.org/darvaza/shared/storage"
+
+	"darvaza.org/sidecar/pkg/sidecar/store"
 )
 
-func newFallbackTLSStore() (storage.Store, error) {
-	// TODO: self-signed
-	return nil, core.ErrNotImplemented
+func (srv *Server) initTLS() error {
+	if srv.tls == nil {
+		// self-signed
+		s, err := srv.newFallbackTLSStore()
+		if err != nil {
+			return err
+		}
+		srv.tls = s
+	}
+	return nil
 }
 
-// revive:disable:flag-parameter
-func (srv *Server) newTLSServerConfig(mTLS bool) *tls.Config {
-	// revive:enable:flag-parameter
-	var rootCAs, clientCAs *x509.CertPool
+// newFallbackTLSStore creates a [storage.Store] with a local CA and
+// a leaf certificate for our name and addresses.
+func (srv *Server) newFallbackTLSStore() (storage.Store, error) {
+	addrs := srv.cfg.Addresses.Addresses
+	if len(addrs) == 0 {
+		// all
+		addrs, _ = core.GetIPAddresses()
+	}
+
+	sc := &store.SelfSignedConfig{
+		Logger: srv.cfg.Logger,
+		Name:   srv.cfg.Name,
+		Hosts:  []string{"localhost"},
+		Addrs:  addrs,
+		Dir:    srv.cfg.TLS.FallbackCADir,
+	}
 
-	rootCAs = srv.tls.GetCAPool()
-	if mTLS {
-		clientCAs = rootCAs
+	s, err := sc.New()
+	if err != nil {
+		return nil, core.Wrap(err, "self-signed")
 	}
 
-	return &tls.Config{
+	srv.warn().WithField("name", srv.cfg.Name).Print("using self-signed TLS certificate")
+	return s, nil
+}
+
+// newTLSServerConfig creates a [tls.Config] for a secure listener
+// using the given client certificates policy
+func (srv *Server) newTLSServerConfig(mode ClientAuthMode) *tls.Config {
+	tc := &tls.Config{
 		ServerName: srv.cfg.Name,
 
-		GetCertificate: srv.tls.GetCertificate,
-		ClientCAs:      clientCAs,
-		RootCAs:        rootCAs,
+		GetCertificate: srv.getCertificateFunc(),
+		ClientAuth:     mode.ClientAuthType(),
+		RootCAs:        srv.tls.GetCAPool(),
 	}
+
+	srv.cfg.TLS.applyPolicy(tc)
+	if srv.tickets != nil {
+		srv.tickets.configure(tc)
+	}
+
+	if tc.ClientAuth >= tls.VerifyClientCertIfGiven {
+		srv.configureClientCAs(tc)
+
+		if al := srv.cfg.TLS.SPIFFEAllowList(); !al.IsEmpty() {
+			tc.VerifyConnection = al.VerifyConnection
+		}
+	}
+
+	return tc
+}
+
+// newQUICTLSServerConfig creates a [tls.Config] for a QUIC listener,
+// which always uses TLS 1.3
+func (srv *Server) newQUICTLSServerConfig(mode ClientAuthMode) *tls.Config {
+	tc := srv.newTLSServerConfig(mode)
+	tc.MinVersion = tls.VersionTLS13
+	tc.MaxVersion = 0
+	return tc
 }
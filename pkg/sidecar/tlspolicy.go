@@ -0,0 +1,123 @@
+package sidecar
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"darvaza.org/core"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"x25519": tls.X25519,
+	"p-256":  tls.CurveP256,
+	"p-384":  tls.CurveP384,
+	"p-521":  tls.CurveP521,
+}
+
+// parseTLSVersion converts "1.2", "TLS1.2" or "TLS 1.2" into
+// its [tls.Config] value. Empty means Go's default.
+func parseTLSVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	v := strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(s), "TLS"))
+	if ver, ok := tlsVersions[v]; ok {
+		return ver, nil
+	}
+
+	return 0, core.Wrapf(core.ErrInvalid, "%q: unknown TLS version", s)
+}
+
+// parseCipherSuites converts cipher suite names into their IDs.
+// Insecure suites are rejected.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	var out []uint16
+
+	for _, name := range names {
+		id, ok := findCipherSuite(name)
+		if !ok {
+			return nil, core.Wrapf(core.ErrInvalid, "%q: unknown or insecure cipher suite", name)
+		}
+		out = append(out, id)
+	}
+
+	return out, nil
+}
+
+func findCipherSuite(name string) (uint16, bool) {
+	for _, cs := range tls.CipherSuites() {
+		if strings.EqualFold(cs.Name, name) {
+			return cs.ID, true
+		}
+	}
+	return 0, false
+}
+
+// parseCurves converts curve names, like "X25519", "P-256" or
+// "CurveP256", into their IDs.
+func parseCurves(names []string) ([]tls.CurveID, error) {
+	var out []tls.CurveID
+
+	for _, name := range names {
+		s := strings.ToLower(strings.TrimPrefix(name, "Curve"))
+		if strings.HasPrefix(s, "p") && !strings.HasPrefix(s, "p-") {
+			s = "p-" + s[1:]
+		}
+
+		id, ok := tlsCurves[s]
+		if !ok {
+			return nil, core.Wrapf(core.ErrInvalid, "%q: unknown curve", name)
+		}
+		out = append(out, id)
+	}
+
+	return out, nil
+}
+
+func (tc *TLSConfig) validatePolicy() error {
+	minVer, err := parseTLSVersion(tc.MinVersion)
+	if err != nil {
+		return core.Wrap(err, "TLS.MinVersion")
+	}
+
+	maxVer, err := parseTLSVersion(tc.MaxVersion)
+	switch {
+	case err != nil:
+		return core.Wrap(err, "TLS.MaxVersion")
+	case minVer != 0 && maxVer != 0 && minVer > maxVer:
+		return core.Wrap(core.ErrInvalid, "TLS: MinVersion higher than MaxVersion")
+	}
+
+	if _, err := parseCipherSuites(tc.CipherSuites); err != nil {
+		return core.Wrap(err, "TLS.CipherSuites")
+	}
+
+	if _, err := parseCurves(tc.CurvePreferences); err != nil {
+		return core.Wrap(err, "TLS.CurvePreferences")
+	}
+
+	if tc.SessionTicketKeyRotation < 0 {
+		return core.Wrap(core.ErrInvalid, "TLS.SessionTicketKeyRotation: negative")
+	}
+
+	return nil
+}
+
+// applyPolicy sets the versions, cipher suites, curves and session
+// tickets policy on a [tls.Config]. The [TLSConfig] is expected
+// to have been validated.
+func (tc *TLSConfig) applyPolicy(c *tls.Config) {
+	c.MinVersion, _ = parseTLSVersion(tc.MinVersion)
+	c.MaxVersion, _ = parseTLSVersion(tc.MaxVersion)
+	c.CipherSuites, _ = parseCipherSuites(tc.CipherSuites)
+	c.CurvePreferences, _ = parseCurves(tc.CurvePreferences)
+	c.SessionTicketsDisabled = tc.SessionTicketsDisabled
+}
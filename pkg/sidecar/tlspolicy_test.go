@@ -0,0 +1,115 @@
+package sidecar
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"darvaza.org/sidecar/pkg/sidecar/store"
+)
+
+type testTLSPolicyCase struct {
+	cfg TLSConfig
+	ok  bool
+}
+
+func TestTLSPolicy(t *testing.T) {
+	var cases = []testTLSPolicyCase{
+		{TLSConfig{}, true},
+		{TLSConfig{MinVersion: "1.2", MaxVersion: "TLS1.3"}, true},
+		{TLSConfig{MinVersion: "1.3", MaxVersion: "1.2"}, false},
+		{TLSConfig{MinVersion: "1.4"}, false},
+		{TLSConfig{CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}, true},
+		{TLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, false},
+		{TLSConfig{CurvePreferences: []string{"X25519", "P-256", "CurveP384", "p521"}}, true},
+		{TLSConfig{CurvePreferences: []string{"P-192"}}, false},
+	}
+
+	for i, tc := range cases {
+		err := tc.cfg.validatePolicy()
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("ERROR: %v: %v (expected ok:%v)", i, err, tc.ok)
+		} else {
+			t.Logf("%v: success", i)
+		}
+	}
+}
+
+func TestSessionTicketsRotation(t *testing.T) {
+	sc := &store.SelfSignedConfig{Name: "example.org"}
+	s, err := sc.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk, err := newTicketKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &tls.Config{GetCertificate: s.GetCertificate}
+	tk.configure(server)
+	// clones follow rotations
+	server = server.Clone()
+
+	client := &tls.Config{
+		ServerName:         "example.org",
+		RootCAs:            s.GetCAPool(),
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	if testResumed(t, server, client) {
+		t.Error("ERROR: resumed without a ticket")
+	}
+
+	_ = tk.Rotate()
+	if !testResumed(t, server, client) {
+		t.Error("ERROR: not resumed after one rotation")
+	}
+
+	// handed over to a new process
+	data, _ := tk.MarshalBinary()
+	tk2 := new(ticketKeys)
+	if err := tk2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("ERROR: UnmarshalBinary: %v", err)
+	}
+
+	server2 := &tls.Config{GetCertificate: s.GetCertificate}
+	tk2.configure(server2)
+	if !testResumed(t, server2, client) {
+		t.Error("ERROR: not resumed after handover")
+	}
+	if tk2.quicToken != tk.quicToken {
+		t.Error("ERROR: QUIC token key not handed over")
+	}
+
+	for i := 0; i < sessionTicketKeysKept; i++ {
+		_ = tk2.Rotate()
+	}
+	if testResumed(t, server2, client) {
+		t.Error("ERROR: resumed with a forgotten key")
+	}
+}
+
+func testResumed(t *testing.T, server, client *tls.Config) bool {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	go func() {
+		conn := tls.Server(c2, server)
+		if conn.Handshake() == nil {
+			// deliver the ticket
+			_, _ = conn.Write([]byte{0})
+		}
+	}()
+
+	conn := tls.Client(c1, client)
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("ERROR: Handshake: %v", err)
+	}
+
+	var buf [1]byte
+	_, _ = conn.Read(buf[:])
+	return conn.ConnectionState().DidResume
+}
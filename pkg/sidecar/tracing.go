@@ -0,0 +1,38 @@
+package sidecar
+
+import (
+	"darvaza.org/core"
+
+	"darvaza.org/sidecar/pkg/sidecar/tracing"
+)
+
+func (srv *Server) initTracing() error {
+	tc := &srv.cfg.Tracing
+	if tc.Endpoint == "" {
+		return nil
+	}
+
+	cfg := &tracing.Config{
+		Logger:        srv.cfg.Logger,
+		Endpoint:      tc.Endpoint,
+		Headers:       tc.Headers,
+		ServiceName:   srv.cfg.Name,
+		SampleRatio:   tc.SampleRatio,
+		FlushInterval: tc.FlushInterval,
+	}
+
+	t, err := cfg.New()
+	if err != nil {
+		return core.Wrap(err, "Tracing")
+	}
+
+	srv.tracer = t
+	return nil
+}
+
+// Tracer returns the [tracing.Tracer] of the [Server], or nil if
+// tracing isn't enabled. It can be assigned to the Tracer field
+// of horizon.Horizons to trace DNS requests.
+func (srv *Server) Tracer() *tracing.Tracer {
+	return srv.tracer
+}
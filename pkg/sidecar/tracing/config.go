@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"darvaza.org/core"
+	"darvaza.org/slog"
+	"darvaza.org/slog/handlers/discard"
+)
+
+const (
+	// DefaultTracesPath is the OTLP/HTTP path used when the
+	// endpoint doesn't specify one
+	DefaultTracesPath = "/v1/traces"
+	// DefaultServiceName is the service.name of the spans
+	// when none is configured
+	DefaultServiceName = "sidecar"
+
+	// DefaultBatchSize is the number of spans sent at once by default
+	DefaultBatchSize = 512
+	// DefaultMaxQueueSize is the number of spans kept waiting
+	// for export by default, newer are dropped.
+	DefaultMaxQueueSize = 2048
+	// DefaultFlushInterval indicates how often spans are
+	// exported by default
+	DefaultFlushInterval = 5 * time.Second
+	// DefaultTimeout indicates how long we wait for the
+	// collector by default
+	DefaultTimeout = 10 * time.Second
+)
+
+// Config describes how the [Tracer] records and exports spans
+type Config struct {
+	Logger slog.Logger
+
+	// HTTPClient is used to talk to the collector
+	HTTPClient *http.Client
+
+	// Endpoint is the URL of the OTLP/HTTP collector, like
+	// http://localhost:4318. If no path is given
+	// [DefaultTracesPath] is used.
+	Endpoint string
+	// Headers are added to every export request
+	Headers map[string]string
+
+	// ServiceName is the service.name resource attribute
+	ServiceName string
+	// SampleRatio is the ratio, from 0 to 1, of new traces
+	// recorded. Zero means all. Propagated traces follow
+	// the caller's decision.
+	SampleRatio float64
+
+	BatchSize     int
+	MaxQueueSize  int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+}
+
+// SetDefaults fills gaps in the [Config]
+func (cfg *Config) SetDefaults() error {
+	if cfg.Logger == nil {
+		cfg.Logger = discard.New()
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = DefaultMaxQueueSize
+	}
+
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return nil
+}
+
+// Validate tells if the [Config] is usable
+func (cfg *Config) Validate() error {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return core.Wrap(core.ErrInvalid, "SampleRatio: out of range")
+	}
+
+	_, err := cfg.tracesURL()
+	return err
+}
+
+func (cfg *Config) tracesURL() (string, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	switch {
+	case err != nil:
+		return "", core.Wrap(err, "Endpoint")
+	case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+		return "", core.Wrapf(core.ErrInvalid, "Endpoint: %q: not an HTTP URL", cfg.Endpoint)
+	case u.Path == "" || u.Path == "/":
+		u.Path = DefaultTracesPath
+	}
+
+	return u.String(), nil
+}
+
+// New creates a [Tracer] from the [Config]
+func (cfg *Config) New() (*Tracer, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	if err := cfg.SetDefaults(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	u, _ := cfg.tracesURL()
+	t := &Tracer{
+		cfg:  *cfg,
+		url:  u,
+		wake: make(chan struct{}, 1),
+	}
+	return t, nil
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+// StartDNS starts a server [Span] for a DNS request
+func (t *Tracer) StartDNS(ctx context.Context, rw dns.ResponseWriter,
+	req *dns.Msg) (context.Context, *Span) {
+	//
+	if t == nil {
+		return ctx, nil
+	}
+
+	ctx, span := t.StartServer(ctx, "DNS", SpanContext{})
+
+	if isTLS(rw) {
+		span.SetAttribute(AttrProto, "tcp+tls")
+	} else {
+		span.SetAttribute(AttrProto, rw.LocalAddr().Network())
+	}
+
+	if id, ok := peer.FromDNSResponseWriter(rw); ok {
+		span.SetPeer(id)
+	}
+
+	span.SetAttribute("client.address", rw.RemoteAddr().String())
+
+	if len(req.Question) > 0 {
+		q := req.Question[0]
+		qType := dns.TypeToString[q.Qtype]
+
+		span.SetName("DNS " + qType)
+		span.SetAttribute("dns.question.name", q.Name)
+		span.SetAttribute("dns.question.type", qType)
+	}
+
+	return ctx, span
+}
+
+func isTLS(rw dns.ResponseWriter) bool {
+	if cs, ok := rw.(dns.ConnectionStater); ok {
+		return cs.ConnectionState() != nil
+	}
+	return false
+}
+
+// SetDNSResponse sets the attributes describing the response
+// to a DNS request, or the error preventing it.
+func (s *Span) SetDNSResponse(rsp *dns.Msg, err error) {
+	switch {
+	case err != nil:
+		s.SetError(err)
+	case rsp != nil:
+		s.SetAttribute("dns.response.rcode", dns.RcodeToString[rsp.Rcode])
+		if rsp.Rcode == dns.RcodeServerFailure {
+			s.SetStatus(StatusError, "SERVFAIL")
+		}
+	}
+}
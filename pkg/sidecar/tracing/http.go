@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+// HTTPMiddleware starts a server [Span] for every request handled
+// by next on the given protocol, "h2c", "h2" or "h3", continuing
+// the trace propagated by the client and passing the new span
+// on the request's traceparent header.
+func (t *Tracer) HTTPMiddleware(proto string, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		remote, _ := Extract(req.Header)
+		ctx, span := t.StartServer(req.Context(), "HTTP "+req.Method, remote)
+		defer span.End()
+
+		span.SetAttribute(AttrProto, proto)
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.path", req.URL.Path)
+		span.SetAttribute("server.address", req.Host)
+		span.SetAttribute("client.address", req.RemoteAddr)
+		span.SetAttribute("network.protocol.version", httpVersion(req))
+		if id, ok := peer.FromHTTPRequest(req); ok {
+			span.SetPeer(id)
+		}
+
+		rw, req, o := observe.HTTP(rw, req.WithContext(ctx))
+		Inject(req.Header, span.SpanContext())
+
+		next.ServeHTTP(rw, req)
+
+		if name := o.Horizon(); name != "" {
+			span.SetAttribute(AttrHorizon, name)
+		}
+
+		code := o.Status()
+		span.SetAttribute("http.response.status_code", code)
+		if code >= http.StatusInternalServerError {
+			span.SetStatus(StatusError, http.StatusText(code))
+		}
+	})
+}
+
+func httpVersion(req *http.Request) string {
+	if req.ProtoMajor == 1 {
+		return "1." + strconv.Itoa(req.ProtoMinor)
+	}
+	return strconv.Itoa(req.ProtoMajor)
+}
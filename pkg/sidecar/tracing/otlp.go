@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// InstrumentationScope is the OTLP scope name of the
+// spans created by the sidecar
+const InstrumentationScope = "darvaza.org/sidecar"
+
+// OTLP/JSON representation of an ExportTraceServiceRequest.
+// IDs are hex encoded and 64-bit integers are strings as
+// required by the OTLP/HTTP JSON encoding.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Flags             uint32         `json:"flags,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newOTLPValue(v any) otlpValue {
+	var out otlpValue
+
+	switch x := v.(type) {
+	case string:
+		out.StringValue = &x
+	case bool:
+		out.BoolValue = &x
+	case int:
+		s := strconv.FormatInt(int64(x), 10)
+		out.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		out.IntValue = &s
+	case uint16:
+		s := strconv.FormatUint(uint64(x), 10)
+		out.IntValue = &s
+	case float64:
+		out.DoubleValue = &x
+	default:
+		s := fmt.Sprint(x)
+		out.StringValue = &s
+	}
+
+	return out
+}
+
+func newOTLPAttributes(attrs []Attribute) []otlpKeyValue {
+	out := make([]otlpKeyValue, len(attrs))
+	for i, a := range attrs {
+		out[i] = otlpKeyValue{Key: a.Key, Value: newOTLPValue(a.Value)}
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func newOTLPSpan(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		TraceState:        s.sc.State,
+		Flags:             uint32(s.sc.Flags),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(s.end),
+		Attributes:        newOTLPAttributes(s.attrs),
+		Status:            otlpStatus{Code: s.status, Message: s.statusMsg},
+	}
+
+	if s.parent.IsValid() {
+		out.ParentSpanID = s.parent.String()
+	}
+
+	return out
+}
+
+// encodeSpans renders an OTLP/JSON export request
+func encodeSpans(serviceName string, batch []*Span) ([]byte, error) {
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = newOTLPSpan(s)
+	}
+
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: newOTLPAttributes([]Attribute{
+					{Key: "service.name", Value: serviceName},
+				}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: InstrumentationScope},
+				Spans: spans,
+			}},
+		}},
+	}
+
+	return json.Marshal(req)
+}
@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"darvaza.org/sidecar/pkg/sidecar/peer"
+)
+
+// Attribute keys set by the sidecar
+const (
+	AttrProto   = "sidecar.proto"
+	AttrHorizon = "sidecar.horizon"
+
+	AttrPeerSubject  = "tls.client.subject"
+	AttrPeerHash     = "tls.client.hash.sha256"
+	AttrPeerSPIFFEID = "sidecar.peer.spiffe_id"
+	AttrPeerVerified = "sidecar.peer.verified"
+)
+
+// SpanKind is the OTLP kind of a [Span]
+type SpanKind int
+
+const (
+	// SpanKindInternal is an operation within the sidecar
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is a request received by the sidecar
+	SpanKindServer SpanKind = 2
+)
+
+// StatusCode is the OTLP status of a [Span]
+type StatusCode int
+
+const (
+	// StatusUnset is the default status
+	StatusUnset StatusCode = 0
+	// StatusOK indicates the operation explicitly succeeded
+	StatusOK StatusCode = 1
+	// StatusError indicates the operation failed
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair describing a [Span].
+// Values are strings, booleans, integers or floats.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span is an operation being traced. A nil *Span is valid
+// and records nothing.
+type Span struct {
+	t  *Tracer
+	sc SpanContext
+
+	mu        sync.Mutex
+	name      string
+	kind      SpanKind
+	parent    SpanID
+	start     time.Time
+	end       time.Time
+	attrs     []Attribute
+	status    StatusCode
+	statusMsg string
+}
+
+// SpanContext returns the propagated part of the [Span]
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// IsRecording tells if the [Span] will be exported
+func (s *Span) IsRecording() bool {
+	return s != nil && s.sc.IsSampled()
+}
+
+// SetName changes the name of the [Span]
+func (s *Span) SetName(name string) {
+	if s.IsRecording() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.name = name
+	}
+}
+
+// SetAttribute sets an attribute of the [Span], replacing
+// any previous value of the same key.
+func (s *Span) SetAttribute(key string, value any) {
+	if !s.IsRecording() || key == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.attrs {
+		if s.attrs[i].Key == key {
+			s.attrs[i].Value = value
+			return
+		}
+	}
+	s.attrs = append(s.attrs, Attribute{Key: key, Value: value})
+}
+
+// SetStatus sets the status of the [Span]
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s.IsRecording() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.status, s.statusMsg = code, msg
+	}
+}
+
+// SetError marks the [Span] as failed if err isn't nil
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// SetPeer sets the attributes describing the client
+// certificate of the peer
+func (s *Span) SetPeer(id *peer.Identity) {
+	if id == nil || !s.IsRecording() {
+		return
+	}
+
+	if id.Certificate != nil {
+		s.SetAttribute(AttrPeerSubject, id.Certificate.Subject.String())
+	}
+	s.SetAttribute(AttrPeerHash, id.Fingerprint)
+	if id.SPIFFEID != nil {
+		s.SetAttribute(AttrPeerSPIFFEID, id.SPIFFEID.String())
+	}
+	s.SetAttribute(AttrPeerVerified, id.Verified)
+}
+
+// End completes the [Span] and queues it for export.
+// Only the first call has any effect.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		// once
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.t.enqueue(s)
+}
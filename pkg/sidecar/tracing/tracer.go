@@ -0,0 +1,206 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"darvaza.org/slog"
+)
+
+// Tracer creates spans and exports them to an OTLP/HTTP
+// collector. A nil *Tracer is valid and traces nothing.
+type Tracer struct {
+	cfg Config
+	url string
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	wake    chan struct{}
+}
+
+// StartServer starts a [Span] for a request received by the sidecar,
+// continuing the given remote [SpanContext] if valid.
+func (t *Tracer) StartServer(ctx context.Context, name string,
+	remote SpanContext) (context.Context, *Span) {
+	//
+	if t == nil {
+		return ctx, nil
+	}
+
+	return t.start(ctx, name, SpanKindServer, remote)
+}
+
+// Start starts an internal [Span], child of the current
+// one on the context if any.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	return t.start(ctx, name, SpanKindInternal, SpanFromContext(ctx).SpanContext())
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind,
+	parent SpanContext) (context.Context, *Span) {
+	//
+	s := &Span{
+		t:     t,
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+	}
+
+	if parent.IsValid() {
+		s.sc = parent
+		s.parent = parent.SpanID
+	} else {
+		s.sc.TraceID = newTraceID()
+		if t.sample(s.sc.TraceID) {
+			s.sc.Flags = FlagSampled
+		}
+	}
+	s.sc.SpanID = newSpanID()
+
+	return ContextWithSpan(ctx, s), s
+}
+
+// sample decides if a new trace is recorded using the
+// ratio based approach of OpenTelemetry
+func (t *Tracer) sample(id TraceID) bool {
+	ratio := t.cfg.SampleRatio
+	if ratio <= 0 || ratio >= 1 {
+		return true
+	}
+
+	x := binary.BigEndian.Uint64(id[8:]) >> 1
+	return x < uint64(ratio*(1<<63))
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.queue) >= t.cfg.MaxQueueSize {
+		t.dropped++
+		return
+	}
+
+	t.queue = append(t.queue, s)
+	if len(t.queue) >= t.cfg.BatchSize {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) dequeue() ([]*Span, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := min(len(t.queue), t.cfg.BatchSize)
+	batch := t.queue[:n:n]
+	t.queue = t.queue[n:]
+
+	dropped := t.dropped
+	t.dropped = 0
+
+	return batch, dropped
+}
+
+// Run exports the finished spans periodically until the
+// context is cancelled. Spans finished afterwards are
+// exported by [Tracer.Close].
+func (t *Tracer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			t.Flush(ctx)
+		case <-t.wake:
+			t.Flush(ctx)
+		}
+	}
+}
+
+// Close exports the remaining spans one last time, once the
+// servers producing them have shut down.
+func (t *Tracer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.Timeout)
+	defer cancel()
+
+	t.Flush(ctx)
+	return nil
+}
+
+// Flush exports all the finished spans
+func (t *Tracer) Flush(ctx context.Context) {
+	for {
+		batch, dropped := t.dequeue()
+		if dropped > 0 {
+			t.warn(nil).WithField("dropped", dropped).Print("tracing: queue full, spans dropped")
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := t.export(ctx, batch); err != nil {
+			t.warn(err).WithField("spans", len(batch)).Print("tracing: failed to export spans")
+			return
+		}
+	}
+}
+
+func (t *Tracer) export(ctx context.Context, batch []*Span) error {
+	body, err := encodeSpans(t.cfg.ServiceName, batch)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, math.MaxUint16))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector: %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *Tracer) warn(err error) slog.Logger {
+	l := t.cfg.Logger.Warn()
+	if err != nil {
+		l = l.WithField(slog.ErrorFieldName, err)
+	}
+	return l
+}
@@ -0,0 +1,166 @@
+// Package tracing implements a minimal OpenTelemetry compatible
+// tracer for the sidecar entry points, propagating W3C trace
+// context and exporting spans via OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"darvaza.org/core"
+)
+
+const (
+	// TraceParentHeader is the W3C trace context header
+	// identifying the parent span
+	TraceParentHeader = "traceparent"
+	// TraceStateHeader is the W3C trace context header
+	// carrying vendor specific data
+	TraceStateHeader = "tracestate"
+
+	// FlagSampled is the trace flag indicating the
+	// trace is being recorded
+	FlagSampled = 0x01
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// IsValid tells if the TraceID isn't all zeros
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// IsValid tells if the SpanID isn't all zeros
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span propagated to
+// other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string
+}
+
+// IsValid tells if the SpanContext has both IDs
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled tells if the trace is being recorded
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// TraceParent renders the SpanContext as a traceparent
+// header value
+func (sc SpanContext) TraceParent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" +
+		hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent parses a W3C traceparent header value
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+	var flags [1]byte
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	switch {
+	case len(parts) < 4, len(parts[0]) != 2, parts[0] == "ff":
+		return sc, core.Wrapf(core.ErrInvalid, "%q: bad traceparent", s)
+	case parts[0] == "00" && len(parts) != 4:
+		return sc, core.Wrapf(core.ErrInvalid, "%q: bad traceparent", s)
+	}
+
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{
+		{sc.TraceID[:], parts[1]},
+		{sc.SpanID[:], parts[2]},
+		{flags[:], parts[3]},
+	} {
+		if err := decodeHex(f.dst, f.src); err != nil {
+			return SpanContext{}, core.Wrapf(err, "%q: bad traceparent", s)
+		}
+	}
+
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, core.Wrapf(core.ErrInvalid, "%q: bad traceparent", s)
+	}
+
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return core.ErrInvalid
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// Extract gets the SpanContext propagated on the given headers
+func Extract(hdr http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceParent(hdr.Get(TraceParentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	sc.State = strings.Join(hdr.Values(TraceStateHeader), ",")
+	return sc, true
+}
+
+// Inject sets the headers propagating the given SpanContext
+func Inject(hdr http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+
+	hdr.Set(TraceParentHeader, sc.TraceParent())
+	if sc.State != "" {
+		hdr.Set(TraceStateHeader, sc.State)
+	} else {
+		hdr.Del(TraceStateHeader)
+	}
+}
+
+var spanCtxKey = core.NewContextKey[*Span]("tracing.span")
+
+// SpanFromContext returns the current [Span], or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := spanCtxKey.Get(ctx)
+	return span
+}
+
+// ContextWithSpan stores the given [Span] on a sub-context
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return spanCtxKey.WithValue(ctx, span)
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
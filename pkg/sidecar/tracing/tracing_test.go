@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"darvaza.org/sidecar/pkg/sidecar/observe"
+)
+
+type testParentCase struct {
+	s  string
+	ok bool
+}
+
+func TestParseTraceParent(t *testing.T) {
+	var cases = []testParentCase{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6-00f067aa0ba902b7-01", false},
+		{"", false},
+	}
+
+	for i, tc := range cases {
+		sc, err := ParseTraceParent(tc.s)
+		switch {
+		case (err == nil) != tc.ok:
+			t.Errorf("ERROR: %v: %q: %v (expected ok:%v)", i, tc.s, err, tc.ok)
+		case err == nil && tc.s[:2] == "00" && sc.TraceParent() != tc.s:
+			t.Errorf("ERROR: %v: %q != %q", i, sc.TraceParent(), tc.s)
+		default:
+			t.Logf("%v: success", i)
+		}
+	}
+}
+
+// testCollector is a stand-in OTLP/HTTP collector
+func testCollector(t *testing.T) (string, <-chan otlpRequest) {
+	ch := make(chan otlpRequest, 10)
+
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var r otlpRequest
+
+		switch {
+		case req.URL.Path != DefaultTracesPath:
+			t.Errorf("ERROR: path: %q", req.URL.Path)
+		case req.Header.Get("Content-Type") != "application/json":
+			t.Errorf("ERROR: Content-Type: %q", req.Header.Get("Content-Type"))
+		case req.Header.Get("X-Token") != "secret":
+			t.Error("ERROR: headers not sent")
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+			t.Errorf("ERROR: Decode: %v", err)
+		}
+		ch <- r
+	}))
+	t.Cleanup(s.Close)
+
+	return s.URL, ch
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	url, ch := testCollector(t)
+	tr, err := (&Config{
+		Endpoint:    url,
+		Headers:     map[string]string{"X-Token": "secret"},
+		ServiceName: "test",
+	}).New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	var forwarded string
+	h := tr.HTTPMiddleware("h2", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		observe.SetHorizon(req.Context(), "lan")
+		forwarded = req.Header.Get(TraceParentHeader)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set(TraceParentHeader, traceParent)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	tr.Flush(context.Background())
+	r := <-ch
+
+	if len(r.ResourceSpans) != 1 || len(r.ResourceSpans[0].ScopeSpans) != 1 ||
+		len(r.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("ERROR: unexpected request: %+v", r)
+	}
+
+	span := r.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	attrs := make(map[string]otlpValue)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	switch {
+	case *r.ResourceSpans[0].Resource.Attributes[0].Value.StringValue != "test":
+		t.Error("ERROR: service.name")
+	case span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736":
+		t.Errorf("ERROR: traceId: %q", span.TraceID)
+	case span.ParentSpanID != "00f067aa0ba902b7":
+		t.Errorf("ERROR: parentSpanId: %q", span.ParentSpanID)
+	case forwarded != "00-"+span.TraceID+"-"+span.SpanID+"-01":
+		t.Errorf("ERROR: forwarded traceparent: %q", forwarded)
+	case span.Kind != SpanKindServer, span.Status.Code != StatusError:
+		t.Errorf("ERROR: kind:%v status:%v", span.Kind, span.Status.Code)
+	case attrs[AttrProto].StringValue == nil || *attrs[AttrProto].StringValue != "h2":
+		t.Error("ERROR: proto attribute")
+	case attrs[AttrHorizon].StringValue == nil || *attrs[AttrHorizon].StringValue != "lan":
+		t.Error("ERROR: horizon attribute")
+	case attrs["http.response.status_code"].IntValue == nil ||
+		*attrs["http.response.status_code"].IntValue != "502":
+		t.Error("ERROR: status code attribute")
+	default:
+		t.Log("success")
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tr *Tracer
+
+	ctx, span := tr.StartServer(context.Background(), "test", SpanContext{})
+	span.SetAttribute("foo", "bar")
+	span.End()
+
+	if SpanFromContext(ctx) != nil || span.IsRecording() {
+		t.Error("ERROR: nil Tracer recording")
+	}
+}
+
+func TestClose(t *testing.T) {
+	url, ch := testCollector(t)
+	tr, err := (&Config{
+		Endpoint: url,
+		Headers:  map[string]string{"X-Token": "secret"},
+	}).New()
+	if err != nil {
+		t.Fatalf("ERROR: New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tr.Run(ctx); err != nil {
+		t.Fatalf("ERROR: Run: %v", err)
+	}
+
+	// request finishing while the servers shut down
+	_, span := tr.StartServer(context.Background(), "late", SpanContext{})
+	span.End()
+
+	if err := tr.Close(); err != nil {
+		t.Fatalf("ERROR: Close: %v", err)
+	}
+
+	select {
+	case r := <-ch:
+		if len(r.ResourceSpans) != 1 {
+			t.Fatalf("ERROR: unexpected request: %+v", r)
+		}
+		t.Log("success")
+	default:
+		t.Error("ERROR: span not exported on Close")
+	}
+}
@@ -1,6 +1,46 @@
 package sidecar
 
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/netip"
+)
+
 // A Reloader is an application that can reload
 type Reloader interface {
 	Reload() error
 }
+
+// A HealthChecker is an application that can tell if it's healthy.
+// It is registered as the "app" health check on [Server.Spawn].
+type HealthChecker interface {
+	Healthy(ctx context.Context) error
+}
+
+// A Runner is a component that needs a background worker,
+// like a TLS store reloading its certificates.
+// A [Config.Store] implementing Runner is started on [Server.Spawn].
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// A TLSConfigurer is a TLS store that needs to adjust the
+// [tls.Config] used by the HTTPS listeners, like an ACME
+// issuer enabling TLS-ALPN-01.
+type TLSConfigurer interface {
+	ConfigureTLS(*tls.Config)
+}
+
+// An AcmeHTTP01Provider is a TLS store able to answer
+// ACME HTTP-01 challenges.
+type AcmeHTTP01Provider interface {
+	AcmeHTTP01Handler() http.Handler
+}
+
+// A HorizonExposer is an application telling which horizons
+// are reachable through a listener, like horizon.Horizons.
+// It's used by [Server.Endpoints] after [Server.Spawn].
+type HorizonExposer interface {
+	Exposed(local netip.AddrPort) []string
+}
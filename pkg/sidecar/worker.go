@@ -92,13 +92,72 @@ func (srv *Server) Spawn(h http.Handler, healthy time.Duration) error {
 		}
 	}
 
+	srv.ready.Store(true)
 	return nil
 }
 
 func (srv *Server) doSpawn(h http.Handler) error {
+	if r, ok := srv.tls.(Runner); ok {
+		// TLS store worker
+		srv.Go(r.Run)
+	}
+
+	if srv.ocsp != nil {
+		// OCSP stapling
+		srv.Go(srv.ocsp.Run)
+	}
+
+	if srv.tickets != nil {
+		// session ticket keys
+		srv.Go(srv.runSessionTicketsRotation)
+	}
+
+	if srv.tracer != nil {
+		// spans export, flushed once the HTTP and DNS
+		// servers have finished their requests
+		srv.GoWithShutdown(srv.tracer.Run, func() error {
+			srv.waitShutdown()
+			return srv.tracer.Close()
+		})
+	}
+
+	if srv.accessLog != nil {
+		// access log file, closed once the HTTP servers
+		// have finished their requests
+		srv.GoWithShutdown(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, func() error {
+			srv.hs.WaitShutdown()
+			return srv.accessLog.Close()
+		})
+	}
+
+	if srv.dnstap != nil {
+		// dnstap output
+		srv.Go(srv.dnstap.Run)
+	}
+
+	// certificates expiry
+	srv.Go(srv.runExpiryMonitor)
+
+	if c, ok := h.(HealthChecker); ok {
+		// application's health
+		srv.AddHealthCheck("app", c.Healthy)
+	}
+
+	if e, ok := h.(HorizonExposer); ok {
+		// horizons of each endpoint
+		srv.exposer.Store(e)
+	}
+
+	// admin listener
+	srv.spawnAdmin()
+
 	if err := srv.hs.Spawn(h, 0); err != nil {
 		return err
 	}
+	srv.AddHealthCheck("http", srv.hs.Healthy)
 
 	if srv.ds != nil {
 		// DNS
@@ -114,11 +173,21 @@ func (srv *Server) doSpawn(h http.Handler) error {
 
 			return srv.eg.Wait()
 		}
+		srv.AddHealthCheck("dns", srv.ds.Healthy)
 	}
 
 	return nil
 }
 
+// waitShutdown blocks until the HTTP and DNS servers have
+// shut down
+func (srv *Server) waitShutdown() {
+	srv.hs.WaitShutdown()
+	if srv.ds != nil {
+		srv.ds.WaitShutdown()
+	}
+}
+
 // Go runs a worker on the Server's Context
 func (srv *Server) Go(run func(ctx context.Context) error) {
 	srv.eg.Go(run, nil)